@@ -0,0 +1,244 @@
+// Package container builds the API from its configuration: it connects the
+// databases and the broker, creates the services on them and the handlers
+// the routes are served by.
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/controllers"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/config"
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/platform/analytics"
+	"github.com/r3tr056/ecolens_api/platform/db"
+	"github.com/r3tr056/ecolens_api/platform/health"
+	"github.com/r3tr056/ecolens_api/platform/history"
+	"github.com/r3tr056/ecolens_api/platform/metrics"
+	"github.com/r3tr056/ecolens_api/platform/outbox"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+	"github.com/r3tr056/ecolens_api/platform/semantic"
+	"github.com/r3tr056/ecolens_api/platform/suggest"
+	"github.com/r3tr056/ecolens_api/platform/understand"
+	"github.com/r3tr056/ecolens_api/platform/webhook"
+)
+
+// worker is a background service of the API
+type worker interface {
+	Start()
+	Stop()
+}
+
+// Container holds the connections, services and handlers of the API.
+type Container struct {
+	DB           *gorm.DB
+	Redis        *redis.Client
+	Broker       pubsub.Broker
+	Repositories *repository.Repositories
+
+	Users         services.Users
+	Products      services.Products
+	Search        services.Search
+	SearchHistory services.SearchHistory
+	Webhooks      services.Webhooks
+	Admin         services.Admin
+	Media         services.Media
+	Messaging     services.Messaging
+
+	// Health checks the dependencies, Drain it before shutting down
+	Health *health.Service
+
+	Handlers *controllers.Handlers
+
+	// workers are started in order and stopped in reverse
+	workers []worker
+}
+
+// New builds the API configured by cfg. The background services are not
+// running until Start.
+func New(ctx context.Context, cfg *config.Config) (*Container, error) {
+	c := &Container{}
+
+	// Search in the languages of the users, the search vectors are stemmed
+	// in the default one
+	languages, err := locale.New(cfg.Search.DefaultLanguage, cfg.Search.Languages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the search languages: %w", err)
+	}
+	models.DefaultLanguage = languages.Default
+
+	c.DB, err = db.OpenPostgresConnection(cfg.Postgres.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+
+	if err := metrics.RegisterPostgres(c.DB); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to instrument the database: %w", err)
+	}
+
+	c.Repositories = repository.NewPostgres(c.DB)
+
+	// Search sessions, suggestions and cached results are kept in Redis
+	c.Redis = db.CreateRedisClient(cfg.Redis.SearchCacheAddr, cfg.Redis.SearchCacheDB)
+	if err := metrics.RegisterRedis("search", c.Redis); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to instrument redis: %w", err)
+	}
+
+	// Connect to the message broker selected by MESSAGE_BROKER
+	c.Broker, err = pubsub.NewBroker(ctx, pubsub.BrokerConfig{
+		Backend:        cfg.Broker.Backend,
+		GoogleProject:  cfg.Broker.GoogleProject,
+		RedisAddr:      cfg.Broker.RedisAddr,
+		RedisDB:        cfg.Broker.RedisDB,
+		RedisGroupIdle: cfg.Broker.RedisIdle,
+	})
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to connect to the message broker: %w", err)
+	}
+
+	// Call the ML workers over the broker
+	messaging, err := services.NewMessaging(c.DB, c.Broker, cfg.Broker.SearchTopic, cfg.Broker.SearchSubscription)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to start the search task RPC: %w", err)
+	}
+	c.Messaging = messaging
+
+	// Embed products and reports for the semantic search
+	embedder, err := semantic.NewEmbedder(cfg.Semantic.EmbeddingsURL, cfg.Semantic.EmbeddingsAPIKey, cfg.Semantic.EmbeddingsModel, cfg.Semantic.EmbeddingsDimensions)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to configure the embedder: %w", err)
+	}
+
+	// Publish domain events recorded in the outbox
+	relayOptions := outbox.DefaultOptions(cfg.Events.Topic)
+	relayOptions.Retention = cfg.Events.Retention
+	relay := outbox.NewRelay(c.DB, c.Broker, relayOptions)
+
+	// Deliver product events to partner webhooks
+	webhookOptions := webhook.DefaultOptions(cfg.Events.Topic, cfg.Events.WebhookSubscription)
+	webhookOptions.AllowPrivateNetworks = cfg.Server.Stage == config.StageDev
+	dispatcher := webhook.NewDispatcher(c.DB, c.Broker, messaging.RecordDeadLetter, webhookOptions)
+
+	// Complete search box input, refreshing the index from product events
+	indexer := suggest.NewIndexer(c.DB, c.Redis, c.Broker, messaging.RecordDeadLetter, suggest.Options{
+		Topic:        cfg.Events.Topic,
+		Subscription: cfg.Events.SuggestSubscription,
+	})
+
+	// Cache search results, invalidated by catalogue writes
+	cache := searchcache.New(c.Redis, searchcache.Options{
+		TTL:      cfg.Search.CacheTTL,
+		StaleTTL: cfg.Search.CacheStaleTTL,
+	})
+	if err := metrics.RegisterSearchCache(cache); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to instrument the search cache: %w", err)
+	}
+
+	backends := services.SearchBackends{
+		DB:            c.DB,
+		Redis:         c.Redis,
+		Cache:         cache,
+		Suggestions:   suggest.NewService(c.DB, c.Redis),
+		Understanding: understand.NewService(c.DB),
+		Languages:     languages,
+		Analytics:     analytics.NewService(c.DB, []byte(cfg.Search.AnalyticsKey)),
+		History:       history.NewRecorder(c.DB),
+	}
+
+	c.workers = []worker{
+		messaging,
+		relay,
+		dispatcher,
+		indexer,
+		backends.History,
+		backends.Analytics,
+		backends.Understanding,
+	}
+	// semantic search needs an embeddings service
+	if embedder != nil {
+		backends.Semantic = semantic.NewService(c.DB, embedder, cfg.Semantic.MinSimilarity)
+		c.workers = append(c.workers, backends.Semantic)
+	}
+
+	c.Users = services.NewUsers(c.Repositories, c.DB)
+	c.Products = services.NewProducts(c.Repositories.Products, cache)
+	c.Search = services.NewSearch(backends)
+	c.SearchHistory = services.NewSearchHistory(c.DB)
+	c.Webhooks = services.NewWebhooks(c.DB)
+	c.Admin = services.NewAdmin(c.DB, c.Messaging, c.Search)
+	c.Media = services.NewMedia(c.Repositories.Images, services.MediaOptions{
+		APIKey:       cfg.Storage.APIKey,
+		AvatarBucket: cfg.Storage.AvatarBucket,
+		ImageBucket:  cfg.Storage.ImageBucket,
+	})
+
+	// Probe the dependencies, the blob storage is only needed by uploads
+	c.Health = health.NewService()
+	c.Health.Register("postgres", health.Postgres(c.DB), health.DefaultOptions())
+	c.Health.Register("redis", health.Redis(c.Redis), health.DefaultOptions())
+	c.Health.Register("broker", func(ctx context.Context) error {
+		return c.Broker.Ping(ctx, cfg.Broker.SearchTopic)
+	}, health.DefaultOptions())
+	if cfg.Storage.AvatarBucket != "" || cfg.Storage.ImageBucket != "" {
+		storage := health.DefaultOptions()
+		storage.Timeout = 5 * time.Second
+		storage.TTL = 30 * time.Second
+		storage.Optional = true
+		c.Health.Register("storage", c.Media.Ping, storage)
+	}
+
+	c.Handlers = &controllers.Handlers{
+		Auth:          controllers.NewAuthController(c.Users),
+		Users:         controllers.NewUserController(c.Users, c.Media),
+		Products:      controllers.NewProductController(c.Products, c.Search),
+		Search:        controllers.NewSearchController(c.Search, c.Media, c.Messaging),
+		SearchHistory: controllers.NewSearchHistoryController(c.SearchHistory, c.Search),
+		// partners may only register HTTPS endpoints outside development
+		Webhooks: controllers.NewWebhookController(c.Webhooks, dispatcher, cfg.Server.Stage == config.StageDev),
+		Admin:    controllers.NewAdminController(c.Admin, c.Search),
+		Health:   controllers.NewHealthController(c.Health),
+	}
+
+	return c, nil
+}
+
+// Start starts the background services.
+func (c *Container) Start() {
+	for _, w := range c.workers {
+		w.Start()
+	}
+}
+
+// Close stops the background services and closes the connections.
+func (c *Container) Close() {
+	for i := len(c.workers) - 1; i >= 0; i-- {
+		c.workers[i].Stop()
+	}
+	c.workers = nil
+
+	if c.Broker != nil {
+		c.Broker.Close()
+	}
+	if c.Redis != nil {
+		c.Redis.Close()
+	}
+	if c.DB != nil {
+		if sqlDB, err := c.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
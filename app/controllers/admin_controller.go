@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+)
+
+// AdminController serves the admin endpoints: dead letters, the search
+// cache, analytics and synonyms
+type AdminController struct {
+	admin  services.Admin
+	search services.Search
+}
+
+// NewAdminController returns the admin endpoints of admin, the search
+// cache stats are those of search.
+func NewAdminController(admin services.Admin, search services.Search) *AdminController {
+	return &AdminController{admin: admin, search: search}
+}
+
+// GetDeadLetters godoc
+// @Summary List dead-lettered messages
+// @Description Retrieves a paginated list of messages that were moved to a dead-letter topic, newest first.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param topic query string false "Only return messages from this topic"
+// @Param page query integer false "Page number for pagination (default is 1)"
+// @Param limit query integer false "Number of messages to retrieve per page (default is 20)"
+// @Success 200 {array} models.DeadLetter "Successful response with the list of dead letters"
+// @Failure 500 {object} problem.Document "Failed to retrieve dead letters"
+// @Router /api/v1/admin/dead-letters [get]
+func (h *AdminController) GetDeadLetters(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	deadLetters, err := h.admin.DeadLetters(c.Context(), c.Query("topic"), page, limit)
+	if err != nil {
+		return problem.Internal("Failed to retrieve dead letters", err)
+	}
+
+	return c.JSON(deadLetters)
+}
+
+// GetDeadLetter godoc
+// @Summary Get a dead-lettered message by ID
+// @Description Retrieves a dead-lettered message including its payload, attributes and the reason it was dead-lettered.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path integer true "Dead letter ID"
+// @Success 200 {object} models.DeadLetter "Successful response with the dead letter"
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 404 {object} problem.Document "Dead letter not found"
+// @Router /api/v1/admin/dead-letters/{id} [get]
+func (h *AdminController) GetDeadLetter(c *fiber.Ctx) error {
+	deadLetter, ferr := h.findDeadLetter(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	return c.JSON(deadLetter)
+}
+
+// ReplayDeadLetter godoc
+// @Summary Replay a dead-lettered message
+// @Description Publishes a dead-lettered message again on the topic it originally failed on.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path integer true "Dead letter ID"
+// @Success 200 {object} models.DeadLetter "Message replayed"
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 404 {object} problem.Document "Dead letter not found"
+// @Failure 500 {object} problem.Document "Failed to replay the message"
+// @Router /api/v1/admin/dead-letters/{id}/replay [post]
+func (h *AdminController) ReplayDeadLetter(c *fiber.Ctx) error {
+	deadLetter, ferr := h.findDeadLetter(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.admin.Replay(c.Context(), deadLetter); err != nil {
+		return problem.Internal("Failed to replay the message", err)
+	}
+
+	return c.JSON(deadLetter)
+}
+
+// GetSearchCacheStats godoc
+// @Summary Show search cache statistics
+// @Description Counts the search cache hits, stale hits served while refreshing, misses and Redis errors of this instance since it started.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} searchcache.Stats "Search cache statistics"
+// @Router /api/v1/admin/search-cache [get]
+func (h *AdminController) GetSearchCacheStats(c *fiber.Ctx) error {
+	return c.JSON(h.search.CacheStats())
+}
+
+func (h *AdminController) findDeadLetter(c *fiber.Ctx) (*models.DeadLetter, *problem.Error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 0)
+	if err != nil {
+		return nil, problem.BadRequest("Invalid ID")
+	}
+
+	deadLetter, err := h.admin.DeadLetter(c.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, problem.NotFound("Dead letter not found")
+		}
+		return nil, problem.Internal("Failed to retrieve dead letter", err)
+	}
+
+	return deadLetter, nil
+}
@@ -2,20 +2,26 @@
 package controllers
 
 import (
-	"fmt"
-	"math/rand"
-	"time"
+	"errors"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
 	"github.com/r3tr056/ecolens_api/pkg/utils"
-	"github.com/r3tr056/ecolens_api/pkg/utils/email"
-	"github.com/r3tr056/ecolens_api/platform/db"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-var resetTokens = make(map[string]models.ResetTokenInfo)
+// AuthController serves the sign-up, sign-in and password reset endpoints
+type AuthController struct {
+	users services.Users
+}
+
+// NewAuthController returns the auth endpoints of users.
+func NewAuthController(users services.Users) *AuthController {
+	return &AuthController{users: users}
+}
 
 // @Summary User SignUp
 // @Description Create a new user account.
@@ -24,62 +30,37 @@ var resetTokens = make(map[string]models.ResetTokenInfo)
 // @Produce json
 // @Param input body models.SignUp true "User SignUp details"
 // @Success 200 {object} fiber.Map{"error":false, "message": "User created successfully", "inserted_id": "123", "user": {"id": "123", "created_at": "2022-01-01T12:00:00Z", "email": "user@example.com", "user_status": 1, "user_role": "user"}}
-// @Failure 400 {object} fiber.Map{"error":true, "msg": "Bad Request"}
-// @Failure 401 {object} fiber.Map{"error":true, "msg": "Unauthorized"}
-// @Failure 500 {object} fiber.Map{"error":true, "msg": "Internal Server Error"}
+// @Failure 400 {object} problem.Document "Bad Request"
+// @Failure 401 {object} problem.Document "Unauthorized"
+// @Failure 409 {object} problem.Document "Email is already registered"
+// @Failure 500 {object} problem.Document "Internal Server Error"
 // @Router /signup [post]
-func UserSignUp(c *fiber.Ctx) error {
+func (h *AuthController) UserSignUp(c *fiber.Ctx) error {
 	// create new user auth struct
 	signUp := &models.SignUp{}
 
 	if err := c.BodyParser(signUp); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 
 	validate := utils.NewValidator()
 
 	if err := validate.Struct(signUp); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": true,
-			"msg":   utils.ValidateErrors(err),
-		})
+		return problem.Validation(err)
 	}
 
-	user := &models.User{}
-	// fill up user data
-	user.CreatedAt = time.Now()
-	user.Email = signUp.Email
-	hashedPassword, err := utils.GeneratePassword(signUp.Password)
+	user, err := h.users.SignUp(c.Context(), signUp)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
-	}
-	user.PasswordHash = hashedPassword
-	user.UserStatus = 1
-	user.UserRole = signUp.UserRole
-
-	if err := validate.Struct(user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": true,
-			"msg":   utils.ValidateErrors(err),
-		})
+		var invalid validator.ValidationErrors
+		switch {
+		case errors.As(err, &invalid):
+			return problem.Validation(invalid)
+		case errors.Is(err, services.ErrConflict):
+			return problem.Conflict("Email is already registered").WithCode(problem.CodeEmailTaken)
+		}
+		return serviceProblem(err)
 	}
 
-	if err := db.PostgresDB.Create(user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
-	}
-
-	// Delete the password hash
-	user.PasswordHash = ""
-
 	return c.JSON(fiber.Map{
 		"error":       false,
 		"msg":         nil,
@@ -95,41 +76,23 @@ func UserSignUp(c *fiber.Ctx) error {
 // @Produce json
 // @Param input body models.SignIn true "User SignIn details"
 // @Success 200 {object} fiber.Map{"error":false, "message": "Login success", "tokens": {"access": "access_token", "refresh": "refresh_token"}}
-// @Failure 400 {object} fiber.Map{"error":true, "msg": "Bad Request"}
-// @Failure 401 {object} fiber.Map{"error":true, "msg": "Invalid credentials"}
-// @Failure 500 {object} fiber.Map{"error":true, "msg": "Internal Server Error"}
+// @Failure 400 {object} problem.Document "Bad Request"
+// @Failure 401 {object} problem.Document "Invalid credentials"
+// @Failure 500 {object} problem.Document "Internal Server Error"
 // @Router /signin [post]
-func UserSignIn(c *fiber.Ctx) error {
+func (h *AuthController) UserSignIn(c *fiber.Ctx) error {
 	signIn := &models.SignIn{}
-	var user models.User
 
 	if err := c.BodyParser(signIn); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 
-	if err := db.PostgresDB.Where("email = ?", signIn.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(signIn.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": true,
-			"msg":   "Invalid credentials",
-		})
-	}
-
-	tokens, err := utils.GenerateNewTokens(user.ID)
+	user, tokens, err := h.users.SignIn(c.Context(), signIn.Email, signIn.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			return problem.Unauthorized("Invalid credentials").WithCode(problem.CodeInvalidCredentials)
+		}
+		return serviceProblem(err)
 	}
 
 	// Return status 200 OK
@@ -144,50 +107,18 @@ func UserSignIn(c *fiber.Ctx) error {
 	})
 }
 
-func generateResetToken() string {
-	const tokenLength = 16
-	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-
-	rand.New(rand.NewSource(time.Now().UnixNano()))
-	b := make([]byte, tokenLength)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
-	}
-
-	return string(b)
-}
-
-func ForgotPassword(c *fiber.Ctx) error {
+func (h *AuthController) ForgotPassword(c *fiber.Ctx) error {
 	var request models.ForgotPassword
-	var user models.User
 
 	if err := c.BodyParser(&request); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request payload",
-		})
-	}
-
-	if err := db.PostgresDB.Where("email = ?", request.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": true,
-			"msg":   "User not found",
-		})
+		return problem.BadRequest("Invalid request payload")
 	}
 
-	token := generateResetToken()
-	// Store the token with an expiration time
-	resetTokens[token] = models.ResetTokenInfo{
-		UserID:         user.ID,
-		ExpirationTime: time.Now().Add(time.Hour),
-	}
-
-	name := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
-	err := email.SendResetEmail(user.Email, name, user.Username, token)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to send reset email",
-		})
+	if err := h.users.RequestPasswordReset(c.Context(), request.Email); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return problem.NotFound("User not found")
+		}
+		return problem.Internal("Failed to send reset email", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -196,50 +127,23 @@ func ForgotPassword(c *fiber.Ctx) error {
 
 }
 
-func ResetPasswordHandler(c *fiber.Ctx) error {
+func (h *AuthController) ResetPasswordHandler(c *fiber.Ctx) error {
 	resetToken := c.Params("token")
 	newPassword := c.Params("newPassword")
-	var user models.User
 
 	if resetToken == "" || newPassword == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid reset token or password",
-		})
-	}
-
-	tokenInfo, validToken := resetTokens[resetToken]
-	if !validToken || time.Now().After(tokenInfo.ExpirationTime) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Invalid or expired reset token",
-		})
-	}
-
-	if err := db.PostgresDB.First(&user, tokenInfo.UserID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": true,
-			"msg":   "User not found",
-		})
+		return problem.BadRequest("Invalid reset token or password")
 	}
 
-	hashedPassword, err := utils.GeneratePassword(newPassword)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
+	if err := h.users.ResetPassword(c.Context(), resetToken, newPassword); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidResetToken):
+			return problem.BadRequest("Invalid or expired reset token").WithCode(problem.CodeInvalidResetToken)
+		case errors.Is(err, services.ErrNotFound):
+			return problem.NotFound("User not found")
+		}
+		return serviceProblem(err)
 	}
-	user.PasswordHash = hashedPassword
-
-	if err := db.PostgresDB.Save(user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
-	}
-
-	delete(resetTokens, resetToken)
 
 	return c.JSON(fiber.Map{
 		"message": "Password reset successful",
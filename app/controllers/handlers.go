@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+)
+
+// Handlers are the controllers the routes are served by, built by the
+// application container.
+type Handlers struct {
+	Auth          *AuthController
+	Users         *UserController
+	Products      *ProductController
+	Search        *SearchController
+	SearchHistory *SearchHistoryController
+	Webhooks      *WebhookController
+	Admin         *AdminController
+	Health        *HealthController
+}
+
+// serviceProblem returns the problem of an error of the services: a missing
+// record, one clashing with a stored one or an invalid one, else the
+// problem of problem.From.
+func serviceProblem(err error) *problem.Error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return &problem.Error{Status: fiber.StatusNotFound, Code: problem.CodeNotFound, Detail: "The resource does not exist", Err: err}
+	case errors.Is(err, services.ErrConflict):
+		return &problem.Error{Status: fiber.StatusConflict, Code: problem.CodeConflict, Detail: "The resource conflicts with an existing one", Err: err}
+	case errors.Is(err, services.ErrInvalid):
+		// the fields are listed when the struct tags of the model failed
+		if p := problem.From(err); p.Code == problem.CodeValidationFailed {
+			return p
+		}
+		return &problem.Error{Status: fiber.StatusBadRequest, Code: problem.CodeValidationFailed, Detail: "The resource is invalid", Err: err}
+	}
+	return problem.From(err)
+}
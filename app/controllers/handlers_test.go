@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+func TestServiceProblem(t *testing.T) {
+	type record struct {
+		Email string `validate:"required,email"`
+	}
+	fieldErr := utils.NewValidator().Struct(record{Email: "nope"})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		fields bool
+	}{
+		{"not found", fmt.Errorf("loading: %w", repository.ErrNotFound), fiber.StatusNotFound, problem.CodeNotFound, false},
+		{"conflict", repository.ErrConflict, fiber.StatusConflict, problem.CodeConflict, false},
+		{"invalid fields", &repository.ValidationError{Err: fieldErr}, fiber.StatusBadRequest, problem.CodeValidationFailed, true},
+		{"broken constraint", &repository.ValidationError{Err: errors.New("violates foreign key")}, fiber.StatusBadRequest, problem.CodeValidationFailed, false},
+		{"other", errors.New("connection reset"), fiber.StatusInternalServerError, problem.CodeInternal, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := serviceProblem(tt.err)
+			if p.Status != tt.status || p.Code != tt.code || (len(p.Fields) > 0) != tt.fields {
+				t.Errorf("serviceProblem = %d %s %v, want %d %s", p.Status, p.Code, p.Fields, tt.status, tt.code)
+			}
+		})
+	}
+}
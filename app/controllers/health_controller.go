@@ -2,27 +2,44 @@ package controllers
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/r3tr056/ecolens_api/platform/db"
+
+	"github.com/r3tr056/ecolens_api/platform/health"
 )
 
-// healthCheck godoc
-// @Summary Perform a health check
-// @Description Checks the health status of the application and its dependencies.
-// @Accept json
+// HealthController reports the health of the API and its dependencies
+type HealthController struct {
+	health *health.Service
+}
+
+// NewHealthController returns the probes answering with the checks of
+// health.
+func NewHealthController(health *health.Service) *HealthController {
+	return &HealthController{health: health}
+}
+
+// Live godoc
+// @Summary Liveness probe
+// @Description Reports the health of the dependencies of the API. It answers 200 as long as the process serves, a dependency being down is not fixed by restarting the API.
+// @Tags Health
 // @Produce json
-// @Success 200 {object} map[string]string "Health status response"
-// @Router /health [get]
-func healthCheck(c *fiber.Ctx) error {
-	// health status
-	status := map[string]string{
-		"status": "ok",
-	}
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (h *HealthController) Live(c *fiber.Ctx) error {
+	return c.JSON(h.health.Report())
+}
 
-	if db.DatabaseCheck() {
-		status["postgres_database"] = "ok"
-	} else {
-		status["postgres_database"] = "error"
+// Ready godoc
+// @Summary Readiness probe
+// @Description Reports the health of the dependencies of the API. It answers 503 when a required dependency is down or the API is shutting down, for load balancers to stop sending it traffic.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthController) Ready(c *fiber.Ctx) error {
+	report := h.health.Report()
+	if !report.Ready() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(report)
 	}
-
-	return c.JSON(status)
+	return c.JSON(report)
 }
@@ -1,142 +1,130 @@
 package controllers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/r3tr056/ecolens_api/app/models"
-	"github.com/r3tr056/ecolens_api/platform/db"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
 )
 
-// pubSubClient, err := pubsub_client.NewPubSubClient("product", "product")
+// ProductController serves the catalogue endpoints
+type ProductController struct {
+	products services.Products
+	search   services.Search
+}
+
+// NewProductController returns the catalogue endpoints of products, whose
+// translations are checked against the languages of search.
+func NewProductController(products services.Products, search services.Search) *ProductController {
+	return &ProductController{products: products, search: search}
+}
 
 // AddProduct godoc
 // @Summary Add a new product
-// @Description Adds a new product to the database and triggers analysis of product information.
+// @Description Adds a new product to the database and records a product.created event that triggers analysis of product information.
 // @Accept json
 // @Produce json
 // @Param newProduct body models.Product true "New product information to add"
 // @Success 201 {object} models.Product "Product added successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request or product data"
-// @Failure 500 {object} ErrorResponse "Failed to create product or analyze product information"
+// @Failure 400 {object} problem.Document "Invalid request or product data"
+// @Failure 500 {object} problem.Document "Failed to create product or analyze product information"
 // @Router /products [post]
-func AddProduct(c *fiber.Ctx) error {
+func (h *ProductController) AddProduct(c *fiber.Ctx) error {
 	var newProduct models.Product
 	if err := c.BodyParser(&newProduct); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 
-	// Add the new product to the database
-	if err := db.PostgresDB.Create(&newProduct); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create product",
-		})
+	// Add the new product and its outbox events in one transaction
+	if err := h.products.Create(c.Context(), &newProduct); err != nil {
+		if errors.Is(err, services.ErrInvalid) {
+			return serviceProblem(err)
+		}
+		return problem.Internal("Failed to create product", err)
 	}
 
-	// _, err = pubSubClient.CallMethod("analyze-product-info", newProduct.ID)
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Failed to analyze product information.",
-	// 	})
-	// }
-
 	return c.Status(fiber.StatusCreated).JSON(newProduct)
 }
 
 // AddMarketPlaceProduct godoc
 // @Summary Add a new marketplace product
-// @Description Adds a new product to the marketplace database and triggers analysis of product information.
+// @Description Adds a new product to the marketplace database and records a product.created event that triggers analysis of product information.
 // @Accept json
 // @Produce json
 // @Param newProduct body models.MarketPlaceProduct true "New marketplace product information to add"
 // @Success 201 {object} models.MarketPlaceProduct "Marketplace product added successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request or product data"
-// @Failure 500 {object} ErrorResponse "Failed to create marketplace product or analyze product information"
+// @Failure 400 {object} problem.Document "Invalid request or product data"
+// @Failure 500 {object} problem.Document "Failed to create marketplace product or analyze product information"
 // @Router /marketplace/products [post]
-func AddMarketPlaceProduct(c *fiber.Ctx) error {
+func (h *ProductController) AddMarketPlaceProduct(c *fiber.Ctx) error {
 	var newProduct models.MarketPlaceProduct
 	if err := c.BodyParser(&newProduct); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 
-	if err := db.PostgresDB.Create(&newProduct); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create product",
-		})
+	if err := h.products.CreateMarketplace(c.Context(), &newProduct); err != nil {
+		if errors.Is(err, services.ErrInvalid) {
+			return serviceProblem(err)
+		}
+		return problem.Internal("Failed to create product", err)
 	}
 
-	// pubsubClient, err := pubsub_client.NewPubSubClient("product", "marketplace")
-	// _, err = pubsubClient.CallMethod("analyze-product-info", newProduct.ID)
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Failed to analyze product information.",
-	// 	})
-	// }
-
 	return c.Status(fiber.StatusCreated).JSON(newProduct)
 }
 
 // UpdateProduct godoc
 // @Summary Update an existing product by ID
-// @Description Updates an existing product in the database by the specified ID and triggers analysis of product information.
+// @Description Updates an existing product in the database by the specified ID and records a product.updated event that triggers analysis of product information.
 // @Accept json
 // @Produce json
 // @Param id path integer true "Product ID to update"
 // @Param updatedProduct body models.Product true "Updated product information"
 // @Success 200 {object} models.Product "Product updated successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request, product ID, or product data"
-// @Failure 500 {object} ErrorResponse "Failed to update product or analyze product information"
-// @Router /products/{id} [put]
-func UpdateProduct(c *fiber.Ctx) error {
+// @Failure 400 {object} problem.Document "Invalid request, product ID, or product data"
+// @Failure 404 {object} problem.Document "Product not found"
+// @Failure 500 {object} problem.Document "Failed to update product or analyze product information"
+// @Router /api/v1/product/{id} [put]
+func (h *ProductController) UpdateProduct(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid Product ID",
-		})
+		return problem.BadRequest("Invalid Product ID")
 	}
 
 	var updatedProduct models.Product
 	if err := c.BodyParser(&updatedProduct); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 
-	// Update the existing product in the database
-	if err := db.PostgresDB.Model(&models.Product{}).Where("id = ?", id).Updates(updatedProduct).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update product.",
-		})
+	// Update the existing product and record its outbox events in one transaction
+	if err := h.products.Update(c.Context(), uint(id), &updatedProduct); err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotFound):
+			return problem.NotFound("Product not found")
+		case errors.Is(err, services.ErrInvalid):
+			return serviceProblem(err)
+		}
+		return problem.Internal("Failed to update product.", err)
 	}
 
-	// pubSubClient, err := pubsub_client.NewPubSubClient("product", "product")
-	// _, err = pubSubClient.CallMethod("analyze-product-info", updatedProduct.ID)
-	// if err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"error": "Failed to analyze product information.",
-	// 	})
-	// }
-
 	return c.Status(fiber.StatusOK).JSON(updatedProduct)
 }
 
 // GetProducts godoc
 // @Summary Get a list of products with pagination
-// @Description Retrieves a paginated list of products based on the specified page and limit parameters.
+// @Description Retrieves a paginated list of products based on the specified page and limit parameters. Names and descriptions are returned in the language of the Accept-Language header where translated.
 // @Accept json
 // @Produce json
 // @Param page query integer false "Page number for pagination (default is 1)"
 // @Param limit query integer false "Number of products to retrieve per page (default is 10)"
 // @Success 200 {array} models.Product "Successful response with the list of products"
-// @Failure 400 {object} ErrorResponse "Invalid page or limit parameter"
-// @Failure 500 {object} ErrorResponse "Failed to retrieve products"
+// @Failure 400 {object} problem.Document "Invalid page or limit parameter"
+// @Failure 500 {object} problem.Document "Failed to retrieve products"
 // @Router /products [get]
-func GetProducts(c *fiber.Ctx) error {
+func (h *ProductController) GetProducts(c *fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page < 1 {
 		page = 1
@@ -147,12 +135,11 @@ func GetProducts(c *fiber.Ctx) error {
 		limit = 10
 	}
 
-	// Calculate offset based on page and limit
-	offset := (page - 1) * limit
-
-	// Retrieve paginated products from the database
-	var products []models.Product
-	db.PostgresDB.Offset(offset).Limit(limit).Find(&products)
+	// in the language the client accepts where translated
+	products, err := h.products.List(c.Context(), page, limit, h.search.Language("", c.Get(fiber.HeaderAcceptLanguage)))
+	if err != nil {
+		return problem.Internal("Failed to retrieve products", err)
+	}
 
 	return c.JSON(products)
 }
@@ -164,22 +151,21 @@ func GetProducts(c *fiber.Ctx) error {
 // @Produce json
 // @Param id path integer true "Product ID to retrieve"
 // @Success 200 {object} models.Product "Successful response with the product details"
-// @Failure 400 {object} ErrorResponse "Invalid ID"
-// @Failure 404 {object} ErrorResponse "Product not found"
-// @Router /products/{id} [get]
-func GetProductByID(c *fiber.Ctx) error {
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 404 {object} problem.Document "Product not found"
+// @Router /api/v1/product/{id} [get]
+func (h *ProductController) GetProductByID(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid ID",
-		})
+		return problem.BadRequest("Invalid ID")
 	}
 
-	var product models.Product
-	if err := db.PostgresDB.Preload("Images").Preload("MarketplaceAlternatives").Preload("EPD.LCAMetrics").Preload("Reports").First(&product, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Product not found",
-		})
+	product, err := h.products.Get(c.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return problem.NotFound("Product not found")
+		}
+		return problem.Internal("Failed to retrieve product", err)
 	}
 
 	return c.JSON(product)
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+// GetProductTranslations godoc
+// @Summary List the translations of a product
+// @Description Lists the names and descriptions of a product in the languages other than the default one.
+// @Tags Products
+// @Produce json
+// @Param id path integer true "Product ID"
+// @Success 200 {array} models.ProductTranslation "The translations of the product"
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 404 {object} problem.Document "Product not found"
+// @Router /api/v1/product/{id}/translations [get]
+func (h *ProductController) GetProductTranslations(c *fiber.Ctx) error {
+	id, ferr := h.findProductID(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	translations, err := h.products.Translations(c.Context(), id)
+	if err != nil {
+		return problem.Internal("Failed to retrieve the translations", err)
+	}
+
+	return c.JSON(translations)
+}
+
+// PutProductTranslation godoc
+// @Summary Translate a product
+// @Description Sets the name and description of a product in a language. Searches in the language match the translation and return it, products without one are returned in the default language.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param id path integer true "Product ID"
+// @Param language path string true "Language code, e.g. de"
+// @Param translation body models.ProductTranslationRequest true "The translated name and description"
+// @Success 200 {object} models.ProductTranslation "The translation"
+// @Failure 400 {object} problem.Document "Invalid request or unsupported language"
+// @Failure 404 {object} problem.Document "Product not found"
+// @Failure 500 {object} problem.Document "Failed to save the translation"
+// @Router /api/v1/product/{id}/translations/{language} [put]
+func (h *ProductController) PutProductTranslation(c *fiber.Ctx) error {
+	id, ferr := h.findProductID(c)
+	if ferr == nil {
+		ferr = h.checkTranslationLanguage(c.Params("language"))
+	}
+	if ferr != nil {
+		return ferr
+	}
+
+	request := &models.ProductTranslationRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return problem.InvalidBody(err)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(request); err != nil {
+		return problem.Validation(err)
+	}
+
+	translation := &models.ProductTranslation{
+		ProductID:   id,
+		Language:    c.Params("language"),
+		Name:        request.Name,
+		Description: request.Description,
+	}
+	if err := h.products.PutTranslation(c.Context(), translation); err != nil {
+		if errors.Is(err, services.ErrInvalid) {
+			return serviceProblem(err)
+		}
+		return problem.Internal("Failed to save the translation", err)
+	}
+
+	return c.JSON(translation)
+}
+
+// DeleteProductTranslation godoc
+// @Summary Delete a translation of a product
+// @Description Deletes the translation of a product in a language, the product is then returned in the default language.
+// @Tags Products
+// @Param id path integer true "Product ID"
+// @Param language path string true "Language code, e.g. de"
+// @Success 200 "Translation deleted"
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 404 {object} problem.Document "Translation not found"
+// @Router /api/v1/product/{id}/translations/{language} [delete]
+func (h *ProductController) DeleteProductTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return problem.BadRequest("Invalid ID")
+	}
+
+	if err := h.products.DeleteTranslation(c.Context(), uint(id), c.Params("language")); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return problem.NotFound("Translation not found")
+		}
+		return problem.Internal("Failed to delete the translation", err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// findProductID returns the ID of the product of the request's path.
+func (h *ProductController) findProductID(c *fiber.Ctx) (uint, *problem.Error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id < 1 {
+		return 0, problem.BadRequest("Invalid ID")
+	}
+
+	if err := h.products.Exists(c.Context(), uint(id)); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return 0, problem.NotFound("Product not found")
+		}
+		return 0, problem.Internal("Failed to retrieve the product", err)
+	}
+
+	return uint(id), nil
+}
+
+// checkTranslationLanguage rejects languages searches do not run in and the
+// default language, which is the product's own name and description.
+func (h *ProductController) checkTranslationLanguage(language string) *problem.Error {
+	if language == models.DefaultLanguage {
+		return problem.BadRequest("The default language is the product's own name and description")
+	}
+	if !h.search.SupportsLanguage(language) {
+		return problem.BadRequest("Language " + strconv.Quote(language) + " is not supported")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+)
+
+// maxReportWindow bounds the window of the search reports
+const maxReportWindow = 90 * 24 * time.Hour
+
+// GetSearchReport godoc
+// @Summary Report on what users search for
+// @Description Reports on the queries of a time window from the hourly search stats: top ranks queries by searches, zero-results by searches that found nothing, low-ctr by the share of searches with a click among queries that found something, and trending by the growth of searches over the window before.
+// @Tags Admin
+// @Produce json
+// @Param report path string true "Report: top, zero-results, low-ctr or trending"
+// @Param since query string false "Window ending now, e.g. 24h (default is 168h, at most 2160h)"
+// @Param kind query string false "Only searches of this kind: products, marketplace_products, reports or unified"
+// @Param min_searches query integer false "Least searches of a query in the low-ctr and trending reports (default is 10 and 5)"
+// @Param limit query integer false "Number of queries (default is 50, at most 500)"
+// @Success 200 {array} models.QueryReport
+// @Failure 400 {object} problem.Document "Invalid report or parameter"
+// @Failure 500 {object} problem.Document "Failed to compute the report"
+// @Router /api/v1/admin/search-analytics/{report} [get]
+func (h *AdminController) GetSearchReport(c *fiber.Ctx) error {
+	report := c.Params("report")
+	known := false
+	for _, name := range models.SearchReportNames {
+		known = known || name == report
+	}
+	if !known {
+		return problem.BadRequest(fmt.Sprintf("unknown report %q", report))
+	}
+
+	window, err := time.ParseDuration(c.Query("since", "168h"))
+	if err != nil || window <= 0 || window > maxReportWindow {
+		return problem.BadRequest("since must be a duration of at most 2160h")
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	minSearches := 10
+	if report == models.SearchReportTrending {
+		minSearches = 5
+	}
+	if value, err := strconv.Atoi(c.Query("min_searches")); err == nil && value > 0 {
+		minSearches = value
+	}
+
+	until := time.Now()
+	rows, err := h.admin.SearchReport(c.Context(), report, models.SearchReportOptions{
+		Since:       until.Add(-window),
+		Until:       until,
+		Kind:        c.Query("kind"),
+		MinSearches: int64(minSearches),
+		Limit:       limit,
+	})
+	if err != nil {
+		return problem.Internal("Failed to compute the report", err)
+	}
+
+	return c.JSON(rows)
+}
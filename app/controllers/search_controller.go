@@ -2,212 +2,458 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 
 	"github.com/r3tr056/ecolens_api/app/models"
-	"github.com/r3tr056/ecolens_api/platform/db"
-	"github.com/r3tr056/ecolens_api/platform/pubsub"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/middleware"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
 )
 
-var SearchTaskRPC *pubsub.PubsubClient
+// SearchController serves the search endpoints
+type SearchController struct {
+	search    services.Search
+	media     services.Media
+	messaging services.Messaging
+}
 
-func StartSearchTaskRPC() {
-	var err error
-	SearchTaskRPC, err = pubsub.NewPubSubClient(
-		os.Getenv("GOOGLE_PROJECT_ID"),
-		os.Getenv("SEARCH_TOPIC_NAME"),
-		os.Getenv("SEARCH_SUB_NAME"),
-	)
-	if err != nil {
-		log.Fatalf("Error starting Pub/Sub Client for Search: %v", err)
-	}
+// NewSearchController returns the search endpoints. Searched images are
+// stored in media and matched by the ML workers reached through messaging.
+func NewSearchController(search services.Search, media services.Media, messaging services.Messaging) *SearchController {
+	return &SearchController{search: search, media: media, messaging: messaging}
 }
 
-// @Summary Perform full-text search on product names
-// @Description Returns matching product names based on the provided search term
+// @Summary Autocomplete search box input
+// @Description Completes the typed term with the user's recent searches of type "recent", followed by product, brand and category names ranked by match quality and popularity. Misspelt input is matched by trigram similarity. Highlights are the rune ranges of the names that match the typed words.
 // @ID matchTS
-// @Accept json
 // @Produce json
-// @Param term query string true "Search term for full-text search"
+// @Param term query string true "Typed search box input, at least 2 characters"
+// @Param limit query integer false "Number of suggestions (default is 10, at most 20)"
 // @Success 200 {array} models.MatchResult
-// @Failure 400 {object} ErrorResponse "Bad Request"
-// @Failure 404 {object} ErrorResponse "Not Found"
-// @Router /matchTS [get]
-func MatchTS(c *fiber.Ctx) error {
-	term := c.Query("term")
-
-	if len(term) > 1 {
-		var products []models.Product
-		db.PostgresDB.Table("products").Where("ts @@ plainto_tsquery('simple', ?)", fmt.Sprintf("%s:*", term)).Select("name").Limit(10).Find(&products)
-		if len(products) > 0 {
-			result := make([]models.MatchResult, len(products))
-			for i, product := range products {
-				result[i] = models.MatchResult{
-					Rank:    i,
-					Content: product.Name,
-				}
+// @Failure 400 {object} problem.Document "Bad Request"
+// @Failure 500 {object} problem.Document "Internal server error"
+// @Router /api/v1/autocomplete [get]
+func (h *SearchController) MatchTS(c *fiber.Ctx) error {
+	term := c.Query("term", c.FormValue("term"))
+	if len([]rune(strings.TrimSpace(term))) < 2 || len(term) > query.MaxQueryLength {
+		return problem.BadRequest("term must be between 2 and 256 characters")
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 || limit > 20 {
+		limit = 10
+	}
+
+	// recent searches come first for signed-in users
+	userID, _ := middleware.CurrentUserID(c)
+	result, err := h.search.Suggest(c.Context(), term, userID, limit)
+	if err != nil {
+		return problem.Internal("Failed to complete the search term", err)
+	}
+
+	return c.JSON(result)
+}
+
+// Deadlines of the unified search
+const (
+	defaultSearchTimeout = 800 * time.Millisecond
+	maxSearchTimeout     = 5 * time.Second
+)
+
+// @Summary Search everything
+// @Description Searches products, marketplace products, reports, brands and categories at once. Scores are text ranks normalized against the best hit of every type, so results of different types compare. Results are merged by score, or grouped by type with group=true. Types that do not answer before the deadline are left out, the response is then marked partial with a warning per type. Types that do not support a field of the search term, e.g. reports for brand:, are skipped.
+// @Tags Search
+// @Produce json
+// @Param q query string true "Search term, supporting \"phrases\", -exclusions, OR and the brand:, category: and tag: fields"
+// @Param types query string false "Comma separated types to search: product, marketplace_product, report, brand, category (default is all)"
+// @Param limit query integer false "Hits per type (default is 5, at most 20)"
+// @Param group query boolean false "Group the results by type instead of merging them"
+// @Param timeout query integer false "Deadline in milliseconds (default is 800, at most 5000)"
+// @Success 200 {object} models.UnifiedSearchPage
+// @Failure 400 {object} problem.Document "Invalid request or a search term that could not be parsed"
+// @Failure 500 {object} problem.Document "Every type failed"
+// @Failure 504 {object} problem.Document "No type answered before the deadline"
+// @Router /api/v1/search [get]
+func (h *SearchController) PerformSearch(c *fiber.Ctx) error {
+	started := time.Now()
+
+	q, err := query.Parse(c.Query("q"), models.UnifiedQuery)
+	if err != nil {
+		return searchQueryError(c, err)
+	}
+	q.Language = h.searchLanguage(c, q.Raw)
+
+	types := models.SearchTypes
+	if requested := c.Query("types"); requested != "" {
+		wanted := map[string]bool{}
+		for _, kind := range strings.Split(requested, ",") {
+			wanted[strings.TrimSpace(kind)] = true
+		}
+
+		types = []string{}
+		for _, kind := range models.SearchTypes {
+			if wanted[kind] {
+				types = append(types, kind)
+				delete(wanted, kind)
 			}
-			return c.JSON(result)
-		} else {
-			return c.SendStatus(fiber.StatusNotFound)
 		}
+		for kind := range wanted {
+			return problem.BadRequest(fmt.Sprintf("unknown search type %q", kind))
+		}
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "5"))
+	if err != nil || limit < 1 || limit > 20 {
+		limit = 5
+	}
+
+	timeout := defaultSearchTimeout
+	if ms, err := strconv.Atoi(c.Query("timeout")); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+		if timeout > maxSearchTimeout {
+			timeout = maxSearchTimeout
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := h.search.Unified(ctx, q, types, limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &problem.Error{Status: fiber.StatusGatewayTimeout, Code: problem.CodeTimeout, Detail: "No search type answered in time", Err: err}
+		}
+		return problem.Internal("Failed to perform search", err)
+	}
+
+	page := models.UnifiedSearchPage{
+		SearchID: uuid.NewString(),
+		Query:    q.String(),
+		Totals:   result.Totals(),
+		Partial:  result.Partial,
+		Warnings: result.Warnings,
+	}
+	if c.QueryBool("group") {
+		page.Groups = result.Groups
 	} else {
-		return c.SendStatus(fiber.StatusBadRequest)
+		page.Results = result.Interleave()
 	}
+
+	var total int64
+	for _, count := range page.Totals {
+		total += count
+	}
+	typesJSON, _ := json.Marshal(fiber.Map{"types": types})
+	h.recordSearch(c, started, q, models.SearchHistory{
+		SearchID:    page.SearchID,
+		Kind:        models.SearchKindUnified,
+		Query:       q.Raw,
+		Filters:     typesJSON,
+		ResultCount: total,
+	})
+
+	return c.JSON(page)
 }
 
 // @Summary Perform a product search
-// @Description Perform a search for products based on the specified search term
+// @Description Searches products with typed filters and sort keys, and returns facet counts for categories, brands, tags, eco grades and prices. Each facet counts the matches without its own filter applied. The ranked results are kept in a search session, later pages are requested with the next_cursor and prev_cursor of a page. Synonyms of the search terms also match, and a term that finds nothing is answered with its spelling correction when that finds results, as reported in the spelling field. Results whose text is close in meaning to the search term are ranked in as well, even without a matching word.
 // @Tags Products
 // @Accept json
 // @Produce json
-// @Param searchTerm query string true "Search term for products"
-// @Param page query integer false "Page number (default is 1)"
-// @Param pageSize query integer false "Page size (default is 10)"
-// @Success 201 {object} models.SearchResultPage "Successful response with search results"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/products/search [get]
-func PerformProductSearch(c *fiber.Ctx) error {
+// @Param search body models.ProductSearchRequest true "Search term, supporting \"phrases\", -exclusions, OR and the brand:, category: and tag: fields, with filters, sort keys and page size, or the cursor of a page"
+// @Success 201 {object} models.ProductSearchPage "First page of a new search session"
+// @Success 200 {object} models.ProductSearchPage "Page of an existing search session"
+// @Failure 400 {object} problem.Document "Invalid request or a search term that could not be parsed"
+// @Failure 410 {object} problem.Document "The search session of the cursor expired"
+// @Failure 500 {object} problem.Document "Internal server error"
+// @Router /api/v1/product/search [post]
+func (h *SearchController) PerformProductSearch(c *fiber.Ctx) error {
 	ctx := context.Background()
+	started := time.Now()
 
-	searchTerm := c.FormValue("searchTerm")
-	page, err := strconv.Atoi(c.FormValue("page", "1"))
-	if err != nil {
-		page = 1
+	request := &models.ProductSearchRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return problem.InvalidBody(err)
 	}
 
-	pageSize, err := strconv.Atoi(c.FormValue("pageSize", "10"))
+	if request.Cursor != "" {
+		session, cursor, ferr := h.resumeSearch(ctx, request.Cursor, models.SearchKindProducts)
+		if ferr != nil {
+			return ferr
+		}
+		return h.productSearchPage(ctx, c, fiber.StatusOK, session, cursor.Offset, cursor.Size)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(request); err != nil {
+		return problem.Validation(err)
+	}
+
+	if request.MinPrice != nil && request.MaxPrice != nil && *request.MinPrice > *request.MaxPrice {
+		return problem.BadRequest("min_price must not be greater than max_price")
+	}
+
+	if request.PageSize == 0 {
+		request.PageSize = 10
+	}
+
+	language := h.searchLanguage(c, request.SearchTerm)
+	var q *query.Query
+	if strings.TrimSpace(request.SearchTerm) != "" {
+		var err error
+		if q, err = query.Parse(request.SearchTerm, models.ProductQuery); err != nil {
+			return searchQueryError(c, err)
+		}
+		q.Language = language
+	}
+
+	session, err := h.search.Products(ctx, request, q, language)
 	if err != nil {
-		pageSize = 10
+		return searchError(c, err, "Failed to perform product search")
 	}
 
-	products, err := models.SearchProducts(ctx, db.RedisClient, db.PostgresDB, searchTerm, page, pageSize)
+	// the page size, spelling flag and search term are not filters
+	filters := *request
+	filters.PageSize, filters.Exact = 0, false
+	filters.SearchTerm = ""
+	filtersJSON, _ := json.Marshal(filters)
+	h.recordSearch(c, started, q, models.SearchHistory{
+		SearchID:    session.ID,
+		Kind:        models.SearchKindProducts,
+		Query:       request.SearchTerm,
+		Filters:     filtersJSON,
+		ResultCount: session.Total,
+	})
+
+	return h.productSearchPage(ctx, c, fiber.StatusCreated, session, 0, request.PageSize)
+}
+
+func (h *SearchController) productSearchPage(ctx context.Context, c *fiber.Ctx, status int, session *models.SearchSession, offset, size int) error {
+	products, err := h.search.ProductPage(ctx, session, offset, size)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to perform product search",
-		})
+		return problem.Internal("Failed to load the search results", err)
 	}
 
-	var productResults []models.SearchResult
+	productResults := []models.SearchResult{}
 	for i, result := range products {
-		productResults = append(productResults, models.CreateSearchResult(i, result.Name, result.Description))
+		productResult := models.CreateSearchResult(offset+i, result.Name, result.Description)
+		productResult.ResultID = int(result.ID)
+		productResults = append(productResults, productResult)
 	}
 
-	pageID := models.GenerateRandomPageID()
-	searchResultPage := models.SearchResultPage{
-		PageID:  pageID,
-		Index:   page,
-		Length:  pageSize,
-		Results: productResults,
+	searchResultPage := models.ProductSearchPage{
+		SearchResultPage: session.ResultPage(offset, size, productResults),
+		Products:         products,
+	}
+	if session.Facets != nil {
+		searchResultPage.Facets = *session.Facets
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(searchResultPage)
+	return c.Status(status).JSON(searchResultPage)
 }
 
 // @Summary Perform a marketplace product search
-// @Description Perform a search for marketplace products based on the specified search term
+// @Description Perform a search for marketplace products based on the specified search term. The ranked results are kept in a search session, later pages are requested with the next_cursor and prev_cursor of a page. Synonyms of the search terms also match, and a term that finds nothing is answered with its spelling correction when that finds results, as reported in the spelling field.
 // @Tags MarketplaceProducts
 // @Accept json
 // @Produce json
-// @Param searchTerm query string true "Search term for marketplace products"
-// @Param page query integer false "Page number (default is 1)"
+// @Param searchTerm query string false "Search term for marketplace products, supports \"phrases\", -exclusions, OR and the brand: and category: fields"
 // @Param pageSize query integer false "Page size (default is 10)"
-// @Success 201 {object} models.SearchResultPage "Successful response with search results"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/marketplace/products/search [get]
-func PerformMarketplaceProductSearch(c *fiber.Ctx) error {
+// @Param exact query boolean false "Search exactly the given term, without spelling correction"
+// @Param cursor query string false "Cursor of a page of an earlier search"
+// @Success 201 {object} models.SearchResultPage "First page of a new search session"
+// @Success 200 {object} models.SearchResultPage "Page of an existing search session"
+// @Failure 400 {object} problem.Document "The search term could not be parsed"
+// @Failure 410 {object} problem.Document "The search session of the cursor expired"
+// @Failure 500 {object} problem.Document "Internal server error"
+// @Router /api/v1/mkplcproduct/search [post]
+func (h *SearchController) PerformMarketplaceProductSearch(c *fiber.Ctx) error {
 	ctx := context.Background()
+	started := time.Now()
 
-	searchTerm := c.FormValue("searchTerm")
-	page, err := strconv.Atoi(c.FormValue("page", "1"))
-	if err != nil {
-		page = 1
+	if encoded := c.Query("cursor"); encoded != "" {
+		session, cursor, ferr := h.resumeSearch(ctx, encoded, models.SearchKindMarketplaceProducts)
+		if ferr != nil {
+			return ferr
+		}
+		return h.marketplaceSearchPage(ctx, c, fiber.StatusOK, session, cursor.Offset, cursor.Size)
 	}
 
+	searchTerm := c.FormValue("searchTerm")
 	pageSize, err := strconv.Atoi(c.FormValue("pageSize", "10"))
-	if err != nil {
+	if err != nil || pageSize < 1 || pageSize > 100 {
 		pageSize = 10
 	}
 
-	marketProducts, err := models.SearchMarketplaceProducts(ctx, db.RedisClient, db.PostgresDB, searchTerm, page, pageSize)
+	q, err := query.Parse(searchTerm, models.MarketplaceProductQuery)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to perform product search",
-		})
+		return searchQueryError(c, err)
 	}
 
-	var productResults []models.SearchResult
-	for i, result := range marketProducts {
-		productResults = append(productResults, models.CreateSearchResult(i, result.Name, result.Description))
+	session, err := h.search.MarketplaceProducts(ctx, searchTerm, q, c.FormValue("exact") == "true")
+	if err != nil {
+		return searchError(c, err, "Failed to perform product search")
+	}
+
+	h.recordSearch(c, started, q, models.SearchHistory{
+		SearchID:    session.ID,
+		Kind:        models.SearchKindMarketplaceProducts,
+		Query:       searchTerm,
+		ResultCount: session.Total,
+	})
+
+	return h.marketplaceSearchPage(ctx, c, fiber.StatusCreated, session, 0, pageSize)
+}
+
+func (h *SearchController) marketplaceSearchPage(ctx context.Context, c *fiber.Ctx, status int, session *models.SearchSession, offset, size int) error {
+	marketProducts, err := h.search.MarketplaceProductPage(ctx, session, offset, size)
+	if err != nil {
+		return problem.Internal("Failed to load the search results", err)
 	}
 
-	pageID := models.GenerateRandomPageID()
-	searchResultPage := models.SearchResultPage{
-		PageID:  pageID,
-		Index:   page,
-		Length:  pageSize,
-		Results: productResults,
+	productResults := []models.SearchResult{}
+	for i, result := range marketProducts {
+		productResult := models.CreateSearchResult(offset+i, result.Name, result.Description)
+		productResult.ResultID = int(result.ID)
+		productResults = append(productResults, productResult)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(searchResultPage)
+	return c.Status(status).JSON(session.ResultPage(offset, size, productResults))
 }
 
 // @Summary Perform a report search
-// @Description Perform a search for reports based on the specified search term
+// @Description Perform a search for reports based on the specified search term. The ranked results are kept in a search session, later pages are requested with the next_cursor and prev_cursor of a page. Synonyms of the search terms also match, and a term that finds nothing is answered with its spelling correction when that finds results, as reported in the spelling field. Results whose text is close in meaning to the search term are ranked in as well, even without a matching word.
 // @Tags Reports
 // @Accept json
 // @Produce json
-// @Param searchTerm query string true "Search term for reports"
-// @Param page query integer false "Page number (default is 1)"
+// @Param searchTerm query string false "Search term for reports, supports \"phrases\", -exclusions and OR"
 // @Param pageSize query integer false "Page size (default is 10)"
-// @Success 201 {object} models.SearchResultPage "Successful response with search results"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/reports/search [get]
-func PerformReportSearch(c *fiber.Ctx) error {
+// @Param exact query boolean false "Search exactly the given term, without spelling correction or semantic matches"
+// @Param cursor query string false "Cursor of a page of an earlier search"
+// @Success 201 {object} models.SearchResultPage "First page of a new search session"
+// @Success 200 {object} models.SearchResultPage "Page of an existing search session"
+// @Failure 400 {object} problem.Document "The search term could not be parsed"
+// @Failure 410 {object} problem.Document "The search session of the cursor expired"
+// @Failure 500 {object} problem.Document "Internal server error"
+// @Router /api/v1/report/search [post]
+func (h *SearchController) PerformReportSearch(c *fiber.Ctx) error {
 	ctx := context.Background()
+	started := time.Now()
+
+	if encoded := c.Query("cursor"); encoded != "" {
+		session, cursor, ferr := h.resumeSearch(ctx, encoded, models.SearchKindReports)
+		if ferr != nil {
+			return ferr
+		}
+		return h.reportSearchPage(ctx, c, fiber.StatusOK, session, cursor.Offset, cursor.Size)
+	}
 
 	searchTerm := c.FormValue("searchTerm")
-	page, err := strconv.Atoi(c.FormValue("page", "1"))
+	pageSize, err := strconv.Atoi(c.FormValue("pageSize", "10"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	q, err := query.Parse(searchTerm, models.ReportQuery)
 	if err != nil {
-		page = 1
+		return searchQueryError(c, err)
 	}
 
-	pageSize, err := strconv.Atoi(c.FormValue("pageSize", "10"))
+	session, err := h.search.Reports(ctx, searchTerm, q, c.FormValue("exact") == "true")
 	if err != nil {
-		pageSize = 10
+		return searchError(c, err, "Failed to perform report search")
 	}
 
-	reports, err := models.SearchReports(ctx, db.RedisClient, db.PostgresDB, searchTerm, page, pageSize)
+	h.recordSearch(c, started, q, models.SearchHistory{
+		SearchID:    session.ID,
+		Kind:        models.SearchKindReports,
+		Query:       searchTerm,
+		ResultCount: session.Total,
+	})
+
+	return h.reportSearchPage(ctx, c, fiber.StatusCreated, session, 0, pageSize)
+}
+
+func (h *SearchController) reportSearchPage(ctx context.Context, c *fiber.Ctx, status int, session *models.SearchSession, offset, size int) error {
+	reports, err := h.search.ReportPage(ctx, session, offset, size)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to perform product search",
-		})
+		return problem.Internal("Failed to load the search results", err)
 	}
 
-	var productResults []models.SearchResult
+	reportResults := []models.SearchResult{}
 	for i, result := range reports {
-		productResults = append(productResults, models.CreateSearchResult(i, result.Name, result.Summary))
+		reportResult := models.CreateSearchResult(offset+i, result.Name, result.Summary)
+		reportResult.ResultID = int(result.ID)
+		reportResults = append(reportResults, reportResult)
 	}
 
-	pageID := models.GenerateRandomPageID()
-	searchResultPage := models.SearchResultPage{
-		PageID:  pageID,
-		Index:   page,
-		Length:  pageSize,
-		Results: productResults,
+	return c.Status(status).JSON(session.ResultPage(offset, size, reportResults))
+}
+
+// searchLanguage returns the language of a search for term, see
+// services.Search.Language.
+func (h *SearchController) searchLanguage(c *fiber.Ctx, term string) string {
+	return h.search.Language(term, c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// recordSearch records a new search for the analytics and the history of
+// the signed-in user.
+func (h *SearchController) recordSearch(c *fiber.Ctx, started time.Time, q *query.Query, entry models.SearchHistory) {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		userID = 0
+	}
+	h.search.Record(userID, started, q, entry)
+}
+
+// resumeSearch loads the search session a cursor points at and checks it
+// holds results of the searched kind.
+func (h *SearchController) resumeSearch(ctx context.Context, encoded string, kind string) (*models.SearchSession, *models.SearchCursor, *problem.Error) {
+	session, cursor, err := h.search.Resume(ctx, encoded, kind)
+	switch {
+	case err == nil:
+		return session, cursor, nil
+	case errors.Is(err, models.ErrInvalidCursor), errors.Is(err, services.ErrCursorMismatch):
+		return nil, nil, problem.BadRequest(err.Error())
+	case errors.Is(err, models.ErrSearchSessionExpired):
+		return nil, nil, problem.Gone(err.Error()).WithCode(problem.CodeSearchExpired)
+	}
+	return nil, nil, problem.Internal("Failed to load the search session", err)
+}
+
+// searchError answers a failed search, with a 400 pointing at the problem
+// when its term could not be parsed.
+func searchError(c *fiber.Ctx, err error, message string) error {
+	var perr *query.ParseError
+	if errors.As(err, &perr) {
+		return searchQueryError(c, err)
+	}
+	return problem.Internal(message, err)
+}
+
+// searchQueryError answers a search whose term could not be parsed with a
+// 400 pointing at the problem.
+func searchQueryError(c *fiber.Ctx, err error) error {
+	var perr *query.ParseError
+	if !errors.As(err, &perr) {
+		return problem.Internal("Failed to perform search", err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(searchResultPage)
+	return problem.BadRequest(perr.Message).WithCode(problem.CodeInvalidQuery).
+		With("query", perr.Query).
+		With("position", perr.Position)
 }
 
 // @Summary Perform an image search
@@ -218,69 +464,44 @@ func PerformReportSearch(c *fiber.Ctx) error {
 // @Param userMeta body models.UserMeta true "User metadata including UserID"
 // @Param image formData file true "Image file to be searched"
 // @Success 201 {object} fiber.Map "Successful response with image search result"
-// @Failure 400 {object} ErrorResponse "Bad request, failed to parse JSON data or open image file"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} problem.Document "Bad request, failed to parse JSON data or open image file"
+// @Failure 500 {object} problem.Document "Internal server error"
 // @Router /api/images/search [post]
-func PerformImageSearch(c *fiber.Ctx) error {
+func (h *SearchController) PerformImageSearch(c *fiber.Ctx) error {
 	// get the user id
 	userMeta := new(models.UserMeta)
 	if err := c.BodyParser(userMeta); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to parse JSON data",
-		})
+		return problem.BadRequest("Failed to parse JSON data")
 	}
 
 	file, err := c.FormFile("image")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": fmt.Sprintf("Failed to open the image file: %v", err),
-		})
+		return &problem.Error{Status: fiber.StatusBadRequest, Code: problem.CodeBadRequest, Detail: "The image file is missing", Err: err}
 	}
 
 	imageFile, err := file.Open()
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": fmt.Sprintf("Failed to open the image file: %v", err),
-		})
+		return &problem.Error{Status: fiber.StatusBadRequest, Code: problem.CodeBadRequest, Detail: "Failed to open the image file", Err: err}
 	}
 	defer imageFile.Close()
 
 	imageBytes, err := io.ReadAll(imageFile)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to read the image file",
-		})
+		return problem.Internal("Failed to read the image file", err)
 	}
 
-	imageURL, err := models.UploadImageToCloudStorage(db.PostgresDB, uint(userMeta.UserID), "application/jpeg", "", false, imageBytes)
+	imageURL, err := h.media.UploadImage(c.Context(), uint(userMeta.UserID), "application/jpeg", imageBytes)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to upload image",
-		})
+		return problem.Internal("Failed to upload image", err)
 	}
 
-	args := map[string]interface{}{
-		"image_reference": imageURL,
+	args := &contracts.ImageSearchArgs{
+		ImageReference: imageURL,
+		UserID:         userMeta.UserID,
 	}
-	messageID, err := SearchTaskRPC.PublishMessage("image-search", args)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": fmt.Sprintf("Failed to call RPC method : %v", err),
-		})
-	}
-
-	result, err := SearchTaskRPC.WaitForResponse(messageID, 1*time.Second, true)
+	result, err := h.messaging.Call(c.Context(), contracts.MethodImageSearch, args, 1*time.Second)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": fmt.Sprintf("Failed to fetch result from RPC method : %v", err),
-		})
+		return problem.Internal("Failed to search by image", err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"result": result})
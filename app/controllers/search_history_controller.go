@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/middleware"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+// SearchHistoryController serves the search history of the signed-in user
+type SearchHistoryController struct {
+	history services.SearchHistory
+	search  services.Search
+}
+
+// NewSearchHistoryController returns the search history endpoints of
+// history, clicks are recorded by search.
+func NewSearchHistoryController(history services.SearchHistory, search services.Search) *SearchHistoryController {
+	return &SearchHistoryController{history: history, search: search}
+}
+
+// GetSearchHistory godoc
+// @Summary List the signed-in user's searches
+// @Description Lists the searches of the signed-in user, newest first, and whether recording them is paused.
+// @Tags Search History
+// @Produce json
+// @Param page query integer false "Page number for pagination (default is 1)"
+// @Param limit query integer false "Number of searches per page (default is 20, at most 100)"
+// @Success 200 {object} fiber.Map "The page of searches, their total and the paused flag"
+// @Failure 500 {object} problem.Document "Failed to retrieve the search history"
+// @Router /api/v1/me/search-history [get]
+func (h *SearchHistoryController) GetSearchHistory(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	searches, total, err := h.history.List(c.Context(), userID, page, limit)
+	if err != nil {
+		return problem.Internal("Failed to retrieve the search history", err)
+	}
+
+	paused, err := h.history.Paused(c.Context(), userID)
+	if err != nil {
+		return problem.Internal("Failed to retrieve the search history settings", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"paused":   paused,
+		"searches": searches,
+	})
+}
+
+// DeleteSearchHistory godoc
+// @Summary Clear the signed-in user's searches
+// @Description Deletes every search of the signed-in user, or only the one given by id.
+// @Tags Search History
+// @Param id query integer false "Only delete this search"
+// @Success 200 "Search history deleted"
+// @Failure 400 {object} problem.Document "Invalid ID"
+// @Failure 500 {object} problem.Document "Failed to delete the search history"
+// @Router /api/v1/me/search-history [delete]
+func (h *SearchHistoryController) DeleteSearchHistory(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	// deleted for good, the user asked for it to be gone
+	var id uint
+	if raw := c.Query("id"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil || parsed == 0 {
+			return problem.BadRequest("Invalid ID")
+		}
+		id = uint(parsed)
+	}
+
+	if err := h.history.Delete(c.Context(), userID, id); err != nil {
+		return problem.Internal("Failed to delete the search history", err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// UpdateSearchHistorySettings godoc
+// @Summary Pause or resume the signed-in user's search history
+// @Description While paused the user's searches are not recorded. Searches recorded before are kept until deleted.
+// @Tags Search History
+// @Accept json
+// @Produce json
+// @Param settings body models.SearchHistorySettingsUpdate true "Whether to pause the search history"
+// @Success 200 {object} models.SearchHistorySettings "The updated settings"
+// @Failure 400 {object} problem.Document "Invalid request"
+// @Failure 500 {object} problem.Document "Failed to update the settings"
+// @Router /api/v1/me/search-history/settings [put]
+func (h *SearchHistoryController) UpdateSearchHistorySettings(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	request := &models.SearchHistorySettingsUpdate{}
+	if err := c.BodyParser(request); err != nil {
+		return problem.InvalidBody(err)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(request); err != nil {
+		return problem.Validation(err)
+	}
+
+	settings, err := h.history.Pause(c.Context(), userID, *request.Paused)
+	if err != nil {
+		return problem.Internal("Failed to update the settings", err)
+	}
+
+	return c.JSON(settings)
+}
+
+// RecordSearchClick godoc
+// @Summary Record the search result the user opened
+// @Description Notes which result of one of the signed-in user's searches they opened, for their history and the search analytics. The search is identified by the page_id of its pages, or the search_id of a unified search, the result by its type, ID and 0-based rank.
+// @Tags Search History
+// @Accept json
+// @Param click body models.SearchClick true "The search and the opened result"
+// @Success 204 "Click recorded"
+// @Failure 400 {object} problem.Document "Invalid request"
+// @Router /api/v1/me/search-history/clicks [post]
+func (h *SearchHistoryController) RecordSearchClick(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	click := &models.SearchClick{}
+	if err := c.BodyParser(click); err != nil {
+		return problem.InvalidBody(err)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(click); err != nil {
+		return problem.Validation(err)
+	}
+
+	if err := h.search.RecordClick(c.Context(), userID, click); err != nil {
+		return problem.Internal("Failed to record the click", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+// GetSynonyms godoc
+// @Summary List search synonym groups
+// @Description Lists the groups of terms searches treat as equivalent.
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} models.SynonymGroup "The synonym groups"
+// @Failure 500 {object} problem.Document "Failed to retrieve synonyms"
+// @Router /api/v1/admin/synonyms [get]
+func (h *AdminController) GetSynonyms(c *fiber.Ctx) error {
+	groups, err := h.admin.Synonyms(c.Context())
+	if err != nil {
+		return problem.Internal("Failed to retrieve synonyms", err)
+	}
+
+	return c.JSON(groups)
+}
+
+// CreateSynonyms godoc
+// @Summary Add a search synonym group
+// @Description Adds a group of terms searches treat as equivalent, e.g. "eco-friendly" and "sustainable". Terms may be phrases.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param synonyms body models.CreateSynonymGroup true "The equivalent terms"
+// @Success 201 {object} models.SynonymGroup "Synonym group created"
+// @Failure 400 {object} problem.Document "Invalid request"
+// @Failure 500 {object} problem.Document "Failed to create the synonym group"
+// @Router /api/v1/admin/synonyms [post]
+func (h *AdminController) CreateSynonyms(c *fiber.Ctx) error {
+	request, ferr := parseSynonymGroup(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	group := &models.SynonymGroup{Terms: request.Terms}
+	if err := h.admin.SaveSynonyms(c.Context(), group); err != nil {
+		return problem.Internal("Failed to create the synonym group", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(group)
+}
+
+// UpdateSynonyms godoc
+// @Summary Replace the terms of a search synonym group
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path integer true "Synonym group ID"
+// @Param synonyms body models.CreateSynonymGroup true "The equivalent terms"
+// @Success 200 {object} models.SynonymGroup "Synonym group updated"
+// @Failure 400 {object} problem.Document "Invalid request"
+// @Failure 404 {object} problem.Document "Synonym group not found"
+// @Router /api/v1/admin/synonyms/{id} [put]
+func (h *AdminController) UpdateSynonyms(c *fiber.Ctx) error {
+	group, ferr := h.findSynonymGroup(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	request, ferr := parseSynonymGroup(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	group.Terms = request.Terms
+	if err := h.admin.SaveSynonyms(c.Context(), group); err != nil {
+		return problem.Internal("Failed to update the synonym group", err)
+	}
+
+	return c.JSON(group)
+}
+
+// DeleteSynonyms godoc
+// @Summary Delete a search synonym group
+// @Tags Admin
+// @Param id path integer true "Synonym group ID"
+// @Success 200 "Synonym group deleted"
+// @Failure 404 {object} problem.Document "Synonym group not found"
+// @Router /api/v1/admin/synonyms/{id} [delete]
+func (h *AdminController) DeleteSynonyms(c *fiber.Ctx) error {
+	group, ferr := h.findSynonymGroup(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.admin.DeleteSynonyms(c.Context(), group); err != nil {
+		return problem.Internal("Failed to delete the synonym group", err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func parseSynonymGroup(c *fiber.Ctx) (*models.CreateSynonymGroup, *problem.Error) {
+	request := &models.CreateSynonymGroup{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, problem.InvalidBody(err)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(request); err != nil {
+		return nil, problem.BadRequest("terms must hold 2 to 20 terms of at most 64 characters")
+	}
+
+	return request, nil
+}
+
+func (h *AdminController) findSynonymGroup(c *fiber.Ctx) (*models.SynonymGroup, *problem.Error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 0)
+	if err != nil {
+		return nil, problem.BadRequest("Invalid ID")
+	}
+
+	group, err := h.admin.SynonymGroup(c.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, problem.NotFound("Synonym group not found")
+		}
+		return nil, problem.Internal("Failed to retrieve the synonym group", err)
+	}
+
+	return group, nil
+}
@@ -1,15 +1,27 @@
 package controllers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/r3tr056/ecolens_api/app/models"
-	"github.com/r3tr056/ecolens_api/platform/db"
-
-	"gorm.io/gorm"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
 )
 
+// UserController serves the user endpoints
+type UserController struct {
+	users services.Users
+	media services.Media
+}
+
+// NewUserController returns the user endpoints of users, their avatars
+// stored in media.
+func NewUserController(users services.Users, media services.Media) *UserController {
+	return &UserController{users: users, media: media}
+}
+
 // GetUsersHandler godoc
 // @Summary Get a list of users with pagination
 // @Description Retrieves a paginated list of users based on the specified page and limit parameters.
@@ -18,10 +30,10 @@ import (
 // @Param page query integer false "Page number for pagination (default is 1)"
 // @Param limit query integer false "Number of users to retrieve per page (default is 10)"
 // @Success 200 {array} models.User "Successful response with the list of users"
-// @Failure 400 {object} ErrorResponse "Invalid page or limit parameter"
-// @Failure 500 {object} ErrorResponse "Failed to retrieve users"
+// @Failure 400 {object} problem.Document "Invalid page or limit parameter"
+// @Failure 500 {object} problem.Document "Failed to retrieve users"
 // @Router /users [get]
-func GetUsersHandler(c *fiber.Ctx) error {
+func (h *UserController) GetUsersHandler(c *fiber.Ctx) error {
 	defaultPage := 1
 	defaultLimit := 10
 
@@ -35,15 +47,9 @@ func GetUsersHandler(c *fiber.Ctx) error {
 		limit = defaultLimit
 	}
 
-	offset := (page - 1) * limit
-	var users []models.User
-
-	result := db.PostgresDB.Offset(offset).Limit(limit).Find(&users)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to retreive users",
-		})
+	users, err := h.users.List(c.Context(), page, limit)
+	if err != nil {
+		return problem.Internal("Failed to retreive users", err)
 	}
 
 	return c.JSON(users)
@@ -51,30 +57,26 @@ func GetUsersHandler(c *fiber.Ctx) error {
 
 // GetUserHandler godoc
 // @Summary Get a user by ID
-// @Description Retrieves a user by the specified ID, including related data such as uploaded images and search history.
+// @Description Retrieves a user by the specified ID, including related data such as uploaded images and their 20 most recent searches.
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID to retrieve"
 // @Success 200 {object} models.User "Successful response with the user details"
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Failed to retrieve user"
+// @Failure 404 {object} problem.Document "User not found"
+// @Failure 500 {object} problem.Document "Failed to retrieve user"
 // @Router /users/{id} [get]
-func GetUserHandler(c *fiber.Ctx) error {
-	userID := c.Params("id")
-
-	var user models.User
-	result := db.PostgresDB.Preload("UploadedImages").Preload("SearchHIstory").First(&user, userID)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   true,
-				"message": "User  ot found",
-			})
+func (h *UserController) GetUserHandler(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return problem.NotFound("User not found")
+	}
+
+	user, err := h.users.Get(c.Context(), uint(userID))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return problem.NotFound("User not found")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to retreive user",
-		})
+		return problem.Internal("Failed to retreive user", err)
 	}
 
 	return c.JSON(user)
@@ -89,18 +91,16 @@ func GetUserHandler(c *fiber.Ctx) error {
 // @Param avatar formData file false "New avatar image for the user"
 // @Param updatedUser body models.UserUpdate true "Updated user information"
 // @Success 200 "User updated successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request or update data"
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Failed to update user"
+// @Failure 400 {object} problem.Document "Invalid request or update data"
+// @Failure 404 {object} problem.Document "User not found"
+// @Failure 409 {object} problem.Document "Email is already in use"
+// @Failure 500 {object} problem.Document "Failed to update user"
 // @Router /users/{id} [put]
-func UpdateUserHandler(c *fiber.Ctx) error {
+func (h *UserController) UpdateUserHandler(c *fiber.Ctx) error {
 	stringUserID := c.Params("id")
 	userID, err := strconv.ParseUint(stringUserID, 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to parse userID",
-		})
+		return problem.Internal("Failed to parse userID", err)
 	}
 
 	avatarImage, err := c.FormFile("avatar")
@@ -109,48 +109,32 @@ func UpdateUserHandler(c *fiber.Ctx) error {
 	if err == nil {
 		file, err := avatarImage.Open()
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   true,
-				"message": "Failed to open avatar image",
-			})
+			return problem.Internal("Failed to open avatar image", err)
 		}
 		defer file.Close()
 
-		avatarURL, err = models.UploadAvatar(uint(userID), file)
+		avatarURL, err = h.media.UploadAvatar(c.Context(), uint(userID), file)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   true,
-				"message": "Failed to upload avatar to GCS",
-			})
+			return problem.Internal("Failed to upload avatar to GCS", err)
 		}
 	}
 
 	var updatedUser models.UserUpdate
 	if err := c.BodyParser(&updatedUser); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(),
-		})
+		return problem.InvalidBody(err)
 	}
 	updatedUser.AvatarURL = avatarURL
 
-	var existingUser models.User
-	result := db.PostgresDB.Where("id = ?", userID).First(&existingUser)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   true,
-				"message": "User not found",
-			})
+	if err := h.users.Update(c.Context(), uint(userID), &updatedUser); err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotFound):
+			return problem.NotFound("User not found")
+		case errors.Is(err, services.ErrConflict):
+			return problem.Conflict("Email is already in use").WithCode(problem.CodeEmailTaken)
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to update user",
-		})
+		return problem.Internal("Failed to update user", err)
 	}
 
-	db.PostgresDB.Model(&existingUser).Updates(updatedUser)
-
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -161,30 +145,21 @@ func UpdateUserHandler(c *fiber.Ctx) error {
 // @Produce json
 // @Param id path string true "User ID to delete"
 // @Success 200 "User deleted successfully"
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Failed to delete user"
+// @Failure 404 {object} problem.Document "User not found"
+// @Failure 500 {object} problem.Document "Failed to delete user"
 // @Router /users/{id} [delete]
-func DeleteUserHandler(c *fiber.Ctx) error {
-	userID := c.Params("id")
-
-	var user models.User
-
-	result := db.PostgresDB.Where("id = ?", userID).First(&user)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   true,
-				"message": "User not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   true,
-			"message": "Failed to delete user",
-		})
+func (h *UserController) DeleteUserHandler(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return problem.NotFound("User not found")
 	}
 
-	// Delete the user
-	db.PostgresDB.Delete(user)
+	if err := h.users.Delete(c.Context(), uint(userID)); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return problem.NotFound("User not found")
+		}
+		return problem.Internal("Failed to delete user", err)
+	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
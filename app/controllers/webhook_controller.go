@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/middleware"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+	"github.com/r3tr056/ecolens_api/platform/webhook"
+)
+
+// WebhookController serves the webhook endpoints of partners
+type WebhookController struct {
+	webhooks services.Webhooks
+	// dispatcher sends the test events
+	dispatcher *webhook.Dispatcher
+	// allowHTTP accepts plain HTTP endpoints, in development only
+	allowHTTP bool
+}
+
+// NewWebhookController returns the webhook endpoints of webhooks. Plain
+// HTTP endpoints are only accepted with allowHTTP.
+func NewWebhookController(webhooks services.Webhooks, dispatcher *webhook.Dispatcher, allowHTTP bool) *WebhookController {
+	return &WebhookController{webhooks: webhooks, dispatcher: dispatcher, allowHTTP: allowHTTP}
+}
+
+// CreateWebhook godoc
+// @Summary Register a webhook endpoint
+// @Description Registers an HTTPS endpoint that receives the selected events. The signing secret is only returned in this response.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.CreateWebhook true "Endpoint URL, event filters and optional product IDs"
+// @Success 201 {object} fiber.Map "Subscription created, includes the signing secret"
+// @Failure 400 {object} problem.Document "Invalid request"
+// @Failure 500 {object} problem.Document "Failed to create the subscription"
+// @Router /api/v1/webhooks [post]
+func (h *WebhookController) CreateWebhook(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	request := &models.CreateWebhook{}
+	if err := c.BodyParser(request); err != nil {
+		return problem.InvalidBody(err)
+	}
+
+	validate := utils.NewValidator()
+	if err := validate.Struct(request); err != nil {
+		return problem.Validation(err)
+	}
+
+	endpoint, err := url.Parse(request.URL)
+	if err != nil || (endpoint.Scheme != "https" && !h.allowHTTP) {
+		return problem.BadRequest("webhook endpoints must use https")
+	}
+	if err := h.dispatcher.CheckEndpoint(c.Context(), request.URL); err != nil {
+		if errors.Is(err, webhook.ErrForbiddenAddress) {
+			return problem.BadRequest("Webhook endpoints must be on a public network")
+		}
+		return problem.BadRequest("The host of the webhook endpoint could not be resolved")
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return problem.Internal("Failed to generate the signing secret", err)
+	}
+
+	sub := &models.WebhookSubscription{
+		UserID:     userID,
+		URL:        request.URL,
+		Secret:     secret,
+		Events:     request.Events,
+		ProductIDs: request.ProductIDs,
+		Active:     true,
+	}
+	if err := h.webhooks.Create(c.Context(), sub); err != nil {
+		return problem.Internal("Failed to create the subscription", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"error":        false,
+		"subscription": sub,
+		"secret":       secret,
+	})
+}
+
+// GetWebhooks godoc
+// @Summary List webhook subscriptions
+// @Description Lists the webhook subscriptions of the signed-in partner.
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription "The partner's subscriptions"
+// @Failure 500 {object} problem.Document "Failed to retrieve subscriptions"
+// @Router /api/v1/webhooks [get]
+func (h *WebhookController) GetWebhooks(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return problem.Unauthorized(err.Error())
+	}
+
+	subs, err := h.webhooks.List(c.Context(), userID)
+	if err != nil {
+		return problem.Internal("Failed to retrieve subscriptions", err)
+	}
+
+	return c.JSON(subs)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook subscription
+// @Tags Webhooks
+// @Param id path integer true "Subscription ID"
+// @Success 200 "Subscription deleted"
+// @Failure 404 {object} problem.Document "Subscription not found"
+// @Router /api/v1/webhooks/{id} [delete]
+func (h *WebhookController) DeleteWebhook(c *fiber.Ctx) error {
+	sub, ferr := h.findWebhook(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.webhooks.Delete(c.Context(), sub); err != nil {
+		return problem.Internal("Failed to delete the subscription", err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// EnableWebhook godoc
+// @Summary Re-enable a webhook subscription
+// @Description Re-enables a subscription that was disabled after repeated delivery failures.
+// @Tags Webhooks
+// @Produce json
+// @Param id path integer true "Subscription ID"
+// @Success 200 {object} models.WebhookSubscription "Subscription enabled"
+// @Failure 404 {object} problem.Document "Subscription not found"
+// @Router /api/v1/webhooks/{id}/enable [post]
+func (h *WebhookController) EnableWebhook(c *fiber.Ctx) error {
+	sub, ferr := h.findWebhook(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.webhooks.Enable(c.Context(), sub); err != nil {
+		return problem.Internal("Failed to enable the subscription", err)
+	}
+
+	return c.JSON(sub)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary List the deliveries of a webhook subscription
+// @Description Lists the most recent deliveries of a subscription with every attempt made for them.
+// @Tags Webhooks
+// @Produce json
+// @Param id path integer true "Subscription ID"
+// @Param page query integer false "Page number for pagination (default is 1)"
+// @Param limit query integer false "Number of deliveries per page (default is 20)"
+// @Success 200 {object} fiber.Map "Deliveries and their attempts"
+// @Failure 404 {object} problem.Document "Subscription not found"
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (h *WebhookController) GetWebhookDeliveries(c *fiber.Ctx) error {
+	sub, ferr := h.findWebhook(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	deliveries, attempts, err := h.webhooks.Deliveries(c.Context(), sub.ID, page, limit)
+	if err != nil {
+		return problem.Internal("Failed to retrieve deliveries", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"attempts":   attempts,
+	})
+}
+
+// SendTestWebhook godoc
+// @Summary Send a test event
+// @Description Synchronously posts a signed webhook.test event to the endpoint and returns the request and the status the endpoint answered, so integrators can verify their signature check.
+// @Tags Webhooks
+// @Produce json
+// @Param id path integer true "Subscription ID"
+// @Success 200 {object} fiber.Map "The payload, signature and endpoint status"
+// @Failure 404 {object} problem.Document "Subscription not found"
+// @Router /api/v1/webhooks/{id}/test [post]
+func (h *WebhookController) SendTestWebhook(c *fiber.Ctx) error {
+	sub, ferr := h.findWebhook(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	data, _ := json.Marshal(fiber.Map{"subscription_id": sub.ID, "message": "This is a test event from EcoLens"})
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        uuid.NewString(),
+		Type:      models.WebhookEventTest,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return problem.Internal("Failed to build the test event", err)
+	}
+
+	result := h.dispatcher.Send(c.Context(), sub, 0, models.WebhookEventTest, payload)
+
+	return c.JSON(fiber.Map{
+		"error":     !result.OK(),
+		"delivered": result.OK(),
+		"payload":   string(payload),
+		"headers": fiber.Map{
+			webhook.HeaderEvent:     models.WebhookEventTest,
+			webhook.HeaderDelivery:  "0",
+			webhook.HeaderSignature: result.Signature,
+		},
+		"status_code": result.StatusCode,
+		"duration_ms": result.Duration.Milliseconds(),
+	})
+}
+
+// findWebhook loads the subscription in the id param if it belongs to the
+// signed-in partner.
+func (h *WebhookController) findWebhook(c *fiber.Ctx) (*models.WebhookSubscription, *problem.Error) {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return nil, problem.Unauthorized(err.Error())
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 0)
+	if err != nil {
+		return nil, problem.BadRequest("Invalid ID")
+	}
+
+	sub, err := h.webhooks.Get(c.Context(), userID, uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, problem.NotFound("Subscription not found")
+		}
+		return nil, problem.Internal("Failed to retrieve the subscription", err)
+	}
+
+	return sub, nil
+}
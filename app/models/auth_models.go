@@ -2,10 +2,17 @@ package models
 
 import "time"
 
+// User roles. Users sign up with RoleUser, the roles with access to
+// restricted endpoints are only granted with ecolensctl create-admin.
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RolePartner = "partner"
+)
+
 type SignUp struct {
 	Email    string `json:"email" validate:"required,email,lte=255"`
 	Password string `json:"password" validate:"required,lte=255"`
-	UserRole string `json:"user_role" validate:"required,lte=255"`
 }
 
 type SignIn struct {
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeadLetter is a message that could not be processed and was moved to a
+// dead-letter topic. It is kept so admins can inspect and replay it.
+type DeadLetter struct {
+	gorm.Model
+	Topic            string          `gorm:"type:varchar(255);not null;index" json:"topic"`
+	Subscription     string          `gorm:"type:varchar(255)" json:"subscription"`
+	MessageID        string          `gorm:"type:varchar(255)" json:"message_id"`
+	Data             []byte          `json:"data"`
+	Attributes       json.RawMessage `gorm:"type:jsonb" json:"attributes"`
+	DeliveryAttempts int             `json:"delivery_attempts"`
+	Reason           string          `gorm:"type:text" json:"reason"`
+	ReplayCount      int             `json:"replay_count"`
+	ReplayedAt       *time.Time      `json:"replayed_at"`
+}
+
+func RecordDeadLetter(db *gorm.DB, topic, subscription, messageID string, data []byte, attributes map[string]string, attempts int, reason string) error {
+	encodedAttrs, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&DeadLetter{
+		Topic:            topic,
+		Subscription:     subscription,
+		MessageID:        messageID,
+		Data:             data,
+		Attributes:       encodedAttrs,
+		DeliveryAttempts: attempts,
+		Reason:           reason,
+	}).Error
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entities with embeddings
+const (
+	EmbeddingProduct = "product"
+	EmbeddingReport  = "report"
+)
+
+// embeddingSources select the id and embedded text of every row of an
+// entity.
+var embeddingSources = map[string]struct {
+	table    string
+	document string
+}{
+	EmbeddingProduct: {"products", productDocument},
+	EmbeddingReport:  {"reports", reportDocument},
+}
+
+// rrfK damps the weight of the top ranks in reciprocal rank fusion, 60 is
+// the value of the original paper
+const rrfK = 60
+
+// Embedding is the vector of a product or report computed by a model. The
+// column has no fixed dimensions so models can change, the ANN index of a
+// model casts it to the model's.
+type Embedding struct {
+	EntityType string `gorm:"type:varchar(32);primaryKey"`
+	EntityID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Model      string `gorm:"type:varchar(128);primaryKey"`
+	// ContentHash is the hash of the embedded text, a changed text is
+	// embedded again
+	ContentHash string `gorm:"type:char(64);not null"`
+	Embedding   string `gorm:"type:vector;not null"`
+	UpdatedAt   time.Time
+}
+
+// EmbeddingSource is a row to embed.
+type EmbeddingSource struct {
+	ID      uint
+	Content string
+}
+
+// SemanticQuery is the embedding of a search term and the model that
+// computed it. Searches given one fuse the keyword ranking with the
+// nearest neighbours of Vector.
+type SemanticQuery struct {
+	Model  string
+	Vector []float32
+	// MinSimilarity is the cosine similarity a neighbour needs at least
+	MinSimilarity float64
+}
+
+func (s *SemanticQuery) dimensions() int {
+	return len(s.Vector)
+}
+
+// vectorLiteral formats v in the text form of pgvector, e.g. "[1,0.5]".
+func vectorLiteral(v []float32) string {
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// embeddingIndexName is the name of the ANN index of a model, derived from
+// its name so every model gets its own.
+func embeddingIndexName(model string) string {
+	return "idx_embeddings_hnsw_" + contentHash(model)[:16]
+}
+
+// EnsureEmbeddingIndex creates the HNSW index of a model, over its rows
+// only, cast to its dimensions. Nearest neighbour queries must repeat the
+// cast and the model condition for the planner to use it.
+func EnsureEmbeddingIndex(ctx context.Context, db *gorm.DB, model string, dimensions int) error {
+	return db.WithContext(ctx).Exec(fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s ON embeddings USING hnsw ((embedding::vector(%d)) vector_cosine_ops) WHERE model = %s",
+		embeddingIndexName(model), dimensions, quoteLiteral(model),
+	)).Error
+}
+
+// quoteLiteral quotes s as an SQL string literal, for the DDL statements
+// that cannot take parameters.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// StaleEmbeddingSources returns up to limit rows of an entity without an
+// embedding by model or whose text changed since.
+func StaleEmbeddingSources(ctx context.Context, db *gorm.DB, entityType, model string, limit int) ([]EmbeddingSource, error) {
+	source := embeddingSources[entityType]
+	sources := []EmbeddingSource{}
+	err := db.WithContext(ctx).Raw(`SELECT s.id, `+source.document+` AS content
+		FROM `+source.table+` s
+		LEFT JOIN embeddings e ON e.entity_type = ? AND e.entity_id = s.id AND e.model = ?
+		WHERE s.deleted_at IS NULL
+			AND (e.entity_id IS NULL OR e.content_hash <> encode(sha256(convert_to(`+source.document+`, 'UTF8')), 'hex'))
+		ORDER BY s.id
+		LIMIT ?`, entityType, model, limit).
+		Scan(&sources).
+		Error
+	return sources, err
+}
+
+// SaveEmbeddings stores the vectors of sources computed by model.
+func SaveEmbeddings(ctx context.Context, db *gorm.DB, entityType, model string, sources []EmbeddingSource, vectors [][]float32) error {
+	embeddings := make([]Embedding, len(sources))
+	for i, source := range sources {
+		embeddings[i] = Embedding{
+			EntityType:  entityType,
+			EntityID:    source.ID,
+			Model:       model,
+			ContentHash: contentHash(source.Content),
+			Embedding:   vectorLiteral(vectors[i]),
+			UpdatedAt:   time.Now(),
+		}
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_type"}, {Name: "entity_id"}, {Name: "model"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_hash", "embedding", "updated_at"}),
+	}).Create(&embeddings).Error
+}
+
+// PurgeEmbeddings deletes the embeddings of deleted rows and of models other
+// than model.
+func PurgeEmbeddings(ctx context.Context, db *gorm.DB, model string) error {
+	db = db.WithContext(ctx)
+	if err := db.Where("model <> ?", model).Delete(&Embedding{}).Error; err != nil {
+		return err
+	}
+	for entityType, source := range embeddingSources {
+		err := db.Exec(`DELETE FROM embeddings WHERE entity_type = ? AND entity_id NOT IN (
+			SELECT id FROM `+source.table+` WHERE deleted_at IS NULL)`, entityType).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nearestNeighbours returns the IDs of up to limit rows of candidates, a
+// query selecting ids of an entity, closest to the semantic query first.
+func nearestNeighbours(db *gorm.DB, entityType string, semantic *SemanticQuery, candidates *gorm.DB, limit int) ([]uint, error) {
+	distance := fmt.Sprintf("embedding::vector(%d) <=> ?::vector(%d)", semantic.dimensions(), semantic.dimensions())
+	vector := vectorLiteral(semantic.Vector)
+
+	var ids []uint
+	err := db.Raw(`SELECT entity_id FROM embeddings
+		WHERE entity_type = ? AND model = ? AND entity_id IN (?) AND 1 - (`+distance+`) >= ?
+		ORDER BY `+distance+`
+		LIMIT ?`, entityType, semantic.Model, candidates, vector, semantic.MinSimilarity, vector, limit).
+		Scan(&ids).
+		Error
+	return ids, err
+}
+
+// FuseRanks merges rankings by reciprocal rank fusion: an ID scores the sum
+// of 1 / (k + rank) over the rankings it is in.
+func FuseRanks(rankings ...[]uint) []uint {
+	scores := map[uint]float64{}
+	fused := []uint{}
+	for _, ranking := range rankings {
+		for rank, id := range ranking {
+			if _, ok := scores[id]; !ok {
+				fused = append(fused, id)
+			}
+			scores[id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool { return scores[fused[i]] > scores[fused[j]] })
+	return fused
+}
+
+// fuseSemantic fuses the keyword ranking of ranked with the nearest
+// neighbours of the semantic query among candidates. Neighbours that did
+// not match the keywords are added to the results.
+func fuseSemantic(db *gorm.DB, entityType string, semantic *SemanticQuery, candidates *gorm.DB, ranked *RankedIDs, limit int) (*RankedIDs, error) {
+	neighbours, err := nearestNeighbours(db, entityType, semantic, candidates.Select("id"), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	fused := FuseRanks(ranked.IDs, neighbours)
+	total := ranked.Total
+	if int64(len(ranked.IDs)) == ranked.Total {
+		// every keyword match is known, so is the size of the union
+		total = int64(len(fused))
+	}
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	return &RankedIDs{IDs: fused, Total: total}, nil
+}
+
+// withoutText returns q with its free text dropped but for the excluded
+// terms, keeping its field filters, to select the candidates of the
+// nearest neighbour search.
+func withoutText(q *query.Query) *query.Query {
+	out := &query.Query{Raw: q.Raw, Filters: q.Filters, Language: q.Language}
+	for _, clause := range q.Clauses {
+		if len(clause.Terms) == 1 && clause.Terms[0].Negated {
+			out.Clauses = append(out.Clauses, clause)
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Domain event types written to the outbox
+const (
+	EventProductCreated = "product.created"
+	EventProductUpdated = "product.updated"
+	EventEPDChanged     = "epd.changed"
+	EventScoreChanged   = "score.changed"
+)
+
+// Aggregate types events are recorded against
+const (
+	AggregateProduct            = "product"
+	AggregateMarketPlaceProduct = "marketplace_product"
+)
+
+// OutboxEvent is a domain event waiting to be published to the message broker.
+// Events are inserted in the same transaction as the change they describe and
+// published by the outbox relay in insertion order per aggregate.
+type OutboxEvent struct {
+	ID            uint            `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	AggregateType string          `gorm:"type:varchar(64);not null;index:idx_outbox_aggregate,priority:1" json:"aggregate_type"`
+	AggregateID   uint            `gorm:"not null;index:idx_outbox_aggregate,priority:2" json:"aggregate_id"`
+	EventType     string          `gorm:"type:varchar(64);not null" json:"event_type"`
+	DedupeKey     string          `gorm:"type:varchar(64);not null;uniqueIndex" json:"dedupe_key"`
+	Payload       json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Attempts      int             `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time       `gorm:"not null;index" json:"next_attempt_at"`
+	PublishedAt   *time.Time      `gorm:"index" json:"published_at"`
+	LastError     string          `json:"last_error"`
+}
+
+// ProductEvent is the payload of every product and EPD event.
+type ProductEvent struct {
+	ProductID   uint      `json:"product_id"`
+	ProductType string    `json:"product_type"`
+	Name        string    `json:"name"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// DedupeKey identifies the event of a version of an aggregate, its
+// updated_at. Versions are compared to the microsecond, as Postgres keeps
+// them.
+func DedupeKey(aggregateType string, aggregateID uint, eventType string, version time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%s:%d", aggregateType, aggregateID, eventType, version.UnixMicro())))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordEvent writes a domain event of the given version of an aggregate to
+// the outbox using tx, so the event is only published if the surrounding
+// transaction commits. An event already recorded for the version is skipped.
+func RecordEvent(tx *gorm.DB, aggregateType string, aggregateID uint, eventType string, version time.Time, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	now := time.Now()
+	event := OutboxEvent{
+		CreatedAt:     now,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		DedupeKey:     DedupeKey(aggregateType, aggregateID, eventType, version),
+		Payload:       data,
+		NextAttemptAt: now,
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "dedupe_key"}},
+		DoNothing: true,
+	}).Create(&event).Error
+}
+
+// RecordProductEvents records eventType for the product with the given ID and,
+// when the change carried an EPD or an eco score, epd.changed and
+// score.changed events after it. The product's UpdatedAt is the version of
+// the events.
+func RecordProductEvents(tx *gorm.DB, aggregateType string, productID uint, eventType string, product *Product) error {
+	payload := ProductEvent{
+		ProductID:   productID,
+		ProductType: aggregateType,
+		Name:        product.Name,
+		OccurredAt:  time.Now(),
+	}
+
+	if err := RecordEvent(tx, aggregateType, productID, eventType, product.UpdatedAt, payload); err != nil {
+		return err
+	}
+
+	if product.EPD.Description != "" || len(product.EPD.LCAMetrics) > 0 {
+		if err := RecordEvent(tx, aggregateType, productID, EventEPDChanged, product.UpdatedAt, payload); err != nil {
+			return err
+		}
+	}
+
+	if product.EcoScore != nil {
+		return RecordEvent(tx, aggregateType, productID, EventScoreChanged, product.UpdatedAt, payload)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupeKey(t *testing.T) {
+	version := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	key := DedupeKey(AggregateProduct, 7, EventProductUpdated, version)
+
+	if len(key) != 64 {
+		t.Errorf("len(key) = %d, want 64", len(key))
+	}
+	// Postgres keeps microseconds, the nanoseconds of a version in memory
+	// do not change its key
+	if got := DedupeKey(AggregateProduct, 7, EventProductUpdated, version.Add(999)); got != key {
+		t.Errorf("key of the same version = %s, want %s", got, key)
+	}
+
+	for name, other := range map[string]string{
+		"aggregate type": DedupeKey(AggregateMarketPlaceProduct, 7, EventProductUpdated, version),
+		"aggregate ID":   DedupeKey(AggregateProduct, 8, EventProductUpdated, version),
+		"event type":     DedupeKey(AggregateProduct, 7, EventScoreChanged, version),
+		"version":        DedupeKey(AggregateProduct, 7, EventProductUpdated, version.Add(time.Microsecond)),
+	} {
+		if other == key {
+			t.Errorf("another %s has the same key", name)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
@@ -24,9 +27,9 @@ type Category struct {
 
 type LCAMetrics struct {
 	gorm.Model
-	Name  string  `json:"name"`
+	Name  string  `json:"name" validate:"required"`
 	Value float64 `json:"value"`
-	Unit  string  `json:"unit"`
+	Unit  string  `json:"unit" validate:"required"`
 	EPDID uint    `json:"epd_id"`
 }
 
@@ -34,7 +37,7 @@ type EnvironmentalProductDeclaration struct {
 	gorm.Model
 	ProductID   uint         `json:"product_id"`
 	Description string       `json:"description"`
-	LCAMetrics  []LCAMetrics `gorm:"foreignKey:EPDID" json:"lca_metrics"`
+	LCAMetrics  []LCAMetrics `gorm:"foreignKey:EPDID" json:"lca_metrics" validate:"dive"`
 }
 
 type Report struct {
@@ -46,19 +49,67 @@ type Report struct {
 
 type Product struct {
 	gorm.Model
-	Name            string                          `gorm:"type:varchar(255);index:idx_name_gin"`
+	Name            string                          `gorm:"type:varchar(255)"`
 	BrandID         uint                            `json:"brand_id"`
 	Barcode         string                          `json:"barcode"`
 	Brand           Brand                           `json:"brand"`
 	Images          []ProductImage                  `json:"marketplace_alternatives"`
 	EPD             EnvironmentalProductDeclaration `json:"epd"`
 	Reports         []Report                        `gorm:"foreignKey:EPDID"`
-	Description     string                          `gorm:"type:text;index:idx_description_gin"`
+	Description     string                          `gorm:"type:text"`
 	Price           float64                         `json:"price"`
 	Link            string                          `json:"link"`
 	CategoryID      uint
 	Category        Category
 	EnvironmentTags []EnvironmentTag `gorm:"foreignKey:ProductID"`
+	// EcoScore is the 0-100 environmental score, higher is better
+	EcoScore *float64 `gorm:"index" json:"eco_score"`
+	EcoGrade string   `gorm:"-" json:"eco_grade,omitempty"`
+	// Translations of the name and description, Language is the language
+	// of the returned ones
+	Translations []ProductTranslation `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"translations,omitempty"`
+	Language     string               `gorm:"-" json:"language,omitempty"`
+}
+
+// EcoGrades maps the lower bound of each eco score band to its grade
+var EcoGrades = []struct {
+	Grade string
+	Min   float64
+}{
+	{"A", 80},
+	{"B", 60},
+	{"C", 40},
+	{"D", 20},
+	{"E", 0},
+}
+
+// EcoGradeFor returns the grade of an eco score.
+func EcoGradeFor(score float64) string {
+	for _, band := range EcoGrades {
+		if score >= band.Min {
+			return band.Grade
+		}
+	}
+	return EcoGrades[len(EcoGrades)-1].Grade
+}
+
+// ecoGradeSQL computes the grade of the eco_score column the same way
+// EcoGradeFor does.
+func ecoGradeSQL() string {
+	var b strings.Builder
+	b.WriteString("CASE WHEN eco_score IS NULL THEN NULL")
+	for _, band := range EcoGrades[:len(EcoGrades)-1] {
+		fmt.Fprintf(&b, " WHEN eco_score >= %g THEN '%s'", band.Min, band.Grade)
+	}
+	fmt.Fprintf(&b, " ELSE '%s' END", EcoGrades[len(EcoGrades)-1].Grade)
+	return b.String()
+}
+
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	if p.EcoScore != nil {
+		p.EcoGrade = EcoGradeFor(*p.EcoScore)
+	}
+	return nil
 }
 
 type MarketPlaceProduct struct {
@@ -75,6 +126,12 @@ type MarketPlaceProduct struct {
 	DateOfManufacture string `json:"date_of_manufacture"`
 }
 
+// TableName is the table the searches read, gorm would derive
+// market_place_products.
+func (MarketPlaceProduct) TableName() string {
+	return "marketplace_products"
+}
+
 type EnvironmentTag struct {
 	gorm.Model
 	Name      string `json:"name"`
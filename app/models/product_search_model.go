@@ -0,0 +1,286 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// Sort keys of the product search
+const (
+	SortRelevance    = "relevance"
+	SortPriceAsc     = "price_asc"
+	SortPriceDesc    = "price_desc"
+	SortEcoScoreDesc = "eco_score_desc"
+	SortEcoScoreAsc  = "eco_score_asc"
+	SortNewest       = "newest"
+	SortName         = "name"
+)
+
+var productSorts = map[string]string{
+	SortPriceAsc:     "price ASC",
+	SortPriceDesc:    "price DESC",
+	SortEcoScoreDesc: "eco_score DESC NULLS LAST",
+	SortEcoScoreAsc:  "eco_score ASC NULLS LAST",
+	SortNewest:       "created_at DESC",
+	SortName:         "name ASC",
+}
+
+// Facet sizes
+const (
+	facetLimit   = 20
+	priceBuckets = 10
+)
+
+// Facets a filter is left out of, so every facet counts the alternatives
+// to its own selection
+const (
+	facetNone       = ""
+	facetCategories = "categories"
+	facetBrands     = "brands"
+	facetTags       = "tags"
+	facetGrades     = "eco_grades"
+	facetPrices     = "prices"
+)
+
+type ProductSearchRequest struct {
+	SearchTerm  string   `json:"search_term" validate:"omitempty,max=256"`
+	CategoryIDs []uint   `json:"category_ids" validate:"omitempty,max=50"`
+	BrandIDs    []uint   `json:"brand_ids" validate:"omitempty,max=50"`
+	Tags        []string `json:"tags" validate:"omitempty,max=20,dive,required,max=64"`
+	EcoGrades   []string `json:"eco_grades" validate:"omitempty,dive,oneof=A B C D E"`
+	MinPrice    *float64 `json:"min_price" validate:"omitempty,min=0"`
+	MaxPrice    *float64 `json:"max_price" validate:"omitempty,min=0"`
+	// Sort keys are applied in order, relevance only applies with a search term
+	Sort     []string `json:"sort" validate:"omitempty,max=3,dive,oneof=relevance price_asc price_desc eco_score_desc eco_score_asc newest name"`
+	PageSize int      `json:"page_size" validate:"omitempty,min=1,max=100"`
+	// Exact skips the spelling correction and semantic matching of the
+	// search term
+	Exact bool `json:"exact"`
+	// Cursor continues an earlier search, the other fields are ignored
+	Cursor string `json:"cursor" validate:"omitempty,max=512"`
+}
+
+type FacetCount struct {
+	ID    uint   `json:"id,omitempty"`
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+type ProductFacets struct {
+	Categories []FacetCount  `json:"categories"`
+	Brands     []FacetCount  `json:"brands"`
+	Tags       []FacetCount  `json:"tags"`
+	EcoGrades  []FacetCount  `json:"eco_grades"`
+	Prices     []PriceBucket `json:"prices"`
+}
+
+type ProductSearchResult struct {
+	RankedIDs
+	Facets ProductFacets `json:"facets"`
+}
+
+type ProductSearchPage struct {
+	SearchResultPage
+	Products []Product     `json:"products"`
+	Facets   ProductFacets `json:"facets"`
+}
+
+// FilterProducts ranks the products matching the request's filters by its
+// sort keys, returning the IDs of the first limit of them, and counts the
+// facets of the matching products. q is nil when the request has no search
+// term. Given a semantic query and relevance as the first sort key, the
+// products closest in meaning are fused into the ranking, the facets only
+// count the keyword matches.
+func FilterProducts(ctx context.Context, db *gorm.DB, req *ProductSearchRequest, q *query.Query, limit int, semantic *SemanticQuery) (*ProductSearchResult, error) {
+	db = db.WithContext(ctx)
+	result := &ProductSearchResult{}
+
+	tx, err := req.scope(db, q, facetNone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Session(&gorm.Session{}).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	sorts := req.Sort
+	if len(sorts) == 0 {
+		sorts = []string{SortRelevance, SortNewest}
+	}
+
+	tx = selectRank(tx, q, productText)
+	for _, key := range sorts {
+		if key == SortRelevance {
+			if q != nil && q.HasText() {
+				tx = tx.Order("rank DESC")
+			}
+			continue
+		}
+		tx = tx.Order(productSorts[key])
+	}
+
+	if result.IDs, err = scanIDs(tx.Order("id DESC").Limit(limit)); err != nil {
+		return nil, err
+	}
+
+	if semantic != nil && q != nil && q.HasText() && sorts[0] == SortRelevance {
+		candidates, err := req.scope(db, withoutText(q), facetNone)
+		if err != nil {
+			return nil, err
+		}
+		fused, err := fuseSemantic(db, EmbeddingProduct, semantic, candidates, &result.RankedIDs, limit)
+		if err != nil {
+			return nil, err
+		}
+		result.RankedIDs = *fused
+	}
+
+	if err := req.facets(db, q, &result.Facets); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// scope returns the products matching the request, leaving out the filter
+// of the skipped facet.
+func (r *ProductSearchRequest) scope(db *gorm.DB, q *query.Query, skip string) (*gorm.DB, error) {
+	tx := db.Table("products").Where("deleted_at IS NULL")
+
+	if q != nil {
+		var err error
+		if tx, err = matchQuery(tx, q, productText, productFilters); err != nil {
+			return nil, err
+		}
+	}
+
+	if skip != facetCategories && len(r.CategoryIDs) > 0 {
+		tx = tx.Where("category_id IN ?", r.CategoryIDs)
+	}
+	if skip != facetBrands && len(r.BrandIDs) > 0 {
+		tx = tx.Where("brand_id IN ?", r.BrandIDs)
+	}
+	if skip != facetTags && len(r.Tags) > 0 {
+		tags := make([]string, len(r.Tags))
+		for i, tag := range r.Tags {
+			tags[i] = strings.ToLower(tag)
+		}
+		tx = tx.Where(productFilters["tag"], tags)
+	}
+	if skip != facetGrades && len(r.EcoGrades) > 0 {
+		tx = tx.Where(ecoGradeSQL()+" IN ?", r.EcoGrades)
+	}
+	if skip != facetPrices {
+		if r.MinPrice != nil {
+			tx = tx.Where("price >= ?", *r.MinPrice)
+		}
+		if r.MaxPrice != nil {
+			tx = tx.Where("price <= ?", *r.MaxPrice)
+		}
+	}
+
+	return tx, nil
+}
+
+func (r *ProductSearchRequest) facets(db *gorm.DB, q *query.Query, facets *ProductFacets) error {
+	sub, err := r.scope(db, q, facetCategories)
+	if err != nil {
+		return err
+	}
+	err = db.Raw(`SELECT m.category_id AS id, coalesce(c.name, '') AS value, count(*) AS count
+		FROM (?) AS m LEFT JOIN categories c ON c.id = m.category_id
+		WHERE m.category_id <> 0
+		GROUP BY m.category_id, c.name ORDER BY count DESC LIMIT ?`, sub, facetLimit).Scan(&facets.Categories).Error
+	if err != nil {
+		return err
+	}
+
+	if sub, err = r.scope(db, q, facetBrands); err != nil {
+		return err
+	}
+	err = db.Raw(`SELECT m.brand_id AS id, coalesce(b.name, '') AS value, count(*) AS count
+		FROM (?) AS m LEFT JOIN brands b ON b.id = m.brand_id
+		WHERE m.brand_id <> 0
+		GROUP BY m.brand_id, b.name ORDER BY count DESC LIMIT ?`, sub, facetLimit).Scan(&facets.Brands).Error
+	if err != nil {
+		return err
+	}
+
+	if sub, err = r.scope(db, q, facetTags); err != nil {
+		return err
+	}
+	err = db.Raw(`SELECT lower(t.name) AS value, count(DISTINCT m.id) AS count
+		FROM (?) AS m JOIN environment_tags t ON t.product_id = m.id AND t.deleted_at IS NULL
+		GROUP BY lower(t.name) ORDER BY count DESC LIMIT ?`, sub, facetLimit).Scan(&facets.Tags).Error
+	if err != nil {
+		return err
+	}
+
+	if sub, err = r.scope(db, q, facetGrades); err != nil {
+		return err
+	}
+	err = db.Raw(`SELECT g.value, count(*) AS count
+		FROM (SELECT `+ecoGradeSQL()+` AS value FROM (?) AS m) AS g
+		WHERE g.value IS NOT NULL
+		GROUP BY g.value ORDER BY g.value`, sub).Scan(&facets.EcoGrades).Error
+	if err != nil {
+		return err
+	}
+
+	if sub, err = r.scope(db, q, facetPrices); err != nil {
+		return err
+	}
+	facets.Prices, err = priceHistogram(db, sub)
+	return err
+}
+
+// priceHistogram splits the price range of the products in sub into equal
+// width buckets.
+func priceHistogram(db *gorm.DB, sub *gorm.DB) ([]PriceBucket, error) {
+	var bounds struct {
+		Lo    float64
+		Hi    float64
+		Count int64
+	}
+	err := db.Raw("SELECT coalesce(min(price), 0) AS lo, coalesce(max(price), 0) AS hi, count(price) AS count FROM (?) AS m", sub).Scan(&bounds).Error
+	if err != nil || bounds.Count == 0 {
+		return []PriceBucket{}, err
+	}
+
+	if bounds.Hi == bounds.Lo {
+		return []PriceBucket{{Min: bounds.Lo, Max: bounds.Hi, Count: bounds.Count}}, nil
+	}
+
+	width := (bounds.Hi - bounds.Lo) / priceBuckets
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	err = db.Raw(`SELECT least(floor((m.price - ?) / ?)::int, ?) AS bucket, count(*) AS count
+		FROM (?) AS m WHERE m.price IS NOT NULL GROUP BY bucket ORDER BY bucket`, bounds.Lo, width, priceBuckets-1, sub).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]PriceBucket, priceBuckets)
+	for i := range buckets {
+		buckets[i].Min = bounds.Lo + float64(i)*width
+		buckets[i].Max = bounds.Lo + float64(i+1)*width
+	}
+	buckets[priceBuckets-1].Max = bounds.Hi
+	for _, row := range rows {
+		buckets[row.Bucket].Count = row.Count
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultLanguage is the language of the untranslated product texts, see
+// package locale
+var DefaultLanguage = "en"
+
+// ProductTranslation is the name and description of a product in a language
+// other than the default one. Its search vector is generated with the text
+// search configuration of its language.
+type ProductTranslation struct {
+	ProductID   uint      `gorm:"primaryKey;autoIncrement:false" json:"product_id"`
+	Language    string    `gorm:"type:varchar(8);primaryKey" json:"language" validate:"required,max=8"`
+	Name        string    `gorm:"type:varchar(255);not null" json:"name" validate:"required,max=255"`
+	Description string    `gorm:"type:text" json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ProductTranslationRequest struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=10000"`
+}
+
+// productTranslations returns the translations in language of the products
+// with the given IDs, by product ID.
+func productTranslations(db *gorm.DB, ids []uint, language string) (map[uint]ProductTranslation, error) {
+	translations := map[uint]ProductTranslation{}
+	if len(ids) == 0 || language == "" || language == DefaultLanguage {
+		return translations, nil
+	}
+
+	var rows []ProductTranslation
+	if err := db.Where("product_id IN ? AND language = ?", ids, language).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		translations[row.ProductID] = row
+	}
+	return translations, nil
+}
+
+// LocalizeProducts replaces the name and description of products with their
+// translation in language. Products without one keep the default texts, the
+// Language of every product tells which it got.
+func LocalizeProducts(db *gorm.DB, products []Product, language string) error {
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	translations, err := productTranslations(db, ids, language)
+	if err != nil {
+		return err
+	}
+
+	ApplyTranslations(products, translations)
+	return nil
+}
+
+// ApplyTranslations replaces the name and description of products with
+// their translation in translations, by product ID, see LocalizeProducts.
+func ApplyTranslations(products []Product, translations map[uint]ProductTranslation) {
+	for i := range products {
+		products[i].Language = DefaultLanguage
+		if translation, ok := translations[products[i].ID]; ok {
+			products[i].Name = translation.Name
+			if translation.Description != "" {
+				products[i].Description = translation.Description
+			}
+			products[i].Language = translation.Language
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchEvent is an anonymized search, the raw log the hourly search stats
+// are rolled up from.
+type SearchEvent struct {
+	ID       uint   `gorm:"primaryKey"`
+	SearchID string `gorm:"type:varchar(36);index"`
+	Kind     string `gorm:"type:varchar(32);not null"`
+	// Query is the canonical, lower cased form of the search term
+	Query string `gorm:"type:varchar(256);not null"`
+	// UserHash is a keyed hash of the user ID, empty for anonymous searches
+	UserHash    string `gorm:"type:varchar(32)"`
+	ResultCount int64
+	LatencyMs   int64
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+// SearchClickEvent is a click on the result at Position, 0-based, of a
+// search.
+type SearchClickEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	SearchID  string `gorm:"type:varchar(36);not null;index"`
+	Position  int    `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// SearchQueryStat aggregates the searches of a query in an hour.
+type SearchQueryStat struct {
+	Hour  time.Time `gorm:"primaryKey" json:"hour"`
+	Kind  string    `gorm:"type:varchar(32);primaryKey" json:"kind"`
+	Query string    `gorm:"type:varchar(256);primaryKey" json:"query"`
+	// Searches is the number of searches, Users the distinct signed-in
+	// users who ran them
+	Searches    int64 `gorm:"not null" json:"searches"`
+	Users       int64 `gorm:"not null" json:"users"`
+	ZeroResults int64 `gorm:"not null" json:"zero_results"`
+	// ClickedSearches had at least one click, ClickPositionSum adds up the
+	// position of their first clicks
+	ClickedSearches  int64 `gorm:"not null" json:"clicked_searches"`
+	ClickPositionSum int64 `gorm:"not null" json:"click_position_sum"`
+	LatencyMsSum     int64 `gorm:"not null" json:"latency_ms_sum"`
+}
+
+// RollupSearchStats recomputes the hourly stats of the hours from since up
+// to now from the raw events. Recomputing an hour replaces its stats, so
+// clicks arriving after their hour was first rolled up are counted.
+func RollupSearchStats(ctx context.Context, db *gorm.DB, since time.Time) error {
+	return db.WithContext(ctx).Exec(`INSERT INTO search_query_stats
+			(hour, kind, query, searches, users, zero_results, clicked_searches, click_position_sum, latency_ms_sum)
+		SELECT date_trunc('hour', e.created_at), e.kind, e.query,
+			count(*),
+			count(DISTINCT nullif(e.user_hash, '')),
+			count(*) FILTER (WHERE e.result_count = 0),
+			count(c.position),
+			coalesce(sum(c.position), 0),
+			coalesce(sum(e.latency_ms), 0)
+		FROM search_events e
+		LEFT JOIN (
+			SELECT search_id, min(position) AS position FROM search_click_events GROUP BY search_id
+		) c ON c.search_id = e.search_id
+		WHERE e.created_at >= date_trunc('hour', ?::timestamptz)
+		GROUP BY 1, 2, 3
+		ON CONFLICT (hour, kind, query) DO UPDATE SET
+			searches = EXCLUDED.searches,
+			users = EXCLUDED.users,
+			zero_results = EXCLUDED.zero_results,
+			clicked_searches = EXCLUDED.clicked_searches,
+			click_position_sum = EXCLUDED.click_position_sum,
+			latency_ms_sum = EXCLUDED.latency_ms_sum`, since).Error
+}
+
+// PurgeSearchEvents deletes the raw events older than before, their hours
+// are only kept as stats.
+func PurgeSearchEvents(ctx context.Context, db *gorm.DB, before time.Time) error {
+	db = db.WithContext(ctx)
+	if err := db.Where("created_at < ?", before).Delete(&SearchEvent{}).Error; err != nil {
+		return err
+	}
+	return db.Where("created_at < ?", before).Delete(&SearchClickEvent{}).Error
+}
+
+// Search analytics reports
+const (
+	SearchReportTop         = "top"
+	SearchReportZeroResults = "zero-results"
+	SearchReportLowCTR      = "low-ctr"
+	SearchReportTrending    = "trending"
+)
+
+var SearchReportNames = []string{SearchReportTop, SearchReportZeroResults, SearchReportLowCTR, SearchReportTrending}
+
+// SearchReportOptions select the window and queries of a report.
+type SearchReportOptions struct {
+	Since time.Time
+	Until time.Time
+	// Kind restricts the report to a kind of search, all kinds when empty
+	Kind string
+	// MinSearches leaves out rarer queries from the low CTR and trending
+	// reports
+	MinSearches int64
+	Limit       int
+}
+
+// QueryReport is the activity of a query over a report's window.
+type QueryReport struct {
+	Query    string `json:"query"`
+	Searches int64  `json:"searches"`
+	// Users adds up the distinct users of every hour
+	Users       int64   `json:"users"`
+	ZeroResults int64   `json:"zero_results"`
+	CTR         float64 `json:"ctr"`
+	// AvgClickPosition is the mean 0-based position of the first click
+	AvgClickPosition *float64 `json:"avg_click_position,omitempty"`
+	AvgLatencyMs     float64  `json:"avg_latency_ms"`
+	// Previous is the number of searches in the window before, for the
+	// trending report
+	Previous *int64   `json:"previous,omitempty"`
+	Growth   *float64 `json:"growth,omitempty"`
+}
+
+const queryReportColumns = `query,
+	sum(searches) AS searches,
+	sum(users) AS users,
+	sum(zero_results) AS zero_results,
+	sum(clicked_searches)::float / sum(searches) AS ctr,
+	CASE WHEN sum(clicked_searches) > 0 THEN sum(click_position_sum)::float / sum(clicked_searches) END AS avg_click_position,
+	sum(latency_ms_sum)::float / sum(searches) AS avg_latency_ms`
+
+// SearchQueryReport computes a report from the hourly stats.
+func SearchQueryReport(ctx context.Context, db *gorm.DB, report string, opts SearchReportOptions) ([]QueryReport, error) {
+	window := func(since, until time.Time) *gorm.DB {
+		tx := db.WithContext(ctx).Model(&SearchQueryStat{}).Where("hour >= ? AND hour < ?", since, until)
+		if opts.Kind != "" {
+			tx = tx.Where("kind = ?", opts.Kind)
+		}
+		return tx
+	}
+
+	rows := []QueryReport{}
+	tx := window(opts.Since, opts.Until).Select(queryReportColumns).Group("query")
+
+	switch report {
+	case SearchReportTop:
+		tx = tx.Order("searches DESC, query")
+	case SearchReportZeroResults:
+		tx = tx.Having("sum(zero_results) > 0").Order("zero_results DESC, query")
+	case SearchReportLowCTR:
+		// queries that found something the users did not want
+		tx = tx.Having("sum(searches) >= ? AND sum(zero_results) < sum(searches)", opts.MinSearches).Order("ctr, searches DESC, query")
+	case SearchReportTrending:
+		previous := window(opts.Since.Add(-opts.Until.Sub(opts.Since)), opts.Since).Select("query, sum(searches) AS searches").Group("query")
+		err := db.WithContext(ctx).
+			Raw(`SELECT cur.*, coalesce(prev.searches, 0) AS previous,
+					(cur.searches + 1)::float / (coalesce(prev.searches, 0) + 1) AS growth
+				FROM (?) AS cur LEFT JOIN (?) AS prev ON prev.query = cur.query
+				WHERE cur.searches >= ?
+				ORDER BY growth DESC, cur.searches DESC, cur.query
+				LIMIT ?`, tx.Having("sum(searches) > 0"), previous, opts.MinSearches, opts.Limit).
+			Scan(&rows).
+			Error
+		return rows, err
+	}
+
+	err := tx.Limit(opts.Limit).Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchKindUnified is the kind of the searches of all types at once
+const SearchKindUnified = "unified"
+
+// SearchHistory is a search a signed-in user ran.
+type SearchHistory struct {
+	gorm.Model
+	UserID uint `gorm:"not null;index" json:"-"`
+	// SearchID is the page_id of the search's pages, it ties clicks to the
+	// search
+	SearchID    string          `gorm:"type:varchar(36);index" json:"search_id"`
+	Kind        string          `gorm:"type:varchar(32)" json:"kind"`
+	Query       string          `gorm:"type:varchar(256)" json:"query"`
+	Filters     json.RawMessage `gorm:"type:jsonb" json:"filters,omitempty"`
+	ResultCount int64           `json:"result_count"`
+	// The result the user opened, if any
+	ClickedType string    `gorm:"type:varchar(32)" json:"clicked_type,omitempty"`
+	ClickedID   *uint     `json:"clicked_id,omitempty"`
+	SearchDate  time.Time `json:"searchDate"`
+}
+
+// SearchHistorySettings are the search history preferences of a user.
+type SearchHistorySettings struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Paused    bool      `gorm:"not null;default:false" json:"paused"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SearchHistorySettingsUpdate struct {
+	Paused *bool `json:"paused" validate:"required"`
+}
+
+type SearchClick struct {
+	SearchID string `json:"search_id" validate:"required,max=36"`
+	Type     string `json:"type" validate:"required,max=32"`
+	ID       uint   `json:"id" validate:"required"`
+	// Position is the 0-based rank of the result in the search
+	Position *int `json:"position" validate:"required,min=0"`
+}
+
+// SaveSearchHistory stores the searches of entries, leaving out those of
+// users who paused their history.
+func SaveSearchHistory(ctx context.Context, db *gorm.DB, entries []SearchHistory) error {
+	db = db.WithContext(ctx)
+
+	userIDs := []uint{}
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.UserID)
+	}
+
+	var paused []uint
+	if err := db.Model(&SearchHistorySettings{}).Where("user_id IN ? AND paused", userIDs).Pluck("user_id", &paused).Error; err != nil {
+		return err
+	}
+	skip := map[uint]bool{}
+	for _, id := range paused {
+		skip[id] = true
+	}
+
+	kept := []SearchHistory{}
+	for _, entry := range entries {
+		if !skip[entry.UserID] {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return db.Create(&kept).Error
+}
+
+// SearchHistoryPaused tells whether the user paused their search history.
+func SearchHistoryPaused(db *gorm.DB, userID uint) (bool, error) {
+	var settings SearchHistorySettings
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&settings).Error
+	return settings.Paused, err
+}
+
+// PauseSearchHistory pauses or resumes the recording of a user's searches.
+func PauseSearchHistory(db *gorm.DB, userID uint, paused bool) (*SearchHistorySettings, error) {
+	settings := &SearchHistorySettings{UserID: userID, Paused: paused, UpdatedAt: time.Now()}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"paused", "updated_at"}),
+	}).Create(settings).Error
+	return settings, err
+}
+
+// RecordSearchClick notes the result the user opened from one of their
+// searches. It returns false when the user has no such search.
+func RecordSearchClick(db *gorm.DB, userID uint, click *SearchClick) (bool, error) {
+	result := db.Model(&SearchHistory{}).
+		Where("user_id = ? AND search_id = ?", userID, click.SearchID).
+		Updates(map[string]interface{}{"clicked_type": click.Type, "clicked_id": click.ID})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecentSearch is a distinct query of the search history.
+type RecentSearch struct {
+	Query      string
+	ID         uint
+	SearchedAt time.Time
+}
+
+// RecentSearches returns up to limit distinct queries of the user's history
+// with a word starting with term, most recent first.
+func RecentSearches(ctx context.Context, db *gorm.DB, userID uint, term string, limit int) ([]RecentSearch, error) {
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(strings.TrimSpace(term)))
+
+	recent := []RecentSearch{}
+	err := db.WithContext(ctx).Raw(`SELECT query, max(id) AS id, max(search_date) AS searched_at
+		FROM search_histories
+		WHERE user_id = ? AND deleted_at IS NULL AND (lower(query) LIKE ? OR lower(query) LIKE ?)
+		GROUP BY query
+		ORDER BY searched_at DESC
+		LIMIT ?`, userID, pattern+"%", "% "+pattern+"%", limit).
+		Scan(&recent).
+		Error
+	return recent, err
+}
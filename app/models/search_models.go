@@ -2,19 +2,117 @@ package models
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"math/rand"
-	"time"
+	"sort"
+	"strings"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
 	"gorm.io/gorm"
 )
 
+// Parser options of each searchable entity
+var (
+	ProductQuery            = query.Options{Fields: []string{"brand", "category", "tag"}}
+	MarketplaceProductQuery = query.Options{Fields: []string{"brand", "category"}}
+	ReportQuery             = query.Options{}
+)
+
+// Documents embedded for the semantic search
+const (
+	productDocument = "coalesce(name, '') || ' ' || coalesce(description, '')"
+	reportDocument  = "coalesce(name, '') || ' ' || coalesce(summary, '')"
+)
+
+// textDocument is what the full-text search of an entity matches: the
+// stored search vector of its rows, see SearchVectorSchema, or the vector
+// of its document computed per row for the small tables without one, in
+// the default language. Searches of products in another language also
+// match their translations.
+type textDocument struct {
+	column   string
+	document string
+	// translated is set for products, whose translations are searched by
+	// the vector of product_translations
+	translated bool
+}
+
+var (
+	productText     = textDocument{column: "products.search_vector", translated: true}
+	marketplaceText = textDocument{column: "marketplace_products.search_vector"}
+	reportText      = textDocument{column: "reports.search_vector"}
+)
+
+// inLanguage tells whether searches of q also match translations.
+func (d textDocument) inLanguage(q *query.Query) bool {
+	return d.translated && q.Language != "" && q.Language != DefaultLanguage
+}
+
+// ownVector returns the SQL of the search vector of a row's own texts.
+func (d textDocument) ownVector() string {
+	if d.column != "" {
+		return d.column
+	}
+	return "to_tsvector('" + locale.Config(DefaultLanguage) + "', " + d.document + ")"
+}
+
+// tsquery returns the SQL of the text query of q and its arguments. Terms
+// of a search in another language are stemmed in both, to match the
+// default texts and the translations.
+func (d textDocument) tsquery(q *query.Query) (string, []interface{}) {
+	tsquery := "websearch_to_tsquery('" + locale.Config(DefaultLanguage) + "', ?)"
+	if !d.inLanguage(q) {
+		return tsquery, []interface{}{q.WebSearch()}
+	}
+	return "(" + tsquery + " || websearch_to_tsquery('" + locale.Config(q.Language) + "', ?))", []interface{}{q.WebSearch(), q.WebSearch()}
+}
+
+// match returns the condition of the rows matching the text of q. Both
+// sides of a search in another language can use their GIN index.
+func (d textDocument) match(q *query.Query) (string, []interface{}) {
+	tsquery, args := d.tsquery(q)
+	condition := d.ownVector() + " @@ " + tsquery
+	if !d.inLanguage(q) {
+		return condition, args
+	}
+
+	condition = "(" + condition + " OR products.id IN (SELECT t.product_id FROM product_translations t WHERE t.language = ? AND t.search_vector @@ " + tsquery + "))"
+	return condition, append(append(args, q.Language), args...)
+}
+
+// rank returns the SQL of the rank of a row against the text of q, names
+// weigh more than brands and brands more than descriptions.
+func (d textDocument) rank(q *query.Query) (string, []interface{}) {
+	tsquery, args := d.tsquery(q)
+	if !d.inLanguage(q) {
+		return "ts_rank_cd(" + d.ownVector() + ", " + tsquery + ")", args
+	}
+
+	vector := "(" + d.ownVector() + " || coalesce((SELECT t.search_vector FROM product_translations t WHERE t.product_id = products.id AND t.language = ?), ''::tsvector))"
+	return "ts_rank_cd(" + vector + ", " + tsquery + ")", append([]interface{}{q.Language}, args...)
+}
+
+// SQL the field filters of each entity compile to, the placeholder receives
+// the lower cased values
+var (
+	productFilters = map[string]string{
+		"brand":    "brand_id IN (SELECT id FROM brands WHERE lower(name) IN ?)",
+		"category": "category_id IN (SELECT id FROM categories WHERE lower(name) IN ?)",
+		"tag":      "id IN (SELECT product_id FROM environment_tags WHERE deleted_at IS NULL AND lower(name) IN ?)",
+	}
+	marketplaceProductFilters = map[string]string{
+		"brand":    "brand_id IN (SELECT id FROM brands WHERE lower(name) IN ?)",
+		"category": "category_id IN (SELECT id FROM categories WHERE lower(name) IN ?)",
+	}
+)
+
 // For autocomplete
 type MatchResult struct {
-	Rank    int    `json:"rank"`
-	Content string `json:"content"`
+	Rank       int          `json:"rank"`
+	Content    string       `json:"content"`
+	Type       string       `json:"type"`
+	ID         uint         `json:"id"`
+	Score      float64      `json:"score"`
+	Highlights []query.Span `json:"highlights"`
 }
 
 // for search results
@@ -28,15 +126,21 @@ type SearchResult struct {
 }
 
 type SearchResultPage struct {
-	PageID  string         `json:"page_id"`
-	Index   int            `json:"index"`
+	// PageID identifies the search session the page belongs to
+	PageID string `json:"page_id"`
+	// Index is the 1-based number of the page in the session
+	Index int `json:"index"`
+	// Length is the number of results on this page
 	Length  int            `json:"length"`
+	Total   int64          `json:"total"`
 	Results []SearchResult `json:"results"`
-}
-
-func GenerateRandomPageID() string {
-	randomNumber := rand.Intn(10000000)
-	return fmt.Sprintf("page_%d", randomNumber)
+	// Cursors of the neighbouring pages, empty at either end
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	// Spelling is set when the search term was corrected or could be
+	Spelling *SpellingSuggestion `json:"spelling,omitempty"`
+	// Language is the language of the results, when they are translated
+	Language string `json:"language,omitempty"`
 }
 
 func CreateSearchResult(rank int, title, description string) SearchResult {
@@ -47,113 +151,182 @@ func CreateSearchResult(rank int, title, description string) SearchResult {
 	}
 }
 
-func SearchProducts(ctx context.Context, redisClient *redis.Client, db *gorm.DB, query string, page int, pageSize int) ([]Product, error) {
-	// Redis caching
-	cacheKey := fmt.Sprintf("marketproduct:%s:%d:%d", query, page, pageSize)
-	cachedResult, err := redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		// Cache Hit : unmarshal the cache
-		var products []Product
-		if err := json.Unmarshal([]byte(cachedResult), &products); err == nil {
-			return products, nil
-		}
-	}
-	// Cache Miss : Perform the database search
-	var products []Product
-
-	offset := (page - 1) * pageSize
-	limit := pageSize
-
-	err = db.
-		Table("products").
-		Select("id, ts_rank_cd(to_tsvector('english', name || ' ' || description), to_tsquery('english', ?)) AS rank, name", query).
-		Where("to_tsvector('english', name || ' ' || description) @@ to_tsquery('english', ?) OR name ILIKE ANY(ARRAY[?]) OR description ILIKE ANY(ARRAY[?])", query, query, []string{"%" + query + "%"}, []string{"%" + query + "%"}).
-		Order("rank DESC").
-		Offset(offset).
-		Limit(limit).
-		Find(&products).
-		Error
+// RankedIDs are the IDs of the best matches of a search and the number of
+// rows that matched in total.
+type RankedIDs struct {
+	IDs   []uint `json:"ids"`
+	Total int64  `json:"total"`
+}
+
+// SearchProducts ranks the products matching q. Given a semantic query,
+// the products closest in meaning are fused into the ranking.
+func SearchProducts(ctx context.Context, db *gorm.DB, q *query.Query, limit int, semantic *SemanticQuery) (*RankedIDs, error) {
+	db = db.WithContext(ctx)
+	tx, err := matchQuery(db.Table("products").Where("deleted_at IS NULL"), q, productText, productFilters)
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache the results in Redis with a TTL (time-to-live)
-	if marshalledResult, err := json.Marshal(products); err == nil {
-		redisClient.Set(ctx, cacheKey, marshalledResult, 10*time.Minute)
+	ranked, err := rankIDs(tx, q, productText, limit)
+	if err != nil || semantic == nil || !q.HasText() {
+		return ranked, err
 	}
 
-	return products, nil
+	candidates, err := matchQuery(db.Table("products").Where("deleted_at IS NULL"), withoutText(q), productText, productFilters)
+	if err != nil {
+		return nil, err
+	}
+	return fuseSemantic(db, EmbeddingProduct, semantic, candidates, ranked, limit)
 }
 
-func SearchMarketplaceProducts(ctx context.Context, redisClient *redis.Client, db *gorm.DB, query string, page int, pageSize int) ([]MarketPlaceProduct, error) {
-	cacheKey := fmt.Sprintf("marketproduct:%s:%d:%d", query, page, pageSize)
-	cachedResult, err := redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var products []MarketPlaceProduct
-		if err := json.Unmarshal([]byte(cachedResult), &products); err == nil {
-			return products, nil
-		}
+// SearchMarketplaceProducts ranks the marketplace products matching q.
+func SearchMarketplaceProducts(ctx context.Context, db *gorm.DB, q *query.Query, limit int) (*RankedIDs, error) {
+	tx, err := matchQuery(db.WithContext(ctx).Table("marketplace_products").Where("deleted_at IS NULL"), q, marketplaceText, marketplaceProductFilters)
+	if err != nil {
+		return nil, err
 	}
+	return rankIDs(tx, q, marketplaceText, limit)
+}
 
-	var products []MarketPlaceProduct
+// SearchReports ranks the reports matching q, fusing in the reports
+// closest in meaning given a semantic query.
+func SearchReports(ctx context.Context, db *gorm.DB, q *query.Query, limit int, semantic *SemanticQuery) (*RankedIDs, error) {
+	db = db.WithContext(ctx)
+	tx, err := matchQuery(db.Table("reports").Where("deleted_at IS NULL"), q, reportText, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	offset := (page - 1) * pageSize
-	limit := pageSize
+	ranked, err := rankIDs(tx, q, reportText, limit)
+	if err != nil || semantic == nil || !q.HasText() {
+		return ranked, err
+	}
 
-	err = db.
-		Table("marketplace_products").
-		Select("id, ts_rank_cd(to_tsvector('english', name || ' ' || description), to_tsquery('english', ?)) AS rank, name", query).
-		Where("to_tsvector('english', name || ' ' || description) @@ to_tsquery('english', ?) OR name ILIKE ANY(ARRAY[?]) OR description ILIKE ANY(ARRAY[?])", query, query, []string{"%" + query + "%"}, []string{"%" + query + "%"}).
-		Order("rank DESC").
-		Offset(offset).
-		Limit(limit).
-		Find(&products).
-		Error
+	candidates, err := matchQuery(db.Table("reports").Where("deleted_at IS NULL"), withoutText(q), reportText, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fuseSemantic(db, EmbeddingReport, semantic, candidates, ranked, limit)
+}
 
+// matchQuery restricts tx to the rows whose document matches the free text
+// of q and its field filters. The user's input is only ever bound as a
+// parameter of websearch_to_tsquery, which accepts any text.
+func matchQuery(tx *gorm.DB, q *query.Query, text textDocument, filters map[string]string) (*gorm.DB, error) {
+	conditions, err := q.Conditions(filters)
 	if err != nil {
 		return nil, err
 	}
+	for _, condition := range conditions {
+		tx = tx.Where(condition.SQL, condition.Args...)
+	}
 
-	if marshalledResult, err := json.Marshal(products); err == nil {
-		redisClient.Set(ctx, cacheKey, marshalledResult, 10*time.Minute)
+	if q.HasText() {
+		condition, args := text.match(q)
+		tx = tx.Where(condition, args...)
 	}
 
-	return products, nil
+	return tx, nil
+}
+
+// selectRank selects the id and columns of every row and, when q has free
+// text, its rank against it as "rank", so ranked queries can order by
+// "rank DESC".
+func selectRank(tx *gorm.DB, q *query.Query, text textDocument, columns ...string) *gorm.DB {
+	selected := strings.Join(append([]string{"id"}, columns...), ", ")
+	if q == nil || !q.HasText() {
+		return tx.Select(selected)
+	}
+	rank, args := text.rank(q)
+	return tx.Select(selected+", "+rank+" AS rank", args...)
 }
 
-func SearchReports(ctx context.Context, redisClient *redis.Client, db *gorm.DB, query string, page int, pageSize int) ([]Report, error) {
-	cacheKey := fmt.Sprintf("reports:%s:%d:%d", query, page, pageSize)
-	// Try to get results from the cache
-	cachedResult, err := redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var reports []Report
-		if err := json.Unmarshal([]byte(cachedResult), &reports); err == nil {
-			return reports, nil
-		}
+// scanIDs returns the ids selected by tx.
+func scanIDs(tx *gorm.DB) ([]uint, error) {
+	var rows []struct{ ID uint }
+	if err := tx.Scan(&rows).Error; err != nil {
+		return nil, err
 	}
 
-	var reports []Report
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ids, nil
+}
 
-	offset := (page - 1) * pageSize
-	limit := pageSize
+// rankIDs counts the rows of tx and returns the IDs of the first limit of
+// them, best matches first.
+func rankIDs(tx *gorm.DB, q *query.Query, text textDocument, limit int) (*RankedIDs, error) {
+	ranked := &RankedIDs{}
+	if err := tx.Session(&gorm.Session{}).Count(&ranked.Total).Error; err != nil {
+		return nil, err
+	}
 
-	err = db.
-		Table("reports").
-		Select("id, ts_rank_cd(to_tsvector('english', summary), to_tsquery('english', ?)) AS rank, name", query).
-		Where("to_tsvector('english', summary) @@ to_tsquery('english', ?) OR summary ILIKE ANY(ARRAY[?])", query, []string{"%" + query + "%"}).
-		Order("rank DESC").
-		Offset(offset).
-		Limit(limit).
-		Find(&reports).
-		Error
+	tx = selectRank(tx, q, text)
+	if q.HasText() {
+		tx = tx.Order("rank DESC")
+	}
 
+	ids, err := scanIDs(tx.Order("id DESC").Limit(limit))
 	if err != nil {
 		return nil, err
 	}
+	ranked.IDs = ids
+
+	return ranked, nil
+}
 
-	if marshalledResult, err := json.Marshal(reports); err != nil {
-		redisClient.Set(ctx, cacheKey, marshalledResult, 10*time.Minute)
+// LoadProducts loads the products with the given IDs in the order of ids.
+// Products deleted since the IDs were ranked are left out.
+func LoadProducts(db *gorm.DB, ids []uint) ([]Product, error) {
+	products := []Product{}
+	if len(ids) == 0 {
+		return products, nil
 	}
+	if err := db.Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	position := positions(ids)
+	sort.Slice(products, func(i, j int) bool { return position[products[i].ID] < position[products[j].ID] })
+	return products, nil
+}
 
+// LoadMarketplaceProducts loads marketplace products in the order of ids.
+func LoadMarketplaceProducts(db *gorm.DB, ids []uint) ([]MarketPlaceProduct, error) {
+	products := []MarketPlaceProduct{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+	if err := db.Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	position := positions(ids)
+	sort.Slice(products, func(i, j int) bool { return position[products[i].ID] < position[products[j].ID] })
+	return products, nil
+}
+
+// LoadReports loads reports in the order of ids.
+func LoadReports(db *gorm.DB, ids []uint) ([]Report, error) {
+	reports := []Report{}
+	if len(ids) == 0 {
+		return reports, nil
+	}
+	if err := db.Where("id IN ?", ids).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+
+	position := positions(ids)
+	sort.Slice(reports, func(i, j int) bool { return position[reports[i].ID] < position[reports[j].ID] })
 	return reports, nil
 }
+
+func positions(ids []uint) map[uint]int {
+	position := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	return position
+}
@@ -0,0 +1,340 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"github.com/r3tr056/ecolens_api/platform/db"
+)
+
+// testDB returns a database migrated to the latest schema, whose search
+// tables are emptied. The tests using it are skipped unless ECOLENS_TEST_DSN
+// names a disposable Postgres database.
+func testDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+
+	dsn := os.Getenv("ECOLENS_TEST_DSN")
+	if dsn == "" {
+		tb.Skip("ECOLENS_TEST_DSN is not set")
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.Migrate(context.Background(), conn); err != nil {
+		tb.Fatal(err)
+	}
+	if err := conn.Exec("TRUNCATE products, marketplace_products, reports, product_translations, brands, categories RESTART IDENTITY CASCADE").Error; err != nil {
+		tb.Fatal(err)
+	}
+	return conn
+}
+
+// recorder keeps the SQL of the statements gorm runs.
+type recorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *recorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *recorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// dryRun returns a database rendering the SQL of the statements into r
+// rather than running them.
+func dryRun(t *testing.T, r *recorder) *gorm.DB {
+	t.Helper()
+
+	conn, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               r,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func parse(t testing.TB, raw string, opts query.Options) *query.Query {
+	t.Helper()
+
+	q, err := query.Parse(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// TestSearchReadsItsOwnTable checks the statements of each search only
+// read the search vector of the searched table.
+func TestSearchReadsItsOwnTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		search func(*gorm.DB) error
+		table  string
+	}{
+		{
+			name: "products",
+			search: func(conn *gorm.DB) error {
+				_, err := models.SearchProducts(context.Background(), conn, parse(t, "bamboo", models.ProductQuery), 10, nil)
+				return err
+			},
+			table: "products",
+		},
+		{
+			name: "marketplace",
+			search: func(conn *gorm.DB) error {
+				_, err := models.SearchMarketplaceProducts(context.Background(), conn, parse(t, "bamboo", models.MarketplaceProductQuery), 10)
+				return err
+			},
+			table: "marketplace_products",
+		},
+		{
+			name: "reports",
+			search: func(conn *gorm.DB) error {
+				_, err := models.SearchReports(context.Background(), conn, parse(t, "bamboo", models.ReportQuery), 10, nil)
+				return err
+			},
+			table: "reports",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{Interface: logger.Discard}
+			// the rows of a dry run cannot be scanned, the ranking stops
+			// after rendering the statement reading them
+			if err := tt.search(dryRun(t, r)); err != nil && !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+				t.Fatal(err)
+			}
+			if len(r.statements) != 2 {
+				t.Fatalf("statements = %q, want the count and the ranking", r.statements)
+			}
+
+			for _, sql := range r.statements {
+				if !strings.Contains(sql, tt.table+".search_vector @@") {
+					t.Errorf("%s does not match %s.search_vector", sql, tt.table)
+				}
+				// the name of every other table ends with the name of one
+				// of the searched tables
+				rest := strings.ReplaceAll(sql, tt.table+".", "")
+				for _, other := range []string{"products.", "reports."} {
+					if strings.Contains(rest, other) {
+						t.Errorf("%s reads another table than %s", sql, tt.table)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSearchMarketplaceProducts(t *testing.T) {
+	conn := testDB(t)
+
+	// a product matching the text must not be confused with a marketplace
+	// product
+	if err := conn.Exec("INSERT INTO products (name, description) VALUES ('Bamboo toothbrush', 'Compostable handle')").Error; err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	if err := conn.Raw("INSERT INTO marketplace_products (name, description) VALUES ('Steel bottle', 'Keeps water cold'), ('Bamboo cutlery', 'A fork, a knife and a spoon'), ('Cotton bag', 'Bamboo fibre lining') RETURNING id").Scan(&ids).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ranked, err := models.SearchMarketplaceProducts(context.Background(), conn, parse(t, "bamboo", models.MarketplaceProductQuery), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// names weigh more than descriptions
+	if ranked.Total != 2 || len(ranked.IDs) != 2 || ranked.IDs[0] != ids[1] || ranked.IDs[1] != ids[2] {
+		t.Errorf("ranked = %+v, want %v", ranked, ids[1:])
+	}
+
+	ranked, err = models.SearchMarketplaceProducts(context.Background(), conn, parse(t, "bamboo -fork", models.MarketplaceProductQuery), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ranked.Total != 1 || len(ranked.IDs) != 1 || ranked.IDs[0] != ids[2] {
+		t.Errorf("ranked = %+v, want [%d]", ranked, ids[2])
+	}
+}
+
+// TestSearchText runs a text query through each search and checks the
+// matching rows come first, by the weight of the matched text.
+func TestSearchText(t *testing.T) {
+	conn := testDB(t)
+
+	seed := map[string]string{
+		"products":             "INSERT INTO products (name, description) VALUES ('Glass jar', 'Airtight lid'), ('Bamboo toothbrush', 'Compostable handle'), ('Cotton swabs', 'Bamboo sticks') RETURNING id",
+		"marketplace_products": "INSERT INTO marketplace_products (name, description) VALUES ('Steel bottle', 'Keeps water cold'), ('Bamboo cutlery', 'A fork and a knife'), ('Cotton bag', 'Bamboo fibre lining') RETURNING id",
+		"reports":              "INSERT INTO reports (name, summary) VALUES ('Glass LCA', 'Recycled content'), ('Bamboo LCA', 'Cradle to gate'), ('Textiles', 'Cotton and bamboo fibres') RETURNING id",
+	}
+	ids := map[string][]uint{}
+	for table, sql := range seed {
+		var tableIDs []uint
+		if err := conn.Raw(sql).Scan(&tableIDs).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[table] = tableIDs
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		table  string
+		search func(q string) (*models.RankedIDs, error)
+	}{
+		{"products", func(q string) (*models.RankedIDs, error) {
+			return models.SearchProducts(ctx, conn, parse(t, q, models.ProductQuery), 10, nil)
+		}},
+		{"marketplace_products", func(q string) (*models.RankedIDs, error) {
+			return models.SearchMarketplaceProducts(ctx, conn, parse(t, q, models.MarketplaceProductQuery), 10)
+		}},
+		{"reports", func(q string) (*models.RankedIDs, error) {
+			return models.SearchReports(ctx, conn, parse(t, q, models.ReportQuery), 10, nil)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			want := ids[tt.table]
+
+			// names weigh more than descriptions, stems match
+			ranked, err := tt.search("BAMBOOS")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ranked.Total != 2 || len(ranked.IDs) != 2 || ranked.IDs[0] != want[1] || ranked.IDs[1] != want[2] {
+				t.Errorf("ranked = %+v, want %v", ranked, want[1:])
+			}
+
+			ranked, err = tt.search("glass OR steel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ranked.Total != 1 || len(ranked.IDs) != 1 || ranked.IDs[0] != want[0] {
+				t.Errorf("ranked = %+v, want [%d]", ranked, want[0])
+			}
+		})
+	}
+}
+
+// benchRows is the number of rows of each table searched by the benchmarks
+const benchRows = 1000000
+
+// benchDB returns testDB with benchRows products, marketplace products and
+// reports, of which 1 in 50 mentions bamboo. The rows are kept for the
+// next benchmarks.
+func benchDB(b *testing.B) *gorm.DB {
+	b.Helper()
+
+	dsn := os.Getenv("ECOLENS_TEST_DSN")
+	if dsn == "" {
+		b.Skip("ECOLENS_TEST_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var count int64
+	if err := conn.Table("reports").Count(&count).Error; err != nil || count != benchRows {
+		conn = testDB(b)
+		words := "(ARRAY['glass', 'steel', 'cotton', 'cork', 'wool', 'paper', 'linen'])[1 + i % 7]"
+		mention := "CASE WHEN i % 50 = 0 THEN ' bamboo' ELSE '' END"
+		for _, sql := range []string{
+			"INSERT INTO products (name, description) SELECT 'Product ' || i || ' ' || " + words + ", 'Made of recycled ' || " + words + " || " + mention + " FROM generate_series(1, ?) i",
+			"INSERT INTO marketplace_products (name, description) SELECT 'Offer ' || i || ' ' || " + words + ", 'Made of recycled ' || " + words + " || " + mention + " FROM generate_series(1, ?) i",
+			"INSERT INTO reports (name, summary) SELECT 'Report ' || i, 'Life cycle of ' || " + words + " || " + mention + " FROM generate_series(1, ?) i",
+		} {
+			if err := conn.Exec(sql, benchRows).Error; err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := conn.Exec("ANALYZE products, marketplace_products, reports").Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+	return conn
+}
+
+// BenchmarkSearch compares the searches matching the stored search vectors
+// with the vector of the texts computed per row, as they were before.
+func BenchmarkSearch(b *testing.B) {
+	ctx := context.Background()
+	surfaces := []struct {
+		table    string
+		document string
+		search   func(conn *gorm.DB, q *query.Query) (*models.RankedIDs, error)
+		opts     query.Options
+	}{
+		{
+			table:    "products",
+			document: "coalesce(name, '') || ' ' || coalesce(description, '')",
+			search: func(conn *gorm.DB, q *query.Query) (*models.RankedIDs, error) {
+				return models.SearchProducts(ctx, conn, q, 20, nil)
+			},
+			opts: models.ProductQuery,
+		},
+		{
+			table:    "marketplace_products",
+			document: "coalesce(name, '') || ' ' || coalesce(description, '')",
+			search: func(conn *gorm.DB, q *query.Query) (*models.RankedIDs, error) {
+				return models.SearchMarketplaceProducts(ctx, conn, q, 20)
+			},
+			opts: models.MarketplaceProductQuery,
+		},
+		{
+			table:    "reports",
+			document: "coalesce(name, '') || ' ' || coalesce(summary, '')",
+			search: func(conn *gorm.DB, q *query.Query) (*models.RankedIDs, error) {
+				return models.SearchReports(ctx, conn, q, 20, nil)
+			},
+			opts: models.ReportQuery,
+		},
+	}
+
+	conn := benchDB(b)
+	for _, s := range surfaces {
+		q := parse(b, "bamboo", s.opts)
+
+		b.Run(s.table+"/per_row", func(b *testing.B) {
+			vector := "to_tsvector('english', " + s.document + ")"
+			tsquery := "websearch_to_tsquery('english', ?)"
+			for i := 0; i < b.N; i++ {
+				var total int64
+				if err := conn.Table(s.table).Where("deleted_at IS NULL AND "+vector+" @@ "+tsquery, q.WebSearch()).Count(&total).Error; err != nil {
+					b.Fatal(err)
+				}
+				var rows []struct{ ID uint }
+				if err := conn.Table(s.table).Select("id, ts_rank_cd("+vector+", "+tsquery+") AS rank", q.WebSearch()).
+					Where("deleted_at IS NULL AND "+vector+" @@ "+tsquery, q.WebSearch()).
+					Order("rank DESC").Order("id DESC").Limit(20).Scan(&rows).Error; err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(s.table+"/stored", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.search(conn, q); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
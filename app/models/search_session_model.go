@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Kinds of search sessions
+const (
+	SearchKindProducts            = "products"
+	SearchKindMarketplaceProducts = "marketplace_products"
+	SearchKindReports             = "reports"
+)
+
+const (
+	SearchSessionTTL = 30 * time.Minute
+	// MaxSessionResults caps the ranked IDs a session keeps
+	MaxSessionResults = 1000
+)
+
+var (
+	ErrSearchSessionExpired = errors.New("search session expired or does not exist")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+)
+
+// SearchSession is the snapshot of a search's ranked results that its pages
+// are served from, so paging is not affected by catalogue changes.
+type SearchSession struct {
+	ID       string              `json:"id"`
+	Kind     string              `json:"kind"`
+	Query    string              `json:"query"`
+	Request  json.RawMessage     `json:"request,omitempty"`
+	IDs      []uint              `json:"ids"`
+	Total    int64               `json:"total"`
+	Facets   *ProductFacets      `json:"facets,omitempty"`
+	Spelling *SpellingSuggestion `json:"spelling,omitempty"`
+	// Language is the language the results are returned in, see package
+	// locale
+	Language  string    `json:"language,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewSearchSession(kind, query string, ranked *RankedIDs) *SearchSession {
+	return &SearchSession{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Query:     query,
+		IDs:       ranked.IDs,
+		Total:     ranked.Total,
+		CreatedAt: time.Now(),
+	}
+}
+
+func searchSessionKey(id string) string {
+	return "search_session:" + id
+}
+
+func (s *SearchSession) Save(ctx context.Context, redisClient *redis.Client) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return redisClient.Set(ctx, searchSessionKey(s.ID), data, SearchSessionTTL).Err()
+}
+
+// LoadSearchSession loads a session and extends its TTL.
+func LoadSearchSession(ctx context.Context, redisClient *redis.Client, id string) (*SearchSession, error) {
+	data, err := redisClient.GetEx(ctx, searchSessionKey(id), SearchSessionTTL).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSearchSessionExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &SearchSession{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Page returns the IDs of the page starting at offset.
+func (s *SearchSession) Page(offset, size int) []uint {
+	if offset >= len(s.IDs) {
+		return []uint{}
+	}
+	end := offset + size
+	if end > len(s.IDs) {
+		end = len(s.IDs)
+	}
+	return s.IDs[offset:end]
+}
+
+// ResultPage wraps the results of the page starting at offset with the
+// cursors of its neighbours.
+func (s *SearchSession) ResultPage(offset, size int, results []SearchResult) SearchResultPage {
+	page := SearchResultPage{
+		PageID:   s.ID,
+		Index:    offset/size + 1,
+		Length:   len(results),
+		Total:    s.Total,
+		Results:  results,
+		Spelling: s.Spelling,
+		Language: s.Language,
+	}
+
+	if offset+size < len(s.IDs) {
+		page.NextCursor = SearchCursor{PageID: s.ID, Offset: offset + size, Size: size}.Encode()
+	}
+	if offset > 0 {
+		prev := offset - size
+		if prev < 0 {
+			prev = 0
+		}
+		page.PrevCursor = SearchCursor{PageID: s.ID, Offset: prev, Size: size}.Encode()
+	}
+
+	return page
+}
+
+// SearchCursor points at a page of a search session. Clients treat the
+// encoded form as opaque.
+type SearchCursor struct {
+	PageID string `json:"p"`
+	Offset int    `json:"o"`
+	Size   int    `json:"n"`
+}
+
+func (c SearchCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeSearchCursor(cursor string) (*SearchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &SearchCursor{}
+	if err := json.Unmarshal(data, c); err != nil || c.PageID == "" || c.Offset < 0 || c.Size < 1 || c.Size > 100 {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
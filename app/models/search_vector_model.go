@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+)
+
+// weighted returns the SQL of the vector of text stemmed in config with a
+// weight, A being the heaviest.
+func weighted(config, text, weight string) string {
+	return "setweight(to_tsvector(" + config + ", coalesce(" + text + ", '')), '" + weight + "')"
+}
+
+// SearchVectorSchema returns the statements adding the stored search
+// vectors of products, marketplace products and reports, stemmed in the
+// default language, and their GIN and trigram indexes. Names weigh A,
+// brands B and descriptions C. The vectors of reports are generated
+// columns; those of products name their brand, which a generated column
+// cannot read, so triggers maintain them, also when a brand is renamed.
+// Every statement can run again.
+func SearchVectorSchema() []string {
+	config := quoteLiteral(locale.Config(DefaultLanguage))
+
+	statements := []string{
+		// the B-tree indexes the searchable fields used to get
+		"DROP INDEX IF EXISTS idx_name_gin",
+		"DROP INDEX IF EXISTS idx_description_gin",
+
+		`CREATE OR REPLACE FUNCTION product_search_vector() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			NEW.search_vector := ` + weighted(config, "NEW.name", "A") + ` || ` +
+			weighted(config, "(SELECT b.name FROM brands b WHERE b.id = NEW.brand_id)", "B") + ` || ` +
+			weighted(config, "NEW.description", "C") + `;
+			RETURN NEW;
+		END $$`,
+
+		// touching brand_id fires the trigger of the products
+		`CREATE OR REPLACE FUNCTION brand_search_vectors() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			UPDATE products SET brand_id = brand_id WHERE brand_id = NEW.id;
+			UPDATE marketplace_products SET brand_id = brand_id WHERE brand_id = NEW.id;
+			RETURN NULL;
+		END $$`,
+	}
+
+	for _, table := range []string{"products", "marketplace_products"} {
+		statements = append(statements,
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS search_vector tsvector",
+			"DROP TRIGGER IF EXISTS "+table+"_search_vector ON "+table,
+			"CREATE TRIGGER "+table+"_search_vector BEFORE INSERT OR UPDATE OF name, description, brand_id ON "+table+
+				" FOR EACH ROW EXECUTE FUNCTION product_search_vector()",
+			"UPDATE "+table+" SET brand_id = brand_id WHERE search_vector IS NULL",
+			"CREATE INDEX IF NOT EXISTS idx_"+table+"_search_vector ON "+table+" USING gin (search_vector)",
+			"CREATE INDEX IF NOT EXISTS idx_"+table+"_name_trgm ON "+table+" USING gin (name gin_trgm_ops)",
+		)
+	}
+
+	return append(statements,
+		"DROP TRIGGER IF EXISTS brands_search_vectors ON brands",
+		"CREATE TRIGGER brands_search_vectors AFTER UPDATE OF name ON brands FOR EACH ROW EXECUTE FUNCTION brand_search_vectors()",
+
+		"ALTER TABLE reports ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS ("+
+			weighted(config+"::regconfig", "name", "A")+" || "+weighted(config+"::regconfig", "summary", "C")+") STORED",
+		"CREATE INDEX IF NOT EXISTS idx_reports_search_vector ON reports USING gin (search_vector)",
+		"CREATE INDEX IF NOT EXISTS idx_reports_name_trgm ON reports USING gin (name gin_trgm_ops)",
+	)
+}
+
+// DropSearchVectorSchema returns the statements undoing SearchVectorSchema,
+// but for the B-tree indexes it dropped.
+func DropSearchVectorSchema() []string {
+	return []string{
+		"DROP TRIGGER IF EXISTS brands_search_vectors ON brands",
+		"DROP TRIGGER IF EXISTS products_search_vector ON products",
+		"DROP TRIGGER IF EXISTS marketplace_products_search_vector ON marketplace_products",
+		"DROP FUNCTION IF EXISTS brand_search_vectors()",
+		"DROP FUNCTION IF EXISTS product_search_vector()",
+		"DROP INDEX IF EXISTS idx_marketplace_products_name_trgm",
+		"DROP INDEX IF EXISTS idx_reports_name_trgm",
+		// their GIN indexes go with them
+		"ALTER TABLE products DROP COLUMN IF EXISTS search_vector",
+		"ALTER TABLE marketplace_products DROP COLUMN IF EXISTS search_vector",
+		"ALTER TABLE reports DROP COLUMN IF EXISTS search_vector",
+	}
+}
+
+// ProductTranslationSearchVector is the SQL generating the search vector of
+// a translation, stemmed in the configuration of its language and weighted
+// like the vectors of products. The configurations are constants so the
+// expression is immutable, as generated columns require.
+func ProductTranslationSearchVector() string {
+	var b strings.Builder
+	b.WriteString("CASE language")
+	for _, code := range locale.Codes() {
+		b.WriteString(" WHEN " + quoteLiteral(code) + " THEN " + quoteLiteral(locale.Config(code)) + "::regconfig")
+	}
+	b.WriteString(" ELSE 'simple'::regconfig END")
+
+	config := b.String()
+	return weighted(config, "name", "A") + " || " + weighted(config, "description", "C")
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// Kinds of autocomplete suggestions
+const (
+	SuggestionProduct  = "product"
+	SuggestionBrand    = "brand"
+	SuggestionCategory = "category"
+	// SuggestionRecent is a recent search of the user, its ID is that of
+	// the search history entry
+	SuggestionRecent = "recent"
+)
+
+// SuggestionTypes lists the kinds of suggestions in the order they are indexed
+var SuggestionTypes = []string{SuggestionProduct, SuggestionBrand, SuggestionCategory}
+
+// suggestionSources select the type, id, text and popularity of every
+// suggestion of a kind. Brands and categories are as popular as the number
+// of products they have.
+var suggestionSources = map[string]string{
+	SuggestionProduct: `SELECT 'product' AS type, id, coalesce(name, '') AS text, 1 AS popularity
+		FROM products WHERE deleted_at IS NULL`,
+	SuggestionBrand: `SELECT 'brand' AS type, b.id, coalesce(b.name, '') AS text,
+		(SELECT count(*) FROM products p WHERE p.brand_id = b.id AND p.deleted_at IS NULL) AS popularity
+		FROM brands b WHERE b.deleted_at IS NULL`,
+	SuggestionCategory: `SELECT 'category' AS type, c.id, coalesce(c.name, '') AS text,
+		(SELECT count(*) FROM products p WHERE p.category_id = c.id AND p.deleted_at IS NULL) AS popularity
+		FROM categories c WHERE c.deleted_at IS NULL`,
+}
+
+// Suggestion is a completion candidate.
+type Suggestion struct {
+	Type       string  `json:"type"`
+	ID         uint    `json:"id"`
+	Text       string  `json:"text"`
+	Popularity float64 `json:"popularity"`
+	// Set by SuggestFromCatalogue only
+	PrefixMatch bool    `json:"-"`
+	Similarity  float64 `json:"-"`
+}
+
+// SuggestionsByID loads the suggestions of a kind with the given IDs.
+func SuggestionsByID(db *gorm.DB, kind string, ids []uint) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	err := db.Raw("SELECT * FROM ("+suggestionSources[kind]+") AS s WHERE s.id IN ?", ids).Scan(&suggestions).Error
+	return suggestions, err
+}
+
+// SuggestionsAfter loads up to limit suggestions of a kind with an ID
+// greater than afterID, in ID order, to walk the catalogue in batches.
+func SuggestionsAfter(db *gorm.DB, kind string, afterID uint, limit int) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	err := db.Raw("SELECT * FROM ("+suggestionSources[kind]+") AS s WHERE s.id > ? ORDER BY s.id LIMIT ?", afterID, limit).Scan(&suggestions).Error
+	return suggestions, err
+}
+
+// SuggestFromCatalogue finds products, brands and categories whose name
+// has a word starting with every word of term, or that are similar to term
+// by trigrams, so misspelt input still completes.
+func SuggestFromCatalogue(ctx context.Context, db *gorm.DB, term string, limit int) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+
+	prefix := query.PrefixTSQuery(term)
+	if prefix == "" {
+		return suggestions, nil
+	}
+
+	sql := ""
+	for i, kind := range SuggestionTypes {
+		if i > 0 {
+			sql += " UNION ALL "
+		}
+		sql += `SELECT s.*,
+			to_tsvector('simple', s.text) @@ to_tsquery('simple', @prefix) AS prefix_match,
+			similarity(s.text, @term) AS similarity
+			FROM (` + suggestionSources[kind] + `) AS s
+			WHERE to_tsvector('simple', s.text) @@ to_tsquery('simple', @prefix) OR s.text % @term`
+	}
+	sql = "SELECT * FROM (" + sql + ") AS m ORDER BY m.prefix_match DESC, m.similarity DESC, m.popularity DESC LIMIT @limit"
+
+	err := db.WithContext(ctx).Raw(sql, map[string]interface{}{
+		"prefix": prefix,
+		"term":   term,
+		"limit":  limit,
+	}).Scan(&suggestions).Error
+
+	return suggestions, err
+}
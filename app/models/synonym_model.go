@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// SynonymGroup is a set of terms searches treat as equivalent, e.g.
+// "eco-friendly" and "sustainable".
+type SynonymGroup struct {
+	gorm.Model
+	Terms StringList `gorm:"type:jsonb;not null" json:"terms"`
+}
+
+type CreateSynonymGroup struct {
+	Terms []string `json:"terms" validate:"required,min=2,max=20,dive,required,max=64"`
+}
+
+// VocabularyWord is a word of the catalogue and the number of records it
+// appears in, the dictionary of the spelling correction.
+type VocabularyWord struct {
+	Word      string `gorm:"type:varchar(64);primaryKey" json:"word"`
+	Frequency int    `gorm:"not null" json:"frequency"`
+}
+
+// SpellingSuggestion tells the client a search term was corrected, or that
+// a correction exists.
+type SpellingSuggestion struct {
+	// Corrected is true when the results are for Query rather than Original
+	Corrected bool   `json:"corrected"`
+	Query     string `json:"query"`
+	Original  string `json:"original"`
+}
+
+// LoadSynonyms maps every normalized term of every synonym group to the
+// terms of its group.
+func LoadSynonyms(ctx context.Context, db *gorm.DB) (map[string][]string, error) {
+	var groups []SynonymGroup
+	if err := db.WithContext(ctx).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	synonyms := map[string][]string{}
+	for _, group := range groups {
+		for _, term := range group.Terms {
+			key := strings.Join(query.Normalize(term), " ")
+			if key != "" {
+				synonyms[key] = append(synonyms[key], group.Terms...)
+			}
+		}
+	}
+	return synonyms, nil
+}
+
+// RefreshVocabulary rebuilds the vocabulary from the names and descriptions
+// of the catalogue.
+func RefreshVocabulary(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM vocabulary_words").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO vocabulary_words (word, frequency)
+			SELECT word, ndoc FROM ts_stat($$
+				SELECT to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, '')) FROM products WHERE deleted_at IS NULL
+				UNION ALL SELECT to_tsvector('simple', coalesce(name, '')) FROM brands WHERE deleted_at IS NULL
+				UNION ALL SELECT to_tsvector('simple', coalesce(name, '')) FROM categories WHERE deleted_at IS NULL
+			$$)
+			WHERE length(word) BETWEEN 2 AND 64`).Error
+	})
+}
+
+// KnownWords returns which of words are in the vocabulary.
+func KnownWords(ctx context.Context, db *gorm.DB, words []string) (map[string]bool, error) {
+	known := map[string]bool{}
+	if len(words) == 0 {
+		return known, nil
+	}
+
+	var found []string
+	if err := db.WithContext(ctx).Model(&VocabularyWord{}).Where("word IN ?", words).Pluck("word", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, word := range found {
+		known[word] = true
+	}
+	return known, nil
+}
+
+// SimilarWords returns up to limit vocabulary words sharing trigrams with
+// word, most similar and then most frequent first.
+func SimilarWords(ctx context.Context, db *gorm.DB, word string, limit int) ([]string, error) {
+	var words []string
+	err := db.WithContext(ctx).
+		Raw("SELECT word FROM vocabulary_words WHERE word % ? ORDER BY similarity(word, ?) DESC, frequency DESC LIMIT ?", word, word, limit).
+		Scan(&words).
+		Error
+	return words, err
+}
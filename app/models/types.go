@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList is a list of strings stored as a jsonb array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, (*[]string)(l))
+}
+
+func (l StringList) Contains(s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// UintList is a list of IDs stored as a jsonb array.
+type UintList []uint
+
+func (l UintList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]uint(l))
+	return string(data), err
+}
+
+func (l *UintList) Scan(value interface{}) error {
+	return scanJSON(value, (*[]uint)(l))
+}
+
+func (l UintList) Contains(id uint) bool {
+	for _, v := range l {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", value, dest)
+	}
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// Types of the results of the unified search
+const (
+	SearchTypeProduct            = "product"
+	SearchTypeMarketplaceProduct = "marketplace_product"
+	SearchTypeReport             = "report"
+	SearchTypeBrand              = "brand"
+	SearchTypeCategory           = "category"
+)
+
+// SearchTypes lists the unified search types in the order their results
+// win ties.
+var SearchTypes = []string{
+	SearchTypeProduct,
+	SearchTypeMarketplaceProduct,
+	SearchTypeReport,
+	SearchTypeBrand,
+	SearchTypeCategory,
+}
+
+// UnifiedQuery are the parser options of the unified search, a source that
+// does not support a field of the query is left out of it.
+var UnifiedQuery = query.Options{Fields: []string{"brand", "category", "tag"}}
+
+// ErrSearchTypeNotSupported is returned by SearchType for a query with a
+// field the type cannot be filtered by.
+var ErrSearchTypeNotSupported = errors.New("search type does not support the query fields")
+
+// searchSource describes the table of a unified search type, its text and
+// the SQL of its result title and description.
+type searchSource struct {
+	table       string
+	text        textDocument
+	title       string
+	description string
+	filters     map[string]string
+}
+
+var searchSources = map[string]searchSource{
+	SearchTypeProduct: {
+		table:       "products",
+		text:        productText,
+		title:       "coalesce(name, '')",
+		description: "coalesce(description, '')",
+		filters:     productFilters,
+	},
+	SearchTypeMarketplaceProduct: {
+		table:       "marketplace_products",
+		text:        marketplaceText,
+		title:       "coalesce(name, '')",
+		description: "coalesce(description, '')",
+		filters:     marketplaceProductFilters,
+	},
+	SearchTypeReport: {
+		table:       "reports",
+		text:        reportText,
+		title:       "coalesce(name, '')",
+		description: "coalesce(summary, '')",
+	},
+	SearchTypeBrand: {
+		table:       "brands",
+		text:        textDocument{document: "coalesce(name, '')"},
+		title:       "coalesce(name, '')",
+		description: "''",
+		filters:     map[string]string{"brand": "lower(name) IN ?"},
+	},
+	SearchTypeCategory: {
+		table:       "categories",
+		text:        textDocument{document: "coalesce(name, '') || ' ' || coalesce(description, '')"},
+		title:       "coalesce(name, '')",
+		description: "coalesce(description, '')",
+		filters:     map[string]string{"category": "lower(name) IN ?"},
+	},
+}
+
+// SearchHit is a result of the unified search.
+type SearchHit struct {
+	Type        string `json:"type"`
+	ID          uint   `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Score is the text rank of the hit relative to the best hit of every
+	// type searched, in [0, 1], see NormalizeScores
+	Score float64 `json:"score"`
+}
+
+// SearchTypeHits are the best hits of a type and the number of rows of the
+// type that matched in total.
+type SearchTypeHits struct {
+	Type  string      `json:"type"`
+	Hits  []SearchHit `json:"hits"`
+	Total int64       `json:"total"`
+}
+
+// SearchType returns the limit best hits of a unified search type, scored
+// with their text rank until NormalizeScores.
+func SearchType(ctx context.Context, db *gorm.DB, kind string, q *query.Query, limit int) (*SearchTypeHits, error) {
+	source, ok := searchSources[kind]
+	if !ok {
+		return nil, ErrSearchTypeNotSupported
+	}
+	for _, filter := range q.Filters {
+		if _, ok := source.filters[filter.Field]; !ok {
+			return nil, ErrSearchTypeNotSupported
+		}
+	}
+
+	tx, err := matchQuery(db.WithContext(ctx).Table(source.table).Where("deleted_at IS NULL"), q, source.text, source.filters)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SearchTypeHits{Type: kind, Hits: []SearchHit{}}
+	if err := tx.Session(&gorm.Session{}).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID          uint
+		Title       string
+		Description string
+		Rank        float64
+	}
+	tx = selectRank(tx, q, source.text, source.title+" AS title", source.description+" AS description")
+	if q.HasText() {
+		tx = tx.Order("rank DESC")
+	}
+	if err := tx.Order("id DESC").Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// products are returned in the language of the search where translated
+	translations := map[uint]ProductTranslation{}
+	if kind == SearchTypeProduct {
+		ids := make([]uint, len(rows))
+		for i, row := range rows {
+			ids[i] = row.ID
+		}
+		if translations, err = productTranslations(db.WithContext(ctx), ids, q.Language); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range rows {
+		hit := SearchHit{Type: kind, ID: row.ID, Title: row.Title, Description: row.Description, Score: row.Rank}
+		if translation, ok := translations[row.ID]; ok {
+			hit.Title = translation.Name
+			if translation.Description != "" {
+				hit.Description = translation.Description
+			}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+
+	return result, nil
+}
+
+// NormalizeScores divides the scores of the hits of groups by the best one
+// of every group, so a type whose best hit barely matched does not score
+// as high as the best hit of another type. Without a better hit, as when
+// the search has no text, every hit scores 1.
+func NormalizeScores(groups []*SearchTypeHits) {
+	best := 0.0
+	for _, group := range groups {
+		for _, hit := range group.Hits {
+			best = math.Max(best, hit.Score)
+		}
+	}
+
+	for _, group := range groups {
+		for i := range group.Hits {
+			if best > 0 {
+				group.Hits[i].Score /= best
+			} else {
+				group.Hits[i].Score = 1
+			}
+		}
+	}
+}
+
+// UnifiedSearchPage is the answer of the unified search, with either the
+// hits of all types merged by score or grouped by type.
+type UnifiedSearchPage struct {
+	// SearchID identifies the search for click recording
+	SearchID string            `json:"search_id"`
+	Query    string            `json:"query"`
+	Results  []SearchHit       `json:"results,omitempty"`
+	Groups   []*SearchTypeHits `json:"groups,omitempty"`
+	Totals   map[string]int64  `json:"totals"`
+	// Partial is true when some types did not answer in time or failed
+	Partial  bool     `json:"partial"`
+	Warnings []string `json:"warnings,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestNormalizeScores(t *testing.T) {
+	products := &SearchTypeHits{Type: SearchTypeProduct, Hits: []SearchHit{{ID: 1, Score: 0.8}, {ID: 2, Score: 0.4}}}
+	brands := &SearchTypeHits{Type: SearchTypeBrand, Hits: []SearchHit{{ID: 3, Score: 0.1}}}
+	NormalizeScores([]*SearchTypeHits{products, brands})
+
+	// the weak match of the brands does not score as the best product
+	for _, tt := range []struct {
+		hit  SearchHit
+		want float64
+	}{
+		{products.Hits[0], 1},
+		{products.Hits[1], 0.5},
+		{brands.Hits[0], 0.125},
+	} {
+		if tt.hit.Score != tt.want {
+			t.Errorf("score of %d = %v, want %v", tt.hit.ID, tt.hit.Score, tt.want)
+		}
+	}
+
+	// without text nothing ranks
+	reports := &SearchTypeHits{Type: SearchTypeReport, Hits: []SearchHit{{ID: 4}}}
+	NormalizeScores([]*SearchTypeHits{reports})
+	if reports.Hits[0].Score != 1 {
+		t.Errorf("score without a rank = %v, want 1", reports.Hits[0].Score)
+	}
+}
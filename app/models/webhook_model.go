@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Events partners can subscribe to
+const (
+	WebhookEventProductUpdated = "product.updated"
+	WebhookEventEPDPublished   = "epd.published"
+	WebhookEventScoreChanged   = "score.changed"
+	// WebhookEventTest is only sent by the "send test event" endpoint
+	WebhookEventTest = "webhook.test"
+)
+
+// WebhookEvents lists the events a subscription can filter on
+var WebhookEvents = []string{WebhookEventProductUpdated, WebhookEventEPDPublished, WebhookEventScoreChanged}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+	// DeliveryCancelled deliveries were pending when their subscription
+	// was deleted
+	DeliveryCancelled = "cancelled"
+)
+
+// WebhookSubscription is an HTTPS endpoint a partner registered to receive
+// events on.
+type WebhookSubscription struct {
+	gorm.Model
+	UserID uint       `gorm:"not null;index" json:"user_id"`
+	URL    string     `gorm:"type:varchar(2048);not null" json:"url"`
+	Secret string     `gorm:"type:varchar(128);not null" json:"-"`
+	Events StringList `gorm:"type:jsonb;not null" json:"events"`
+	// ProductIDs limits deliveries to these products, empty means all products
+	ProductIDs          UintList   `gorm:"type:jsonb" json:"product_ids"`
+	Active              bool       `gorm:"not null;default:true" json:"active"`
+	ConsecutiveFailures int        `gorm:"not null;default:0" json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+}
+
+// Matches reports whether the subscription wants eventType for productID.
+func (s *WebhookSubscription) Matches(eventType string, productID uint) bool {
+	if !s.Active || !s.Events.Contains(eventType) {
+		return false
+	}
+	return len(s.ProductIDs) == 0 || s.ProductIDs.Contains(productID)
+}
+
+// WebhookDelivery is one event to be delivered to one subscription.
+type WebhookDelivery struct {
+	gorm.Model
+	SubscriptionID uint            `gorm:"not null;uniqueIndex:idx_webhook_delivery_event,priority:1" json:"subscription_id"`
+	EventID        string          `gorm:"type:varchar(64);not null;uniqueIndex:idx_webhook_delivery_event,priority:2" json:"event_id"`
+	EventType      string          `gorm:"type:varchar(64);not null" json:"event_type"`
+	Payload        json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Status         string          `gorm:"type:varchar(16);not null;index" json:"status"`
+	Attempts       int             `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time       `gorm:"not null;index" json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// WebhookAttempt logs a single HTTP request made for a delivery.
+type WebhookAttempt struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	DeliveryID  uint      `gorm:"not null;index" json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// WebhookPayload is the JSON body posted to partner endpoints.
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type CreateWebhook struct {
+	URL        string   `json:"url" validate:"required,url,lte=2048"`
+	Events     []string `json:"events" validate:"required,min=1,dive,oneof=product.updated epd.published score.changed"`
+	ProductIDs []uint   `json:"product_ids"`
+}
@@ -0,0 +1,571 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// memoryStore holds the records of the in-memory repositories. Records are
+// copied in and out so callers never share them with the store.
+type memoryStore struct {
+	mu     sync.Mutex
+	nextID uint
+
+	users        map[uint]models.User
+	products     map[uint]models.Product
+	marketplace  map[uint]models.MarketPlaceProduct
+	translations map[uint]map[string]models.ProductTranslation
+	epds         map[uint]models.EnvironmentalProductDeclaration
+	reports      map[uint]models.Report
+	images       map[uint]models.UploadedImage
+}
+
+// NewMemory returns repositories kept in memory, for tests and local runs.
+// They do not record outbox events.
+func NewMemory() *Repositories {
+	s := &memoryStore{
+		users:        map[uint]models.User{},
+		products:     map[uint]models.Product{},
+		marketplace:  map[uint]models.MarketPlaceProduct{},
+		translations: map[uint]map[string]models.ProductTranslation{},
+		epds:         map[uint]models.EnvironmentalProductDeclaration{},
+		reports:      map[uint]models.Report{},
+		images:       map[uint]models.UploadedImage{},
+	}
+	return &Repositories{
+		Users:    &memoryUsers{s},
+		Products: &memoryProducts{s},
+		EPDs:     &memoryEPDs{s},
+		Reports:  &memoryReports{s},
+		Images:   &memoryImages{s},
+	}
+}
+
+// newModel returns the gorm.Model of a new record.
+func (s *memoryStore) newModel() gorm.Model {
+	s.nextID++
+	now := time.Now()
+	return gorm.Model{ID: s.nextID, CreatedAt: now, UpdatedAt: now}
+}
+
+// sortedIDs returns the keys of records in ascending order.
+func sortedIDs[T any](records map[uint]T) []uint {
+	ids := make([]uint, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// page returns the records from offset, by ID, at most limit of them.
+func page[T any](records map[uint]T, offset, limit int) []T {
+	ids := sortedIDs(records)
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	ids = ids[offset:]
+	if limit >= 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	result := make([]T, len(ids))
+	for i, id := range ids {
+		result[i] = records[id]
+	}
+	return result
+}
+
+type memoryUsers struct {
+	*memoryStore
+}
+
+// emailTaken tells whether a user other than id has email.
+func (s *memoryUsers) emailTaken(email string, id uint) bool {
+	for _, user := range s.users {
+		if user.ID != id && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	if err := validate(user); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.emailTaken(user.Email, 0) {
+		return fmt.Errorf("%w: email %s is taken", ErrConflict, user.Email)
+	}
+
+	model := s.newModel()
+	user.Model = model
+	user.CreatedAt, user.UpdatedAt = model.CreatedAt, model.UpdatedAt
+	stored := *user
+	stored.UploadedImages, stored.VisitedProducts, stored.VisitedPages, stored.SearchHistory = nil, nil, nil, nil
+	s.users[user.ID] = stored
+	return nil
+}
+
+func (s *memoryUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *memoryUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sortedIDs(s.users) {
+		if user := s.users[id]; strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryUsers) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return page(s.users, offset, limit), nil
+}
+
+func (s *memoryUsers) Update(ctx context.Context, id uint, update *models.UserUpdate) error {
+	return s.update(id, func(user *models.User) error {
+		if update.Email != "" {
+			if s.emailTaken(update.Email, id) {
+				return fmt.Errorf("%w: email %s is taken", ErrConflict, update.Email)
+			}
+			user.Email = update.Email
+		}
+		if update.Username != "" {
+			user.Username = update.Username
+		}
+		if update.FirstName != "" {
+			user.FirstName = update.FirstName
+		}
+		if update.LastName != "" {
+			user.LastName = update.LastName
+		}
+		if update.AvatarURL != "" {
+			user.AvatarURL = update.AvatarURL
+		}
+		return nil
+	})
+}
+
+func (s *memoryUsers) SetPassword(ctx context.Context, id uint, passwordHash string) error {
+	return s.update(id, func(user *models.User) error {
+		user.PasswordHash = passwordHash
+		return nil
+	})
+}
+
+func (s *memoryUsers) SetRole(ctx context.Context, id uint, role string) error {
+	return s.update(id, func(user *models.User) error {
+		user.UserRole = role
+		return nil
+	})
+}
+
+// update applies fn to the user with the given ID.
+func (s *memoryUsers) update(id uint, fn func(user *models.User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := fn(&user); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *memoryUsers) Delete(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+type memoryProducts struct {
+	*memoryStore
+}
+
+// loaded returns a stored product as gorm loads it.
+func loaded(product models.Product) models.Product {
+	if product.EcoScore != nil {
+		score := *product.EcoScore
+		product.EcoScore = &score
+		product.EcoGrade = models.EcoGradeFor(score)
+	}
+	product.Images = append([]models.ProductImage(nil), product.Images...)
+	return product
+}
+
+func (s *memoryProducts) Create(ctx context.Context, product *models.Product) error {
+	if err := validate(product); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	product.Model = s.newModel()
+	for i := range product.Images {
+		product.Images[i].Model = s.newModel()
+		product.Images[i].ProductID = int(product.ID)
+	}
+
+	// the EPD and reports of the product are stored like gorm saves its
+	// associations
+	if product.EPD.Description != "" || len(product.EPD.LCAMetrics) > 0 {
+		product.EPD.ProductID = product.ID
+		s.saveEPD(&product.EPD)
+	}
+	for i := range product.Reports {
+		product.Reports[i].Model = s.newModel()
+		product.Reports[i].EPDID = product.ID
+		s.reports[product.Reports[i].ID] = product.Reports[i]
+	}
+
+	stored := loaded(*product)
+	stored.EPD, stored.Reports, stored.Translations = models.EnvironmentalProductDeclaration{}, nil, nil
+	s.products[product.ID] = stored
+	return nil
+}
+
+func (s *memoryProducts) CreateMarketplace(ctx context.Context, product *models.MarketPlaceProduct) error {
+	if err := validate(product); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	product.Model = s.newModel()
+	product.Product.Model = product.Model
+	s.marketplace[product.Model.ID] = *product
+	return nil
+}
+
+func (s *memoryProducts) Update(ctx context.Context, id uint, product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.products[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// like gorm's Updates, only the non-zero fields are written
+	if product.Name != "" {
+		stored.Name = product.Name
+	}
+	if product.BrandID != 0 {
+		stored.BrandID = product.BrandID
+	}
+	if product.Barcode != "" {
+		stored.Barcode = product.Barcode
+	}
+	if product.Description != "" {
+		stored.Description = product.Description
+	}
+	if product.Price != 0 {
+		stored.Price = product.Price
+	}
+	if product.Link != "" {
+		stored.Link = product.Link
+	}
+	if product.CategoryID != 0 {
+		stored.CategoryID = product.CategoryID
+	}
+	if product.EcoScore != nil {
+		stored.EcoScore = product.EcoScore
+	}
+	stored.UpdatedAt = time.Now()
+	s.products[id] = loaded(stored)
+	return nil
+}
+
+func (s *memoryProducts) Get(ctx context.Context, id uint) (*models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	product := loaded(stored)
+	if epd, ok := s.epdOf(id); ok {
+		product.EPD = epd
+	}
+	product.Reports = s.reportsOf(id)
+	return &product, nil
+}
+
+func (s *memoryProducts) List(ctx context.Context, offset, limit int, language string) ([]models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	products := page(s.products, offset, limit)
+	translations := map[uint]models.ProductTranslation{}
+	for i := range products {
+		products[i] = loaded(products[i])
+		products[i].Images = nil
+		if translation, ok := s.translations[products[i].ID][language]; ok && language != models.DefaultLanguage {
+			translations[products[i].ID] = translation
+		}
+	}
+	models.ApplyTranslations(products, translations)
+	return products, nil
+}
+
+func (s *memoryProducts) Exists(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[id]; !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *memoryProducts) Translations(ctx context.Context, id uint) ([]models.ProductTranslation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	translations := []models.ProductTranslation{}
+	for _, translation := range s.translations[id] {
+		translations = append(translations, translation)
+	}
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Language < translations[j].Language })
+	return translations, nil
+}
+
+func (s *memoryProducts) PutTranslation(ctx context.Context, translation *models.ProductTranslation) error {
+	if err := validate(translation); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[translation.ProductID]; !ok {
+		return &ValidationError{Err: fmt.Errorf("product %d does not exist", translation.ProductID)}
+	}
+	translation.UpdatedAt = time.Now()
+	if s.translations[translation.ProductID] == nil {
+		s.translations[translation.ProductID] = map[string]models.ProductTranslation{}
+	}
+	s.translations[translation.ProductID][translation.Language] = *translation
+	return nil
+}
+
+func (s *memoryProducts) DeleteTranslation(ctx context.Context, id uint, language string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.translations[id][language]; !ok {
+		return ErrNotFound
+	}
+	delete(s.translations[id], language)
+	return nil
+}
+
+// epdOf returns the EPD of a product.
+func (s *memoryStore) epdOf(productID uint) (models.EnvironmentalProductDeclaration, bool) {
+	for _, id := range sortedIDs(s.epds) {
+		if epd := s.epds[id]; epd.ProductID == productID {
+			epd.LCAMetrics = append([]models.LCAMetrics(nil), epd.LCAMetrics...)
+			return epd, true
+		}
+	}
+	return models.EnvironmentalProductDeclaration{}, false
+}
+
+// reportsOf returns the reports of a product, oldest first.
+func (s *memoryStore) reportsOf(productID uint) []models.Report {
+	reports := []models.Report{}
+	for _, id := range sortedIDs(s.reports) {
+		if report := s.reports[id]; report.EPDID == productID {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// saveEPD stores epd as the EPD of its product, replacing the one it had,
+// and tells whether it had none.
+func (s *memoryStore) saveEPD(epd *models.EnvironmentalProductDeclaration) bool {
+	existing, found := s.epdOf(epd.ProductID)
+	if found {
+		epd.Model = existing.Model
+		epd.UpdatedAt = time.Now()
+	} else {
+		epd.Model = s.newModel()
+	}
+	for i := range epd.LCAMetrics {
+		epd.LCAMetrics[i].Model = s.newModel()
+		epd.LCAMetrics[i].EPDID = epd.ID
+	}
+
+	stored := *epd
+	stored.LCAMetrics = append([]models.LCAMetrics(nil), epd.LCAMetrics...)
+	s.epds[epd.ID] = stored
+	return !found
+}
+
+type memoryEPDs struct {
+	*memoryStore
+}
+
+func (s *memoryEPDs) Save(ctx context.Context, epd *models.EnvironmentalProductDeclaration) (bool, error) {
+	if err := validate(epd); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[epd.ProductID]; !ok {
+		return false, &ValidationError{Err: fmt.Errorf("product %d does not exist", epd.ProductID)}
+	}
+	return s.saveEPD(epd), nil
+}
+
+func (s *memoryEPDs) Get(ctx context.Context, id uint) (*models.EnvironmentalProductDeclaration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	epd, ok := s.epds[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	epd.LCAMetrics = append([]models.LCAMetrics(nil), epd.LCAMetrics...)
+	return &epd, nil
+}
+
+func (s *memoryEPDs) GetByProduct(ctx context.Context, productID uint) (*models.EnvironmentalProductDeclaration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	epd, ok := s.epdOf(productID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &epd, nil
+}
+
+func (s *memoryEPDs) Delete(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.epds[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.epds, id)
+	return nil
+}
+
+type memoryReports struct {
+	*memoryStore
+}
+
+func (s *memoryReports) Create(ctx context.Context, report *models.Report) error {
+	if err := validate(report); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[report.EPDID]; !ok {
+		return &ValidationError{Err: fmt.Errorf("product %d does not exist", report.EPDID)}
+	}
+	report.Model = s.newModel()
+	s.reports[report.ID] = *report
+	return nil
+}
+
+func (s *memoryReports) Get(ctx context.Context, id uint) (*models.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, ok := s.reports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &report, nil
+}
+
+func (s *memoryReports) ListByProduct(ctx context.Context, productID uint) ([]models.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reportsOf(productID), nil
+}
+
+func (s *memoryReports) Delete(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reports[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.reports, id)
+	return nil
+}
+
+type memoryImages struct {
+	*memoryStore
+}
+
+func (s *memoryImages) Create(ctx context.Context, image *models.UploadedImage) error {
+	if err := validate(image); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	image.Model = s.newModel()
+	s.images[image.ID] = *image
+	return nil
+}
+
+func (s *memoryImages) Get(ctx context.Context, id uint) (*models.UploadedImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	image, ok := s.images[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &image, nil
+}
+
+func (s *memoryImages) ListByUser(ctx context.Context, userID uint) ([]models.UploadedImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images := []models.UploadedImage{}
+	for _, id := range sortedIDs(s.images) {
+		if image := s.images[id]; image.UserID == userID {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (s *memoryImages) Delete(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.images, id)
+	return nil
+}
@@ -0,0 +1,403 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// SQLSTATE codes of the constraint violations, class 22 are data
+// exceptions like a value too long for its column
+const (
+	notNullViolation    = "23502"
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+	checkViolation      = "23514"
+	dataException       = "22"
+)
+
+// NewPostgres returns the repositories stored in db, which may be a
+// transaction. The product writes record their events in the outbox in the
+// same transaction.
+func NewPostgres(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Users:    &postgresUsers{db: db},
+		Products: &postgresProducts{db: db},
+		EPDs:     &postgresEPDs{db: db},
+		Reports:  &postgresReports{db: db},
+		Images:   &postgresImages{db: db},
+	}
+}
+
+// mapError turns the errors of gorm and Postgres into those of the package.
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return &ValidationError{Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == uniqueViolation:
+			return fmt.Errorf("%w: %s", ErrConflict, pgErr.Detail)
+		case pgErr.Code == foreignKeyViolation, pgErr.Code == notNullViolation, pgErr.Code == checkViolation,
+			strings.HasPrefix(pgErr.Code, dataException):
+			return &ValidationError{Err: err}
+		}
+	}
+	return err
+}
+
+// affected returns ErrNotFound when a write matched no row.
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return mapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// userColumns are the columns written and read for users, the JSON columns
+// of the model are left alone
+var (
+	userColumns     = []string{"CreatedAt", "UpdatedAt", "Email", "Username", "FirstName", "LastName", "AvatarURL", "PasswordHash", "UserStatus", "UserRole"}
+	userReadColumns = []string{"id", "created_at", "updated_at", "deleted_at", "email", "username", "first_name", "last_name", "avatar_url", "password_hash", "user_status", "user_role"}
+)
+
+type postgresUsers struct {
+	db *gorm.DB
+}
+
+func (r *postgresUsers) Create(ctx context.Context, user *models.User) error {
+	if err := validate(user); err != nil {
+		return err
+	}
+	return mapError(r.db.WithContext(ctx).Select(userColumns).Create(user).Error)
+}
+
+func (r *postgresUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Select(userReadColumns).First(&user, id).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *postgresUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Select(userReadColumns).Where("lower(email) = lower(?)", email).First(&user).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *postgresUsers) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	users := []models.User{}
+	err := r.db.WithContext(ctx).Select(userReadColumns).Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	return users, mapError(err)
+}
+
+func (r *postgresUsers) Update(ctx context.Context, id uint, update *models.UserUpdate) error {
+	return r.update(ctx, id, update)
+}
+
+func (r *postgresUsers) SetPassword(ctx context.Context, id uint, passwordHash string) error {
+	return r.update(ctx, id, map[string]interface{}{"password_hash": passwordHash})
+}
+
+func (r *postgresUsers) SetRole(ctx context.Context, id uint, role string) error {
+	return r.update(ctx, id, map[string]interface{}{"user_role": role})
+}
+
+// update writes the columns of a user that exists, unchanged values are not
+// mistaken for a missing user.
+func (r *postgresUsers) update(ctx context.Context, id uint, values interface{}) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id").First(&user, id).Error; err != nil {
+			return mapError(err)
+		}
+		return mapError(tx.Model(&user).Updates(values).Error)
+	})
+}
+
+func (r *postgresUsers) Delete(ctx context.Context, id uint) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.User{}, id))
+}
+
+type postgresProducts struct {
+	db *gorm.DB
+}
+
+func (r *postgresProducts) Create(ctx context.Context, product *models.Product) error {
+	if err := validate(product); err != nil {
+		return err
+	}
+	return mapError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		return models.RecordProductEvents(tx, models.AggregateProduct, product.ID, models.EventProductCreated, product)
+	}))
+}
+
+func (r *postgresProducts) CreateMarketplace(ctx context.Context, product *models.MarketPlaceProduct) error {
+	if err := validate(product); err != nil {
+		return err
+	}
+	return mapError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		return models.RecordProductEvents(tx, models.AggregateMarketPlaceProduct, product.ID, models.EventProductCreated, &product.Product)
+	}))
+}
+
+func (r *postgresProducts) Update(ctx context.Context, id uint, product *models.Product) error {
+	return mapError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.Product
+		if err := tx.Select("id").First(&existing, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&existing).Updates(product).Error; err != nil {
+			return err
+		}
+		product.UpdatedAt = existing.UpdatedAt
+		return models.RecordProductEvents(tx, models.AggregateProduct, id, models.EventProductUpdated, product)
+	}))
+}
+
+func (r *postgresProducts) Get(ctx context.Context, id uint) (*models.Product, error) {
+	var product models.Product
+	err := r.db.WithContext(ctx).Preload("Images").Preload("EPD.LCAMetrics").Preload("Reports").First(&product, id).Error
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &product, nil
+}
+
+func (r *postgresProducts) List(ctx context.Context, offset, limit int, language string) ([]models.Product, error) {
+	db := r.db.WithContext(ctx)
+
+	products := []models.Product{}
+	if err := db.Order("id").Offset(offset).Limit(limit).Find(&products).Error; err != nil {
+		return nil, mapError(err)
+	}
+	if err := models.LocalizeProducts(db, products, language); err != nil {
+		return nil, mapError(err)
+	}
+	return products, nil
+}
+
+func (r *postgresProducts) Exists(ctx context.Context, id uint) error {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return mapError(err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresProducts) Translations(ctx context.Context, id uint) ([]models.ProductTranslation, error) {
+	translations := []models.ProductTranslation{}
+	err := r.db.WithContext(ctx).Where("product_id = ?", id).Order("language").Find(&translations).Error
+	return translations, mapError(err)
+}
+
+func (r *postgresProducts) PutTranslation(ctx context.Context, translation *models.ProductTranslation) error {
+	if err := validate(translation); err != nil {
+		return err
+	}
+	translation.UpdatedAt = time.Now()
+	return mapError(r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(translation).Error)
+}
+
+func (r *postgresProducts) DeleteTranslation(ctx context.Context, id uint, language string) error {
+	return affected(r.db.WithContext(ctx).Where("product_id = ? AND language = ?", id, language).Delete(&models.ProductTranslation{}))
+}
+
+type postgresEPDs struct {
+	db *gorm.DB
+}
+
+func (r *postgresEPDs) Save(ctx context.Context, epd *models.EnvironmentalProductDeclaration) (bool, error) {
+	if err := validate(epd); err != nil {
+		return false, err
+	}
+
+	var created bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		product, err := epdProduct(tx, epd.ProductID)
+		if err != nil {
+			return err
+		}
+
+		var existing models.EnvironmentalProductDeclaration
+		result := tx.Where("product_id = ?", epd.ProductID).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected == 0
+		epd.ID, epd.CreatedAt = existing.ID, existing.CreatedAt
+
+		if err := tx.Omit(clause.Associations).Save(epd).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("epd_id = ?", epd.ID).Delete(&models.LCAMetrics{}).Error; err != nil {
+			return err
+		}
+		for i := range epd.LCAMetrics {
+			epd.LCAMetrics[i].ID = 0
+			epd.LCAMetrics[i].EPDID = epd.ID
+		}
+		if len(epd.LCAMetrics) > 0 {
+			if err := tx.Create(&epd.LCAMetrics).Error; err != nil {
+				return err
+			}
+		}
+		return recordEPDChanged(tx, product, epd.UpdatedAt)
+	})
+	return created, mapError(err)
+}
+
+func (r *postgresEPDs) Get(ctx context.Context, id uint) (*models.EnvironmentalProductDeclaration, error) {
+	var epd models.EnvironmentalProductDeclaration
+	if err := r.db.WithContext(ctx).Preload("LCAMetrics").First(&epd, id).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &epd, nil
+}
+
+func (r *postgresEPDs) GetByProduct(ctx context.Context, productID uint) (*models.EnvironmentalProductDeclaration, error) {
+	var epd models.EnvironmentalProductDeclaration
+	if err := r.db.WithContext(ctx).Preload("LCAMetrics").Where("product_id = ?", productID).First(&epd).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &epd, nil
+}
+
+func (r *postgresEPDs) Delete(ctx context.Context, id uint) error {
+	return mapError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var epd models.EnvironmentalProductDeclaration
+		if err := tx.Select("id", "product_id").First(&epd, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("epd_id = ?", epd.ID).Delete(&models.LCAMetrics{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&epd).Error; err != nil {
+			return err
+		}
+
+		var product models.Product
+		result := tx.Select("id", "name").Where("id = ?", epd.ProductID).Limit(1).Find(&product)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordEPDChanged(tx, &product, epd.DeletedAt.Time)
+	}))
+}
+
+// epdProduct loads the product of an EPD, an EPD of a missing product is
+// invalid.
+func epdProduct(tx *gorm.DB, id uint) (*models.Product, error) {
+	var product models.Product
+	if err := tx.Select("id", "name").First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &ValidationError{Err: fmt.Errorf("product %d does not exist", id)}
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// recordEPDChanged records the epd.changed event of a product in the outbox,
+// for the version of its EPD.
+func recordEPDChanged(tx *gorm.DB, product *models.Product, version time.Time) error {
+	return models.RecordEvent(tx, models.AggregateProduct, product.ID, models.EventEPDChanged, version, models.ProductEvent{
+		ProductID:   product.ID,
+		ProductType: models.AggregateProduct,
+		Name:        product.Name,
+		OccurredAt:  time.Now(),
+	})
+}
+
+type postgresReports struct {
+	db *gorm.DB
+}
+
+func (r *postgresReports) Create(ctx context.Context, report *models.Report) error {
+	if err := validate(report); err != nil {
+		return err
+	}
+	return mapError(r.db.WithContext(ctx).Create(report).Error)
+}
+
+func (r *postgresReports) Get(ctx context.Context, id uint) (*models.Report, error) {
+	var report models.Report
+	if err := r.db.WithContext(ctx).First(&report, id).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &report, nil
+}
+
+func (r *postgresReports) ListByProduct(ctx context.Context, productID uint) ([]models.Report, error) {
+	reports := []models.Report{}
+	err := r.db.WithContext(ctx).Where("epd_id = ?", productID).Order("id").Find(&reports).Error
+	return reports, mapError(err)
+}
+
+func (r *postgresReports) Delete(ctx context.Context, id uint) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.Report{}, id))
+}
+
+type postgresImages struct {
+	db *gorm.DB
+}
+
+func (r *postgresImages) Create(ctx context.Context, image *models.UploadedImage) error {
+	if err := validate(image); err != nil {
+		return err
+	}
+	return mapError(r.db.WithContext(ctx).Create(image).Error)
+}
+
+func (r *postgresImages) Get(ctx context.Context, id uint) (*models.UploadedImage, error) {
+	var image models.UploadedImage
+	if err := r.db.WithContext(ctx).First(&image, id).Error; err != nil {
+		return nil, mapError(err)
+	}
+	return &image, nil
+}
+
+func (r *postgresImages) ListByUser(ctx context.Context, userID uint) ([]models.UploadedImage, error) {
+	images := []models.UploadedImage{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&images).Error
+	return images, mapError(err)
+}
+
+func (r *postgresImages) Delete(ctx context.Context, id uint) error {
+	return affected(r.db.WithContext(ctx).Delete(&models.UploadedImage{}, id))
+}
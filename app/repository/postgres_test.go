@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/db"
+)
+
+// testDB returns a database migrated to the latest schema, emptied but for
+// the brand and the category 1. The tests using it are skipped unless
+// ECOLENS_TEST_DSN names a disposable Postgres database.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("ECOLENS_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ECOLENS_TEST_DSN is not set")
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		"TRUNCATE users, uploaded_images, brands, categories, products, product_images, product_translations, environmental_product_declarations, lca_metrics, reports, outbox_events RESTART IDENTITY CASCADE",
+		"INSERT INTO brands (name) VALUES ('Acme')",
+		"INSERT INTO categories (name) VALUES ('Kitchen')",
+	} {
+		if err := conn.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+func TestPostgres(t *testing.T) {
+	RunRepositoryTests(t, func(t *testing.T) *Repositories { return NewPostgres(testDB(t)) })
+}
+
+// TestPostgresConstraints checks the violations only Postgres catches are
+// mapped to the errors of the package.
+func TestPostgresConstraints(t *testing.T) {
+	repos := NewPostgres(testDB(t))
+	ctx := context.Background()
+
+	// the name is a varchar(255)
+	err := repos.Products.Create(ctx, newProduct(strings.Repeat("a", 300)))
+	expectError(t, "Create of a product with a too long name", err, ErrInvalid)
+
+	// brand 2 does not exist
+	err = repos.Products.Create(ctx, &models.Product{Name: "Cork mat", BrandID: 2, CategoryID: 1})
+	expectError(t, "Create of a product of a missing brand", err, ErrInvalid)
+}
+
+// TestPostgresRecordsEPDChanged checks the writes of an EPD record the
+// epd.changed event of its product in their transaction.
+func TestPostgresRecordsEPDChanged(t *testing.T) {
+	conn := testDB(t)
+	repos := NewPostgres(conn)
+	ctx := context.Background()
+
+	product := newProduct("Wool blanket")
+	if err := repos.Products.Create(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	epdEvents := func() []models.OutboxEvent {
+		t.Helper()
+		var events []models.OutboxEvent
+		err := conn.Where("event_type = ? AND aggregate_id = ?", models.EventEPDChanged, product.ID).Order("id").Find(&events).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	epd := &models.EnvironmentalProductDeclaration{ProductID: product.ID, Description: "Cradle to grave"}
+	if _, err := repos.EPDs.Save(ctx, epd); err != nil {
+		t.Fatal(err)
+	}
+	events := epdEvents()
+	if len(events) != 1 || events[0].AggregateType != models.AggregateProduct || !strings.Contains(string(events[0].Payload), "Wool blanket") {
+		t.Fatalf("events after Save = %+v, want one epd.changed", events)
+	}
+
+	// a failed write records nothing
+	if _, err := repos.EPDs.Save(ctx, &models.EnvironmentalProductDeclaration{ProductID: missingID}); err == nil {
+		t.Fatal("Save for a missing product succeeded")
+	}
+	if err := repos.EPDs.Delete(ctx, epd.ID); err != nil {
+		t.Fatal(err)
+	}
+	if events := epdEvents(); len(events) != 2 {
+		t.Errorf("events after Delete = %+v, want two epd.changed", events)
+	}
+}
+
+// TestPostgresDedupesEvents checks every version of a product records its
+// events once.
+func TestPostgresDedupesEvents(t *testing.T) {
+	conn := testDB(t)
+	repos := NewPostgres(conn)
+	ctx := context.Background()
+
+	product := newProduct("Linen towel")
+	if err := repos.Products.Create(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Products.Update(ctx, product.ID, &models.Product{Name: "Linen towels"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []models.OutboxEvent
+	if err := conn.Where("aggregate_id = ?", product.ID).Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].DedupeKey == events[1].DedupeKey {
+		t.Fatalf("events = %+v, want the created and updated events with their own keys", events)
+	}
+
+	// recording the event of the updated version again is skipped
+	var updated models.Product
+	if err := conn.First(&updated, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RecordEvent(conn, models.AggregateProduct, product.ID, models.EventProductUpdated, updated.UpdatedAt, models.ProductEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := conn.Model(&models.OutboxEvent{}).Where("aggregate_id = ?", product.ID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("events = %d after recording the update again, want 2", count)
+	}
+}
@@ -0,0 +1,130 @@
+// Package repository stores the records of the API: users, products, EPDs,
+// reports and uploaded images. Each repository has a Postgres
+// implementation on gorm and an in-memory one, which behave the same way:
+// a missing record is ErrNotFound, a record clashing with a stored one
+// ErrConflict, and a record breaking a constraint or referencing a missing
+// record a *ValidationError.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+var (
+	// ErrNotFound is returned for a record that does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned for a record clashing with a stored one, like
+	// a user with a taken email
+	ErrConflict = errors.New("record conflicts with a stored one")
+	// ErrInvalid matches every *ValidationError with errors.Is
+	ErrInvalid = errors.New("invalid record")
+)
+
+// ValidationError is returned for a record that breaks a constraint. Err
+// tells which, it is the validator.ValidationErrors of the struct tags of
+// the model when they failed.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return ErrInvalid.Error() + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// validate checks record against the validate tags of its model.
+func validate(record interface{}) error {
+	if err := utils.NewValidator().Struct(record); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
+
+// Users stores the accounts. Emails are unique, regardless of case.
+type Users interface {
+	// Create stores a new user and sets its ID
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id uint) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	List(ctx context.Context, offset, limit int) ([]models.User, error)
+	// Update sets the non-empty fields of update
+	Update(ctx context.Context, id uint, update *models.UserUpdate) error
+	SetPassword(ctx context.Context, id uint, passwordHash string) error
+	SetRole(ctx context.Context, id uint, role string) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// Products stores the catalogue and the translations of the products.
+type Products interface {
+	// Create stores a new product and sets its ID
+	Create(ctx context.Context, product *models.Product) error
+	CreateMarketplace(ctx context.Context, product *models.MarketPlaceProduct) error
+	// Update sets the non-zero fields of product
+	Update(ctx context.Context, id uint, product *models.Product) error
+	// Get returns a product with its images, EPD and reports
+	Get(ctx context.Context, id uint) (*models.Product, error)
+	// List returns products from offset, in language where translated, see
+	// models.LocalizeProducts
+	List(ctx context.Context, offset, limit int, language string) ([]models.Product, error)
+	// Exists returns ErrNotFound unless the product exists
+	Exists(ctx context.Context, id uint) error
+	// Translations returns the translations of a product by language
+	Translations(ctx context.Context, id uint) ([]models.ProductTranslation, error)
+	// PutTranslation creates or replaces the translation of a product in
+	// its language
+	PutTranslation(ctx context.Context, translation *models.ProductTranslation) error
+	DeleteTranslation(ctx context.Context, id uint, language string) error
+}
+
+// EPDs stores the environmental product declarations, one per product,
+// with their LCA metrics.
+type EPDs interface {
+	// Save stores epd as the declaration of its product, replacing the one
+	// it had and its metrics, and tells whether the product had none
+	Save(ctx context.Context, epd *models.EnvironmentalProductDeclaration) (created bool, err error)
+	// Get returns a declaration with its metrics
+	Get(ctx context.Context, id uint) (*models.EnvironmentalProductDeclaration, error)
+	GetByProduct(ctx context.Context, productID uint) (*models.EnvironmentalProductDeclaration, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// Reports stores the reports on products. The EPDID of a report is the ID
+// of its product.
+type Reports interface {
+	// Create stores a new report and sets its ID
+	Create(ctx context.Context, report *models.Report) error
+	Get(ctx context.Context, id uint) (*models.Report, error)
+	ListByProduct(ctx context.Context, productID uint) ([]models.Report, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// Images stores the records of the images users upload, the images are kept
+// in the blob storage.
+type Images interface {
+	// Create stores a new image record and sets its ID
+	Create(ctx context.Context, image *models.UploadedImage) error
+	Get(ctx context.Context, id uint) (*models.UploadedImage, error)
+	// ListByUser returns the images of a user, oldest first
+	ListByUser(ctx context.Context, userID uint) ([]models.UploadedImage, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// Repositories are the repositories of a store.
+type Repositories struct {
+	Users    Users
+	Products Products
+	EPDs     EPDs
+	Reports  Reports
+	Images   Images
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// RunRepositoryTests checks repositories behave as the package documents.
+// newRepo returns empty repositories, whose store has the brand and the
+// category 1 for the products to reference.
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) *Repositories) {
+	t.Run("users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("products", func(t *testing.T) { testProducts(t, newRepo(t)) })
+	t.Run("epds", func(t *testing.T) { testEPDs(t, newRepo(t)) })
+	t.Run("reports", func(t *testing.T) { testReports(t, newRepo(t)) })
+	t.Run("images", func(t *testing.T) { testImages(t, newRepo(t)) })
+}
+
+// missingID is the ID of no record
+const missingID = 999999
+
+func expectError(t *testing.T, what string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s = %v, want %v", what, err, target)
+	}
+}
+
+func newUser(email string) *models.User {
+	return &models.User{Email: email, PasswordHash: "hash", UserStatus: 1, UserRole: models.RoleUser}
+}
+
+func newProduct(name string) *models.Product {
+	return &models.Product{Name: name, BrandID: 1, CategoryID: 1}
+}
+
+func testUsers(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	users := repos.Users
+
+	user := newUser("ada@example.com")
+	if err := users.Create(ctx, user); err != nil || user.ID == 0 {
+		t.Fatalf("Create = %v, id %d", err, user.ID)
+	}
+
+	expectError(t, "Create with a taken email", users.Create(ctx, newUser("ADA@example.com")), ErrConflict)
+
+	var invalid validator.ValidationErrors
+	err := users.Create(ctx, newUser("not an email"))
+	if !errors.Is(err, ErrInvalid) || !errors.As(err, &invalid) {
+		t.Errorf("Create of an invalid user = %v, want the validation errors", err)
+	}
+
+	got, err := users.GetByEmail(ctx, "Ada@Example.com")
+	if err != nil || got.ID != user.ID {
+		t.Errorf("GetByEmail = %+v, %v", got, err)
+	}
+
+	if err := users.Update(ctx, user.ID, &models.UserUpdate{FirstName: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	// an update writing the stored values still finds the user
+	if err := users.Update(ctx, user.ID, &models.UserUpdate{FirstName: "Ada"}); err != nil {
+		t.Errorf("Update with unchanged values = %v", err)
+	}
+	if got, err := users.Get(ctx, user.ID); err != nil || got.FirstName != "Ada" || got.Email != user.Email {
+		t.Errorf("Get after Update = %+v, %v", got, err)
+	}
+
+	other := newUser("grace@example.com")
+	if err := users.Create(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, "Update to a taken email", users.Update(ctx, other.ID, &models.UserUpdate{Email: "ada@EXAMPLE.com"}), ErrConflict)
+
+	expectError(t, "Update of a missing user", users.Update(ctx, missingID, &models.UserUpdate{FirstName: "Nobody"}), ErrNotFound)
+	expectError(t, "SetPassword of a missing user", users.SetPassword(ctx, missingID, "hash"), ErrNotFound)
+	expectError(t, "SetRole of a missing user", users.SetRole(ctx, missingID, models.RoleAdmin), ErrNotFound)
+	expectError(t, "Delete of a missing user", users.Delete(ctx, missingID), ErrNotFound)
+
+	if err := users.Delete(ctx, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Get(ctx, other.ID)
+	expectError(t, "Get of a deleted user", err, ErrNotFound)
+
+	list, err := users.List(ctx, 0, 10)
+	if err != nil || len(list) != 1 || list[0].ID != user.ID {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+}
+
+func testProducts(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	products := repos.Products
+
+	product := newProduct("Bamboo toothbrush")
+	if err := products.Create(ctx, product); err != nil || product.ID == 0 {
+		t.Fatalf("Create = %v, id %d", err, product.ID)
+	}
+
+	expectError(t, "Update of a missing product", products.Update(ctx, missingID, &models.Product{Name: "Nothing"}), ErrNotFound)
+	expectError(t, "Exists of a missing product", products.Exists(ctx, missingID), ErrNotFound)
+	_, err := products.Get(ctx, missingID)
+	expectError(t, "Get of a missing product", err, ErrNotFound)
+
+	if err := products.Update(ctx, product.ID, &models.Product{Description: "Compostable handle"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := products.Get(ctx, product.ID)
+	if err != nil || got.Name != product.Name || got.Description != "Compostable handle" {
+		t.Errorf("Get after Update = %+v, %v", got, err)
+	}
+
+	translation := &models.ProductTranslation{ProductID: product.ID, Language: "fr", Name: "Brosse à dents en bambou"}
+	if err := products.PutTranslation(ctx, translation); err != nil {
+		t.Fatal(err)
+	}
+	translation.Name = "Brosse à dents"
+	if err := products.PutTranslation(ctx, translation); err != nil {
+		t.Fatalf("PutTranslation replacing one = %v", err)
+	}
+	translations, err := products.Translations(ctx, product.ID)
+	if err != nil || len(translations) != 1 || translations[0].Name != "Brosse à dents" {
+		t.Errorf("Translations = %+v, %v", translations, err)
+	}
+
+	list, err := products.List(ctx, 0, 10, "fr")
+	if err != nil || len(list) != 1 || list[0].Name != "Brosse à dents" {
+		t.Errorf("List in French = %+v, %v", list, err)
+	}
+
+	missing := &models.ProductTranslation{ProductID: missingID, Language: "fr", Name: "Rien"}
+	expectError(t, "PutTranslation of a missing product", products.PutTranslation(ctx, missing), ErrInvalid)
+	expectError(t, "DeleteTranslation of a missing translation", products.DeleteTranslation(ctx, product.ID, "de"), ErrNotFound)
+	if err := products.DeleteTranslation(ctx, product.ID, "fr"); err != nil {
+		t.Error(err)
+	}
+}
+
+func testEPDs(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	epds := repos.EPDs
+
+	product := newProduct("Steel bottle")
+	if err := repos.Products.Create(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	epd := &models.EnvironmentalProductDeclaration{
+		ProductID:  product.ID,
+		LCAMetrics: []models.LCAMetrics{{Name: "GWP", Value: 3.2, Unit: "kg CO2e"}},
+	}
+	created, err := epds.Save(ctx, epd)
+	if err != nil || !created {
+		t.Fatalf("Save = %v, %v", created, err)
+	}
+
+	replacement := &models.EnvironmentalProductDeclaration{
+		ProductID:  product.ID,
+		LCAMetrics: []models.LCAMetrics{{Name: "GWP", Value: 2.9, Unit: "kg CO2e"}, {Name: "Water", Value: 12, Unit: "l"}},
+	}
+	created, err = epds.Save(ctx, replacement)
+	if err != nil || created || replacement.ID != epd.ID {
+		t.Fatalf("Save replacing = %v, %v, id %d", created, err, replacement.ID)
+	}
+	got, err := epds.GetByProduct(ctx, product.ID)
+	if err != nil || len(got.LCAMetrics) != 2 {
+		t.Errorf("GetByProduct = %+v, %v", got, err)
+	}
+
+	_, err = epds.Save(ctx, &models.EnvironmentalProductDeclaration{ProductID: missingID})
+	expectError(t, "Save for a missing product", err, ErrInvalid)
+	_, err = epds.Save(ctx, &models.EnvironmentalProductDeclaration{ProductID: product.ID, LCAMetrics: []models.LCAMetrics{{Name: "GWP"}}})
+	expectError(t, "Save of a metric without unit", err, ErrInvalid)
+
+	expectError(t, "Delete of a missing EPD", epds.Delete(ctx, missingID), ErrNotFound)
+	if err := epds.Delete(ctx, epd.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = epds.Get(ctx, epd.ID)
+	expectError(t, "Get of a deleted EPD", err, ErrNotFound)
+}
+
+func testReports(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	reports := repos.Reports
+
+	product := newProduct("Glass jar")
+	if err := repos.Products.Create(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	report := &models.Report{Name: "LCA", EPDID: product.ID, Summary: "Cradle to gate"}
+	if err := reports.Create(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	// referencing a missing product breaks a foreign key
+	expectError(t, "Create for a missing product", reports.Create(ctx, &models.Report{Name: "LCA", EPDID: missingID}), ErrInvalid)
+
+	list, err := reports.ListByProduct(ctx, product.ID)
+	if err != nil || len(list) != 1 || list[0].ID != report.ID {
+		t.Errorf("ListByProduct = %+v, %v", list, err)
+	}
+
+	expectError(t, "Delete of a missing report", reports.Delete(ctx, missingID), ErrNotFound)
+	if err := reports.Delete(ctx, report.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = reports.Get(ctx, report.ID)
+	expectError(t, "Get of a deleted report", err, ErrNotFound)
+}
+
+func testImages(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	images := repos.Images
+
+	user := newUser("linus@example.com")
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	image := &models.UploadedImage{UserID: user.ID, ContentType: "image/png", ContentURL: "https://example.com/a.png"}
+	if err := images.Create(ctx, image); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, "Create without a content type", images.Create(ctx, &models.UploadedImage{UserID: user.ID, ContentURL: "https://example.com/b.png"}), ErrInvalid)
+
+	list, err := images.ListByUser(ctx, user.ID)
+	if err != nil || len(list) != 1 || list[0].ID != image.ID {
+		t.Errorf("ListByUser = %+v, %v", list, err)
+	}
+
+	expectError(t, "Delete of a missing image", images.Delete(ctx, missingID), ErrNotFound)
+	if err := images.Delete(ctx, image.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	RunRepositoryTests(t, func(t *testing.T) *Repositories { return NewMemory() })
+}
+
+func TestMapError(t *testing.T) {
+	pgError := func(code string) error {
+		return fmt.Errorf("insert: %w", &pgconn.PgError{Code: code, Detail: "Key (email)=(ada@example.com) already exists."})
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{"record not found", gorm.ErrRecordNotFound, ErrNotFound},
+		{"duplicated key", gorm.ErrDuplicatedKey, ErrConflict},
+		{"foreign key violated", gorm.ErrForeignKeyViolated, ErrInvalid},
+		{"unique violation", pgError("23505"), ErrConflict},
+		{"foreign key violation", pgError("23503"), ErrInvalid},
+		{"not null violation", pgError("23502"), ErrInvalid},
+		{"check violation", pgError("23514"), ErrInvalid},
+		{"value too long", pgError("22001"), ErrInvalid},
+		{"invalid text representation", pgError("22P02"), ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectError(t, "mapError", mapError(tt.err), tt.target)
+		})
+	}
+
+	if mapError(nil) != nil {
+		t.Error("mapError(nil) is not nil")
+	}
+	// other failures, like a serialization failure, are not the caller's
+	for _, err := range []error{pgError("40001"), errors.New("connection reset")} {
+		mapped := mapError(err)
+		if errors.Is(mapped, ErrNotFound) || errors.Is(mapped, ErrConflict) || errors.Is(mapped, ErrInvalid) || !strings.Contains(mapped.Error(), err.Error()) {
+			t.Errorf("mapError(%v) = %v, want it unchanged", err, mapped)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+)
+
+// Admin manages the dead letters, the search synonyms and the search
+// analytics.
+type Admin interface {
+	// DeadLetters returns a page of the dead letters, newest first, of
+	// topic or of every topic when empty
+	DeadLetters(ctx context.Context, topic string, page, limit int) ([]models.DeadLetter, error)
+	DeadLetter(ctx context.Context, id uint) (*models.DeadLetter, error)
+	// Replay publishes a dead letter again on its topic and counts the
+	// replay
+	Replay(ctx context.Context, deadLetter *models.DeadLetter) error
+
+	Synonyms(ctx context.Context) ([]models.SynonymGroup, error)
+	SynonymGroup(ctx context.Context, id uint) (*models.SynonymGroup, error)
+	// SaveSynonyms creates or updates a synonym group, searches use it at
+	// once
+	SaveSynonyms(ctx context.Context, group *models.SynonymGroup) error
+	DeleteSynonyms(ctx context.Context, group *models.SynonymGroup) error
+
+	// SearchReport computes a report of models.SearchReportNames
+	SearchReport(ctx context.Context, report string, opts models.SearchReportOptions) ([]models.QueryReport, error)
+}
+
+type adminService struct {
+	db        *gorm.DB
+	messaging Messaging
+	search    Search
+}
+
+// NewAdmin returns the admin tasks on db, replaying dead letters through
+// messaging and refreshing the synonyms of search.
+func NewAdmin(db *gorm.DB, messaging Messaging, search Search) Admin {
+	return &adminService{db: db, messaging: messaging, search: search}
+}
+
+func (s *adminService) DeadLetters(ctx context.Context, topic string, page, limit int) ([]models.DeadLetter, error) {
+	query := s.db.WithContext(ctx).Model(&models.DeadLetter{})
+	if topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+
+	deadLetters := []models.DeadLetter{}
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deadLetters).Error; err != nil {
+		return nil, err
+	}
+	return deadLetters, nil
+}
+
+func (s *adminService) DeadLetter(ctx context.Context, id uint) (*models.DeadLetter, error) {
+	var deadLetter models.DeadLetter
+	if err := s.db.WithContext(ctx).First(&deadLetter, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &deadLetter, nil
+}
+
+func (s *adminService) Replay(ctx context.Context, deadLetter *models.DeadLetter) error {
+	attrs := map[string]string{}
+	if len(deadLetter.Attributes) > 0 {
+		if err := json.Unmarshal(deadLetter.Attributes, &attrs); err != nil {
+			attrs = map[string]string{}
+		}
+	}
+	delete(attrs, pubsub.AttrDeadLetterReason)
+	delete(attrs, pubsub.AttrOriginalTopic)
+
+	_, err := s.messaging.Publish(ctx, deadLetter.Topic, &pubsub.Message{
+		Data:       deadLetter.Data,
+		Attributes: attrs,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deadLetter.ReplayCount++
+	deadLetter.ReplayedAt = &now
+	return s.db.WithContext(ctx).Save(deadLetter).Error
+}
+
+func (s *adminService) Synonyms(ctx context.Context) ([]models.SynonymGroup, error) {
+	groups := []models.SynonymGroup{}
+	if err := s.db.WithContext(ctx).Order("id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (s *adminService) SynonymGroup(ctx context.Context, id uint) (*models.SynonymGroup, error) {
+	var group models.SynonymGroup
+	if err := s.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (s *adminService) SaveSynonyms(ctx context.Context, group *models.SynonymGroup) error {
+	if err := s.db.WithContext(ctx).Save(group).Error; err != nil {
+		return err
+	}
+	s.search.InvalidateSynonyms()
+	return nil
+}
+
+func (s *adminService) DeleteSynonyms(ctx context.Context, group *models.SynonymGroup) error {
+	if err := s.db.WithContext(ctx).Delete(group).Error; err != nil {
+		return err
+	}
+	s.search.InvalidateSynonyms()
+	return nil
+}
+
+func (s *adminService) SearchReport(ctx context.Context, report string, opts models.SearchReportOptions) ([]models.QueryReport, error) {
+	return models.SearchQueryReport(ctx, s.db, report, opts)
+}
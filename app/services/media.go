@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"google.golang.org/api/option"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+)
+
+// Media stores the images users upload.
+type Media interface {
+	// UploadAvatar stores the avatar of a user and returns its public URL
+	UploadAvatar(ctx context.Context, userID uint, image io.Reader) (string, error)
+	// UploadImage stores an image searched by a user, records it with the
+	// user's uploads and returns its URL
+	UploadImage(ctx context.Context, userID uint, contentType string, image []byte) (string, error)
+	// Ping checks the configured buckets are reachable
+	Ping(ctx context.Context) error
+}
+
+// MediaOptions locate the Cloud Storage buckets of uploaded images
+type MediaOptions struct {
+	APIKey       string
+	AvatarBucket string
+	ImageBucket  string
+}
+
+type cloudMedia struct {
+	images repository.Images
+	opts   MediaOptions
+}
+
+// NewMedia returns the media stored in Cloud Storage, recorded in images.
+func NewMedia(images repository.Images, opts MediaOptions) Media {
+	return &cloudMedia{images: images, opts: opts}
+}
+
+func (m *cloudMedia) UploadAvatar(ctx context.Context, userID uint, image io.Reader) (string, error) {
+	client, err := storage.NewClient(ctx, option.WithAPIKey(m.opts.APIKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	defer client.Close()
+
+	// create a User ID basedd filename
+	avatarFilename := fmt.Sprintf("%d_avatar.png", userID)
+	obj := client.Bucket(m.opts.AvatarBucket).Object(avatarFilename)
+
+	wc := obj.NewWriter(ctx)
+	if _, err := io.Copy(wc, image); err != nil {
+		return "", fmt.Errorf("failed to write avatar image to GCS: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return "", fmt.Errorf("failed to close GCS writer : %v", err)
+	}
+
+	// set public access to the avatar URL
+	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return "", fmt.Errorf("failed to set GCS object ACL : %v", err)
+	}
+
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", m.opts.AvatarBucket, avatarFilename), nil
+}
+
+func (m *cloudMedia) UploadImage(ctx context.Context, userID uint, contentType string, image []byte) (string, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Printf("Failed to create Google Cloud Storage Client : %v", err)
+		return "", fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	defer client.Close()
+
+	// create a new uuid for image filename
+	imageFilename := fmt.Sprintf("%s.jpg", uuid.NewString())
+
+	// upload the image to GCS
+	obj := client.Bucket(m.opts.ImageBucket).Object(imageFilename)
+	wc := obj.NewWriter(ctx)
+	defer wc.Close()
+
+	wc.ContentType = contentType
+
+	if _, err := wc.Write(image); err != nil {
+		log.Printf("Failed to write image data to Google Cloud Storage: %v", err)
+		return "", fmt.Errorf("failed to write image data to GCS: %v", err)
+	}
+
+	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return "", fmt.Errorf("error setting ACL: %v", err)
+	}
+
+	imageURL := fmt.Sprintf("gs://%s/%s", m.opts.ImageBucket, imageFilename)
+
+	uploadedImage := models.UploadedImage{
+		UserID:      userID,
+		ContentType: contentType,
+		ContentURL:  imageURL,
+		UploadDate:  time.Now(),
+	}
+	if err := m.images.Create(ctx, &uploadedImage); err != nil {
+		log.Printf("Failed to save Upload Image record to the database: %v", err)
+		return "", fmt.Errorf("failed to save image record to database: %v", err)
+	}
+
+	return imageURL, nil
+}
+
+func (m *cloudMedia) Ping(ctx context.Context) error {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	defer client.Close()
+
+	for _, bucket := range []string{m.opts.AvatarBucket, m.opts.ImageBucket} {
+		if bucket == "" {
+			continue
+		}
+		if _, err := client.Bucket(bucket).Attrs(ctx); err != nil {
+			return fmt.Errorf("failed to reach bucket %s: %v", bucket, err)
+		}
+	}
+	return nil
+}
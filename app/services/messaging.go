@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+)
+
+// Messaging talks to the message broker and the ML workers behind it.
+type Messaging interface {
+	// Publish publishes msg on topic and returns its ID
+	Publish(ctx context.Context, topic string, msg *pubsub.Message) (string, error)
+	// Call calls method of the ML workers and waits up to timeout for its
+	// result
+	Call(ctx context.Context, method string, args interface{}, timeout time.Duration) (interface{}, error)
+	// RecordDeadLetter stores a dead-lettered message so it shows up in the
+	// admin endpoints, it is the pubsub.DeadLetterRecorder of the consumers
+	RecordDeadLetter(ctx context.Context, subscription string, msg *pubsub.Message, reason string) error
+}
+
+// BrokerMessaging is the Messaging of a broker. The RPCs to the ML workers
+// are published on a topic and answered on a subscription.
+type BrokerMessaging struct {
+	db     *gorm.DB
+	broker pubsub.Broker
+	rpc    *pubsub.PubsubClient
+}
+
+// NewMessaging returns the messaging of broker, calling the ML workers on
+// topic and reading their responses from subscription. Dead letters are
+// recorded in db.
+func NewMessaging(db *gorm.DB, broker pubsub.Broker, topic, subscription string) (*BrokerMessaging, error) {
+	m := &BrokerMessaging{db: db, broker: broker}
+
+	var err error
+	m.rpc, err = pubsub.NewPubSubClient(broker, topic, subscription, m.RecordDeadLetter)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start listens for the responses of the ML workers.
+func (m *BrokerMessaging) Start() {
+	m.rpc.StartListening()
+}
+
+// Stop stops listening, the calls still waiting time out.
+func (m *BrokerMessaging) Stop() {
+	m.rpc.StopListening()
+}
+
+func (m *BrokerMessaging) Publish(ctx context.Context, topic string, msg *pubsub.Message) (string, error) {
+	return m.broker.Publish(ctx, topic, msg)
+}
+
+func (m *BrokerMessaging) Call(ctx context.Context, method string, args interface{}, timeout time.Duration) (interface{}, error) {
+	messageID, err := m.rpc.PublishMessage(method, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.rpc.WaitForResponse(messageID, timeout, true)
+}
+
+func (m *BrokerMessaging) RecordDeadLetter(ctx context.Context, subscription string, msg *pubsub.Message, reason string) error {
+	return models.RecordDeadLetter(m.db.WithContext(ctx), msg.Topic, subscription, msg.ID, msg.Data, msg.Attributes, msg.DeliveryAttempt, reason)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+)
+
+// Products manages the catalogue. Writes invalidate the cached searches.
+type Products interface {
+	Create(ctx context.Context, product *models.Product) error
+	CreateMarketplace(ctx context.Context, product *models.MarketPlaceProduct) error
+	Update(ctx context.Context, id uint, product *models.Product) error
+	// List returns a page of products, in language where translated
+	List(ctx context.Context, page, limit int, language string) ([]models.Product, error)
+	// Get returns a product with its images, EPD and reports
+	Get(ctx context.Context, id uint) (*models.Product, error)
+	// Exists returns ErrNotFound unless the product exists
+	Exists(ctx context.Context, id uint) error
+	Translations(ctx context.Context, id uint) ([]models.ProductTranslation, error)
+	// PutTranslation creates or replaces the translation of a product in
+	// its language
+	PutTranslation(ctx context.Context, translation *models.ProductTranslation) error
+	DeleteTranslation(ctx context.Context, id uint, language string) error
+}
+
+type productService struct {
+	products repository.Products
+	cache    *searchcache.Cache
+}
+
+// NewProducts returns the catalogue stored in products, whose searches are
+// cached in cache.
+func NewProducts(products repository.Products, cache *searchcache.Cache) Products {
+	return &productService{products: products, cache: cache}
+}
+
+func (s *productService) Create(ctx context.Context, product *models.Product) error {
+	if err := s.products.Create(ctx, product); err != nil {
+		return err
+	}
+	s.invalidateSearches(searchcache.Products)
+	return nil
+}
+
+func (s *productService) CreateMarketplace(ctx context.Context, product *models.MarketPlaceProduct) error {
+	if err := s.products.CreateMarketplace(ctx, product); err != nil {
+		return err
+	}
+	s.invalidateSearches(searchcache.MarketplaceProducts)
+	return nil
+}
+
+func (s *productService) Update(ctx context.Context, id uint, product *models.Product) error {
+	if err := s.products.Update(ctx, id, product); err != nil {
+		return err
+	}
+	s.invalidateSearches(searchcache.Products)
+	return nil
+}
+
+func (s *productService) List(ctx context.Context, page, limit int, language string) ([]models.Product, error) {
+	return s.products.List(ctx, (page-1)*limit, limit, language)
+}
+
+func (s *productService) Get(ctx context.Context, id uint) (*models.Product, error) {
+	return s.products.Get(ctx, id)
+}
+
+func (s *productService) Exists(ctx context.Context, id uint) error {
+	return s.products.Exists(ctx, id)
+}
+
+func (s *productService) Translations(ctx context.Context, id uint) ([]models.ProductTranslation, error) {
+	return s.products.Translations(ctx, id)
+}
+
+func (s *productService) PutTranslation(ctx context.Context, translation *models.ProductTranslation) error {
+	if err := s.products.PutTranslation(ctx, translation); err != nil {
+		return err
+	}
+	s.invalidateSearches(searchcache.Products)
+	return nil
+}
+
+func (s *productService) DeleteTranslation(ctx context.Context, id uint, language string) error {
+	if err := s.products.DeleteTranslation(ctx, id, language); err != nil {
+		return err
+	}
+	s.invalidateSearches(searchcache.Products)
+	return nil
+}
+
+// invalidateSearches makes the searches of the namespaces miss the results
+// cached before a write. A failure is only logged, the entries then expire
+// with their TTL.
+func (s *productService) invalidateSearches(namespaces ...string) {
+	if err := s.cache.Invalidate(context.Background(), namespaces...); err != nil {
+		log.Printf("Failed to invalidate the %v search cache: %v", namespaces, err)
+	}
+}
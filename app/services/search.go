@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"github.com/r3tr056/ecolens_api/platform/analytics"
+	"github.com/r3tr056/ecolens_api/platform/federated"
+	"github.com/r3tr056/ecolens_api/platform/history"
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+	"github.com/r3tr056/ecolens_api/platform/semantic"
+	"github.com/r3tr056/ecolens_api/platform/suggest"
+	"github.com/r3tr056/ecolens_api/platform/understand"
+)
+
+// ErrCursorMismatch is returned for the cursor of a search of another kind
+var ErrCursorMismatch = errors.New("cursor belongs to a different search")
+
+// Search runs the searches of the API. The ranked results of a search are
+// kept in a search session its pages are loaded from.
+type Search interface {
+	// Language returns the language of a search for term: the language term
+	// is written in or else the one of acceptLanguage, see
+	// locale.Languages.Resolve.
+	Language(term, acceptLanguage string) string
+	// SupportsLanguage tells whether searches run in language
+	SupportsLanguage(language string) bool
+	// Suggest completes search box input, after the recent searches of the
+	// user when userID is not 0
+	Suggest(ctx context.Context, term string, userID uint, limit int) ([]models.MatchResult, error)
+	// Unified searches the types at once, see federated.Search
+	Unified(ctx context.Context, q *query.Query, types []string, limit int) (*federated.Result, error)
+	// Products filters products and keeps the results in a new session, q
+	// is nil when the request has no search term
+	Products(ctx context.Context, request *models.ProductSearchRequest, q *query.Query, language string) (*models.SearchSession, error)
+	MarketplaceProducts(ctx context.Context, term string, q *query.Query, exact bool) (*models.SearchSession, error)
+	Reports(ctx context.Context, term string, q *query.Query, exact bool) (*models.SearchSession, error)
+	// Resume loads the session of a cursor of a search of kind
+	Resume(ctx context.Context, cursor, kind string) (*models.SearchSession, *models.SearchCursor, error)
+	ProductPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.Product, error)
+	MarketplaceProductPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.MarketPlaceProduct, error)
+	ReportPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.Report, error)
+	// Record logs a new search for the analytics and, when userID is not 0,
+	// queues it for the user's history. Searches without a term, q nil, are
+	// not logged for the analytics.
+	Record(userID uint, started time.Time, q *query.Query, entry models.SearchHistory)
+	// RecordClick notes the result of a search the user opened
+	RecordClick(ctx context.Context, userID uint, click *models.SearchClick) error
+	CacheStats() searchcache.Stats
+	// InvalidateSynonyms reloads the synonyms after they changed
+	InvalidateSynonyms()
+}
+
+// SearchBackends are what searches run on
+type SearchBackends struct {
+	DB *gorm.DB
+	// Redis keeps the search sessions
+	Redis         *redis.Client
+	Cache         *searchcache.Cache
+	Suggestions   *suggest.Service
+	Understanding *understand.Service
+	// Semantic ranks in results close in meaning, nil disables it
+	Semantic *semantic.Service
+	// Languages are the languages searches run in, nil searches the default
+	// language only
+	Languages *locale.Languages
+	Analytics *analytics.Service
+	History   *history.Recorder
+}
+
+type searchService struct {
+	SearchBackends
+}
+
+// NewSearch returns the search of the backends.
+func NewSearch(backends SearchBackends) Search {
+	return &searchService{SearchBackends: backends}
+}
+
+// maxRecentSuggestions is the number of recent searches autocomplete
+// suggests at most
+const maxRecentSuggestions = 3
+
+func (s *searchService) Language(term, acceptLanguage string) string {
+	if s.Languages == nil {
+		return models.DefaultLanguage
+	}
+	return s.Languages.Resolve(term, acceptLanguage)
+}
+
+func (s *searchService) SupportsLanguage(language string) bool {
+	return s.Languages != nil && s.Languages.Supports(language)
+}
+
+func (s *searchService) Suggest(ctx context.Context, term string, userID uint, limit int) ([]models.MatchResult, error) {
+	result, err := s.Suggestions.Suggest(ctx, term, limit)
+	if err != nil || userID == 0 {
+		return result, err
+	}
+
+	recent, err := models.RecentSearches(ctx, s.DB, userID, term, maxRecentSuggestions)
+	if err != nil {
+		log.Printf("Failed to load the recent searches of user %d: %v", userID, err)
+	}
+	return suggest.WithRecent(result, recent, term, limit), nil
+}
+
+func (s *searchService) Unified(ctx context.Context, q *query.Query, types []string, limit int) (*federated.Result, error) {
+	return federated.Search(ctx, s.DB, s.Understanding.Expand(ctx, q), types, limit)
+}
+
+func (s *searchService) Products(ctx context.Context, request *models.ProductSearchRequest, q *query.Query, language string) (*models.SearchSession, error) {
+	// the page size and spelling flag do not change the results
+	filters := *request
+	filters.PageSize, filters.Exact = 0, false
+
+	var result *models.ProductSearchResult
+	filter := func(q *query.Query) (int64, error) {
+		result = &models.ProductSearchResult{}
+		err := s.Cache.Fetch(ctx, searchcache.Products, searchCacheParams("filter", filters, q, s.semanticModel(request.Exact)), result, func(ctx context.Context) (interface{}, error) {
+			return models.FilterProducts(ctx, s.DB, request, q, models.MaxSessionResults, s.semanticQuery(ctx, q, request.Exact))
+		})
+		if err != nil {
+			return 0, err
+		}
+		return result.Total, nil
+	}
+
+	var spelling *models.SpellingSuggestion
+	var err error
+	if q != nil {
+		spelling, err = s.understand(ctx, q, !request.Exact, filter)
+	} else {
+		_, err = filter(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.NewSearchSession(models.SearchKindProducts, request.SearchTerm, &result.RankedIDs)
+	session.Request, _ = json.Marshal(request)
+	session.Facets = &result.Facets
+	session.Spelling = spelling
+	session.Language = language
+	if err := session.Save(ctx, s.Redis); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *searchService) MarketplaceProducts(ctx context.Context, term string, q *query.Query, exact bool) (*models.SearchSession, error) {
+	var ranked *models.RankedIDs
+	spelling, err := s.understand(ctx, q, !exact, func(q *query.Query) (int64, error) {
+		ranked = &models.RankedIDs{}
+		err := s.Cache.Fetch(ctx, searchcache.MarketplaceProducts, searchCacheParams("search", q), ranked, func(ctx context.Context) (interface{}, error) {
+			return models.SearchMarketplaceProducts(ctx, s.DB, q, models.MaxSessionResults)
+		})
+		if err != nil {
+			return 0, err
+		}
+		return ranked.Total, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.NewSearchSession(models.SearchKindMarketplaceProducts, term, ranked)
+	session.Spelling = spelling
+	if err := session.Save(ctx, s.Redis); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *searchService) Reports(ctx context.Context, term string, q *query.Query, exact bool) (*models.SearchSession, error) {
+	var ranked *models.RankedIDs
+	spelling, err := s.understand(ctx, q, !exact, func(q *query.Query) (int64, error) {
+		ranked = &models.RankedIDs{}
+		err := s.Cache.Fetch(ctx, searchcache.Reports, searchCacheParams("search", q, s.semanticModel(exact)), ranked, func(ctx context.Context) (interface{}, error) {
+			return models.SearchReports(ctx, s.DB, q, models.MaxSessionResults, s.semanticQuery(ctx, q, exact))
+		})
+		if err != nil {
+			return 0, err
+		}
+		return ranked.Total, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.NewSearchSession(models.SearchKindReports, term, ranked)
+	session.Spelling = spelling
+	if err := session.Save(ctx, s.Redis); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *searchService) Resume(ctx context.Context, encoded, kind string) (*models.SearchSession, *models.SearchCursor, error) {
+	cursor, err := models.DecodeSearchCursor(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := models.LoadSearchSession(ctx, s.Redis, cursor.PageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Kind != kind {
+		return nil, nil, ErrCursorMismatch
+	}
+	return session, cursor, nil
+}
+
+func (s *searchService) ProductPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.Product, error) {
+	db := s.DB.WithContext(ctx)
+	products, err := models.LoadProducts(db, session.Page(offset, size))
+	if err != nil {
+		return nil, err
+	}
+	return products, models.LocalizeProducts(db, products, session.Language)
+}
+
+func (s *searchService) MarketplaceProductPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.MarketPlaceProduct, error) {
+	return models.LoadMarketplaceProducts(s.DB.WithContext(ctx), session.Page(offset, size))
+}
+
+func (s *searchService) ReportPage(ctx context.Context, session *models.SearchSession, offset, size int) ([]models.Report, error) {
+	return models.LoadReports(s.DB.WithContext(ctx), session.Page(offset, size))
+}
+
+func (s *searchService) Record(userID uint, started time.Time, q *query.Query, entry models.SearchHistory) {
+	if q != nil {
+		s.Analytics.LogSearch(entry.SearchID, entry.Kind, strings.ToLower(q.String()), userID, entry.ResultCount, time.Since(started))
+	}
+
+	if userID != 0 {
+		entry.UserID = userID
+		s.History.Record(entry)
+	}
+}
+
+func (s *searchService) RecordClick(ctx context.Context, userID uint, click *models.SearchClick) error {
+	s.Analytics.LogClick(click.SearchID, *click.Position)
+
+	// searches run while the history was paused are not found, the click
+	// still counts for the analytics
+	_, err := models.RecordSearchClick(s.DB.WithContext(ctx), userID, click)
+	return err
+}
+
+func (s *searchService) CacheStats() searchcache.Stats {
+	return s.Cache.Stats()
+}
+
+func (s *searchService) InvalidateSynonyms() {
+	s.Understanding.InvalidateSynonyms()
+}
+
+// understand runs search with the synonyms of q expanded. When q finds
+// nothing and a spelling correction of it does, the corrected results are
+// kept, otherwise the correction is only suggested. search leaves the
+// results of its last call wherever the caller wants them.
+func (s *searchService) understand(ctx context.Context, q *query.Query, spellcheck bool, search func(*query.Query) (int64, error)) (*models.SpellingSuggestion, error) {
+	total, err := search(s.Understanding.Expand(ctx, q))
+	if err != nil || !spellcheck {
+		return nil, err
+	}
+
+	corrected, ok, err := s.Understanding.Correct(ctx, q)
+	if err != nil {
+		log.Printf("Failed to correct the spelling of %q: %v", q.Raw, err)
+		return nil, nil
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	spelling := &models.SpellingSuggestion{Query: corrected.String(), Original: q.Raw}
+	if total > 0 {
+		return spelling, nil
+	}
+
+	correctedTotal, err := search(s.Understanding.Expand(ctx, corrected))
+	if err != nil {
+		return nil, err
+	}
+	if correctedTotal == 0 {
+		// neither finds anything, answer with the original query
+		_, err := search(s.Understanding.Expand(ctx, q))
+		return nil, err
+	}
+
+	spelling.Corrected = true
+	return spelling, nil
+}
+
+// semanticModel names the model semantic searches are fused with, "" when
+// the search is keyword only.
+func (s *searchService) semanticModel(exact bool) string {
+	if s.Semantic == nil || exact {
+		return ""
+	}
+	return s.Semantic.Model()
+}
+
+// semanticQuery embeds q for the semantic search. Exact searches, and all
+// searches when it is disabled, match keywords only.
+func (s *searchService) semanticQuery(ctx context.Context, q *query.Query, exact bool) *models.SemanticQuery {
+	if s.Semantic == nil || exact {
+		return nil
+	}
+	return s.Semantic.Query(ctx, q)
+}
+
+// searchCacheParams describes a search for the search cache. Queries are
+// keyed by their canonical form, so equivalent ones share entries.
+func searchCacheParams(kind string, parts ...interface{}) string {
+	for i, part := range parts {
+		if q, ok := part.(*query.Query); ok {
+			if q == nil {
+				parts[i] = ""
+			} else {
+				parts[i] = q.Language + ":" + q.String()
+			}
+		}
+	}
+	data, _ := json.Marshal(parts)
+	return kind + ":" + string(data)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// SearchHistory manages the search histories of the users.
+type SearchHistory interface {
+	// List returns a page of the searches of a user, newest first, and
+	// their total
+	List(ctx context.Context, userID uint, page, limit int) ([]models.SearchHistory, int64, error)
+	// Delete deletes the searches of a user for good, only the search id
+	// unless it is 0
+	Delete(ctx context.Context, userID, id uint) error
+	// Paused tells whether recording the searches of a user is paused
+	Paused(ctx context.Context, userID uint) (bool, error)
+	Pause(ctx context.Context, userID uint, paused bool) (*models.SearchHistorySettings, error)
+}
+
+type searchHistoryService struct {
+	db *gorm.DB
+}
+
+// NewSearchHistory returns the search histories stored in db.
+func NewSearchHistory(db *gorm.DB) SearchHistory {
+	return &searchHistoryService{db: db}
+}
+
+func (s *searchHistoryService) List(ctx context.Context, userID uint, page, limit int) ([]models.SearchHistory, int64, error) {
+	var total int64
+	searches := []models.SearchHistory{}
+	tx := s.db.WithContext(ctx).Model(&models.SearchHistory{}).Where("user_id = ?", userID)
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&searches).Error; err != nil {
+		return nil, 0, err
+	}
+	return searches, total, nil
+}
+
+func (s *searchHistoryService) Delete(ctx context.Context, userID, id uint) error {
+	tx := s.db.WithContext(ctx).Unscoped().Where("user_id = ?", userID)
+	if id != 0 {
+		tx = tx.Where("id = ?", id)
+	}
+	return tx.Delete(&models.SearchHistory{}).Error
+}
+
+func (s *searchHistoryService) Paused(ctx context.Context, userID uint) (bool, error) {
+	return models.SearchHistoryPaused(s.db.WithContext(ctx), userID)
+}
+
+func (s *searchHistoryService) Pause(ctx context.Context, userID uint, paused bool) (*models.SearchHistorySettings, error) {
+	return models.PauseSearchHistory(s.db.WithContext(ctx), userID, paused)
+}
@@ -0,0 +1,38 @@
+// Package services holds what the handlers do behind interfaces: users,
+// products, search, search histories, webhooks, admin tasks, media and
+// messaging. The implementations are built by the application container
+// from the database, Redis and the message broker, handlers only see the
+// interfaces so tests can swap in fakes.
+package services
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/repository"
+)
+
+var (
+	// ErrNotFound is returned for a record that does not exist
+	ErrNotFound = repository.ErrNotFound
+	// ErrConflict is returned for a record clashing with a stored one
+	ErrConflict = repository.ErrConflict
+	// ErrInvalid is returned for an invalid record, see
+	// repository.ValidationError
+	ErrInvalid = repository.ErrInvalid
+	// ErrInvalidCredentials is returned for a sign-in with an unknown email
+	// or a wrong password
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidResetToken is returned for an unknown or expired password
+	// reset token
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+// notFound returns ErrNotFound for a missing record, else err.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+	"github.com/r3tr056/ecolens_api/pkg/utils/email"
+)
+
+// Users manages the accounts of the API.
+type Users interface {
+	// SignUp creates an account, the returned user has no password hash
+	SignUp(ctx context.Context, signUp *models.SignUp) (*models.User, error)
+	// SignIn checks the credentials of a user and issues their tokens
+	SignIn(ctx context.Context, email, password string) (*models.User, *utils.Tokens, error)
+	List(ctx context.Context, page, limit int) ([]models.User, error)
+	// Get returns a user with their uploaded images and recent searches
+	Get(ctx context.Context, id uint) (*models.User, error)
+	Update(ctx context.Context, id uint, update *models.UserUpdate) error
+	Delete(ctx context.Context, id uint) error
+	// Role returns the role of a user, for the role protected endpoints
+	Role(ctx context.Context, id uint) (string, error)
+	// RequestPasswordReset emails a reset token to the user
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// recentSearchHistory is the number of searches a user is returned with
+const recentSearchHistory = 20
+
+// resetTokenTTL is how long a password reset token is valid
+const resetTokenTTL = time.Hour
+
+type userService struct {
+	users  repository.Users
+	images repository.Images
+	// db holds the search histories
+	db *gorm.DB
+
+	mu          sync.Mutex
+	resetTokens map[string]models.ResetTokenInfo
+}
+
+// NewUsers returns the users of repos, their search histories are read from
+// db.
+func NewUsers(repos *repository.Repositories, db *gorm.DB) Users {
+	return &userService{
+		users:       repos.Users,
+		images:      repos.Images,
+		db:          db,
+		resetTokens: map[string]models.ResetTokenInfo{},
+	}
+}
+
+func (s *userService) SignUp(ctx context.Context, signUp *models.SignUp) (*models.User, error) {
+	hashedPassword, err := utils.GeneratePassword(signUp.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Email:        signUp.Email,
+		PasswordHash: hashedPassword,
+		UserStatus:   1,
+		UserRole:     models.RoleUser,
+	}
+	user.CreatedAt = time.Now()
+
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	user.PasswordHash = ""
+	return user, nil
+}
+
+func (s *userService) SignIn(ctx context.Context, email, password string) (*models.User, *utils.Tokens, error) {
+	user, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil, ErrInvalidCredentials
+		}
+		return nil, nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	tokens, err := utils.GenerateNewTokens(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+func (s *userService) List(ctx context.Context, page, limit int) ([]models.User, error) {
+	return s.users.List(ctx, (page-1)*limit, limit)
+}
+
+func (s *userService) Get(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.users.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.UploadedImages, err = s.images.ListByUser(ctx, id); err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Where("user_id = ?", id).Order("id DESC").Limit(recentSearchHistory).Find(&user.SearchHistory).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) Update(ctx context.Context, id uint, update *models.UserUpdate) error {
+	return s.users.Update(ctx, id, update)
+}
+
+func (s *userService) Delete(ctx context.Context, id uint) error {
+	return s.users.Delete(ctx, id)
+}
+
+func (s *userService) Role(ctx context.Context, id uint) (string, error) {
+	user, err := s.users.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return user.UserRole, nil
+}
+
+func (s *userService) RequestPasswordReset(ctx context.Context, address string) error {
+	user, err := s.users.GetByEmail(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	token := generateResetToken()
+	s.mu.Lock()
+	s.resetTokens[token] = models.ResetTokenInfo{
+		UserID:         user.ID,
+		ExpirationTime: time.Now().Add(resetTokenTTL),
+	}
+	s.mu.Unlock()
+
+	name := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+	if err := email.SendResetEmail(user.Email, name, user.Username, token); err != nil {
+		return fmt.Errorf("failed to send the reset email: %w", err)
+	}
+	return nil
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	s.mu.Lock()
+	tokenInfo, ok := s.resetTokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(tokenInfo.ExpirationTime) {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := utils.GeneratePassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetPassword(ctx, tokenInfo.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.resetTokens, token)
+	s.mu.Unlock()
+	return nil
+}
+
+func generateResetToken() string {
+	const tokenLength = 16
+	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	b := make([]byte, tokenLength)
+	for i := range b {
+		b[i] = letterBytes[random.Intn(len(letterBytes))]
+	}
+
+	return string(b)
+}
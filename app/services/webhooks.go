@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// Webhooks manages the webhook subscriptions of the partners.
+type Webhooks interface {
+	// Create stores a new subscription and sets its ID
+	Create(ctx context.Context, sub *models.WebhookSubscription) error
+	List(ctx context.Context, userID uint) ([]models.WebhookSubscription, error)
+	// Get returns ErrNotFound unless the subscription belongs to userID
+	Get(ctx context.Context, userID, id uint) (*models.WebhookSubscription, error)
+	// Delete deletes a subscription and cancels its pending deliveries
+	Delete(ctx context.Context, sub *models.WebhookSubscription) error
+	// Enable re-enables a subscription disabled after failed deliveries
+	Enable(ctx context.Context, sub *models.WebhookSubscription) error
+	// Deliveries returns a page of the deliveries of a subscription, newest
+	// first, and their attempts
+	Deliveries(ctx context.Context, subscriptionID uint, page, limit int) ([]models.WebhookDelivery, []models.WebhookAttempt, error)
+}
+
+type webhookService struct {
+	db *gorm.DB
+}
+
+// NewWebhooks returns the webhook subscriptions stored in db.
+func NewWebhooks(db *gorm.DB) Webhooks {
+	return &webhookService{db: db}
+}
+
+func (s *webhookService) Create(ctx context.Context, sub *models.WebhookSubscription) error {
+	return s.db.WithContext(ctx).Create(sub).Error
+}
+
+func (s *webhookService) List(ctx context.Context, userID uint) ([]models.WebhookSubscription, error) {
+	subs := []models.WebhookSubscription{}
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (s *webhookService) Get(ctx context.Context, userID, id uint) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&sub, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sub, nil
+}
+
+func (s *webhookService) Delete(ctx context.Context, sub *models.WebhookSubscription) error {
+	// its pending deliveries are not sent anymore
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", sub.ID, models.DeliveryPending).
+			Updates(map[string]interface{}{"status": models.DeliveryCancelled, "last_error": "subscription was deleted"}).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(sub).Error
+	})
+}
+
+func (s *webhookService) Enable(ctx context.Context, sub *models.WebhookSubscription) error {
+	sub.Active = true
+	sub.ConsecutiveFailures = 0
+	sub.DisabledAt = nil
+	sub.DisabledReason = ""
+	return s.db.WithContext(ctx).Save(sub).Error
+}
+
+func (s *webhookService) Deliveries(ctx context.Context, subscriptionID uint, page, limit int) ([]models.WebhookDelivery, []models.WebhookAttempt, error) {
+	db := s.db.WithContext(ctx)
+
+	var deliveries []models.WebhookDelivery
+	err := db.Where("subscription_id = ?", subscriptionID).Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]uint, len(deliveries))
+	for i := range deliveries {
+		ids[i] = deliveries[i].ID
+	}
+
+	var attempts []models.WebhookAttempt
+	if len(ids) > 0 {
+		if err := db.Where("delivery_id IN ?", ids).Order("id").Find(&attempts).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return deliveries, attempts, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
+)
+
+const recomputeEcoScoresUsage = "[-type product|marketplace_product] [-id id] [-timeout duration]"
+
+var recomputeEcoScoresCommand = &command{
+	usage:    recomputeEcoScoresUsage,
+	summary:  "have the ML workers score the products again",
+	sections: []string{"broker"},
+	run:      runRecomputeEcoScores,
+}
+
+// productTables are the tables of the product types the workers analyse
+var productTables = map[string]string{
+	models.AggregateProduct:            "products",
+	models.AggregateMarketPlaceProduct: "marketplace_products",
+}
+
+type ecoScoreReport struct {
+	ProductType string           `json:"product_type"`
+	Scores      []ecoScoreChange `json:"scores"`
+	Failed      []ecoScoreError  `json:"failed"`
+}
+
+type ecoScoreChange struct {
+	ProductID uint     `json:"product_id"`
+	Name      string   `json:"name"`
+	Previous  *float64 `json:"previous"`
+	EcoScore  float64  `json:"eco_score"`
+}
+
+type ecoScoreError struct {
+	ProductID uint   `json:"product_id"`
+	Error     string `json:"error"`
+}
+
+func (r *ecoScoreReport) String() string {
+	var b strings.Builder
+	for _, score := range r.Scores {
+		previous := "none"
+		if score.Previous != nil {
+			previous = fmt.Sprintf("%g", *score.Previous)
+		}
+		fmt.Fprintf(&b, "%s %d %q: %s -> %g\n", r.ProductType, score.ProductID, score.Name, previous, score.EcoScore)
+	}
+	for _, failed := range r.Failed {
+		fmt.Fprintf(&b, "%s %d: %s\n", r.ProductType, failed.ProductID, failed.Error)
+	}
+	fmt.Fprintf(&b, "%d scored, %d failed\n", len(r.Scores), len(r.Failed))
+	return b.String()
+}
+
+// runRecomputeEcoScores asks the ML workers to analyse products again and
+// stores the eco scores they return, announcing score.changed events. The
+// workers are asked on dry runs too, only the scores are not stored.
+func runRecomputeEcoScores(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("recompute-eco-scores", recomputeEcoScoresUsage)
+	productType := flags.String("type", models.AggregateProduct, "product type, product or marketplace_product")
+	id := flags.Uint("id", 0, "only score the product with this ID")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the analysis of a product")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	table, ok := productTables[*productType]
+	if !ok {
+		return nil, fmt.Errorf("unknown product type %q", *productType)
+	}
+
+	var products []models.Product
+	scope := database.WithContext(ctx).Table(table).Select("id", "name", "eco_score").Where("deleted_at IS NULL").Order("id")
+	if *id != 0 {
+		scope = scope.Where("id = ?", *id)
+	}
+	if err := scope.Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	broker, err := pubsub.NewBroker(ctx, pubsub.BrokerConfig{
+		Backend:        cfg.Broker.Backend,
+		GoogleProject:  cfg.Broker.GoogleProject,
+		RedisAddr:      cfg.Broker.RedisAddr,
+		RedisDB:        cfg.Broker.RedisDB,
+		RedisGroupIdle: cfg.Broker.RedisIdle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the message broker: %w", err)
+	}
+	client, err := pubsub.NewPubSubClient(broker, cfg.Broker.SearchTopic, cfg.Broker.SearchSubscription, nil)
+	if err != nil {
+		broker.Close()
+		return nil, err
+	}
+	client.StartListening()
+	defer client.Close()
+	defer client.StopListening()
+
+	analyse := client.RemoteMethod(contracts.MethodProductAnalysis, *timeout)
+	report := &ecoScoreReport{ProductType: *productType, Scores: []ecoScoreChange{}, Failed: []ecoScoreError{}}
+	for _, product := range products {
+		score, err := analysisScore(analyse(&contracts.ProductAnalysisArgs{ProductID: product.ID, ProductType: *productType}))
+		if err == nil {
+			err = opts.transaction(ctx, func(tx *gorm.DB) error {
+				return saveEcoScore(tx, table, *productType, &product, score)
+			})
+		}
+		if err != nil {
+			report.Failed = append(report.Failed, ecoScoreError{ProductID: product.ID, Error: err.Error()})
+			continue
+		}
+		report.Scores = append(report.Scores, ecoScoreChange{ProductID: product.ID, Name: product.Name, Previous: product.EcoScore, EcoScore: score})
+	}
+
+	if !opts.dryRun && len(report.Scores) > 0 {
+		invalidateSearches(ctx)
+	}
+	return report, nil
+}
+
+// analysisScore returns the eco score of a product analysis, legacy
+// workers answer with untyped JSON.
+func analysisScore(result interface{}, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch result := result.(type) {
+	case *contracts.ProductAnalysisResult:
+		return result.EcoScore, nil
+	case json.RawMessage:
+		var analysis contracts.ProductAnalysisResult
+		if err := json.Unmarshal(result, &analysis); err != nil {
+			return 0, fmt.Errorf("invalid analysis: %v", err)
+		}
+		return analysis.EcoScore, nil
+	}
+	return 0, fmt.Errorf("unexpected analysis result %T", result)
+}
+
+func saveEcoScore(tx *gorm.DB, table, productType string, product *models.Product, score float64) error {
+	now := time.Now()
+	err := tx.Table(table).Where("id = ?", product.ID).Updates(map[string]interface{}{"eco_score": score, "updated_at": now}).Error
+	if err != nil {
+		return err
+	}
+	return models.RecordEvent(tx, productType, product.ID, models.EventScoreChanged, now, models.ProductEvent{
+		ProductID:   product.ID,
+		ProductType: productType,
+		Name:        product.Name,
+		OccurredAt:  now,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+const importEPDUsage = "file.json..."
+
+var importEPDCommand = &command{
+	usage:   importEPDUsage,
+	summary: "import environmental product declarations from JSON files",
+	run:     runImportEPD,
+}
+
+// epdFile is a declaration of an EPD file, which holds one or a list of
+// them. The product is found by ID, else by barcode.
+type epdFile struct {
+	ProductID   uint   `json:"product_id" validate:"required_without=Barcode"`
+	Barcode     string `json:"barcode" validate:"required_without=ProductID"`
+	Description string `json:"description"`
+	LCAMetrics  []struct {
+		Name  string  `json:"name" validate:"required"`
+		Value float64 `json:"value"`
+		Unit  string  `json:"unit" validate:"required"`
+	} `json:"lca_metrics" validate:"required,min=1,dive"`
+}
+
+type epdReport struct {
+	Imported []importedEPD `json:"imported"`
+}
+
+type importedEPD struct {
+	File      string `json:"file"`
+	ProductID uint   `json:"product_id"`
+	EPDID     uint   `json:"epd_id"`
+	Metrics   int    `json:"metrics"`
+	Created   bool   `json:"created"`
+}
+
+func (r *epdReport) String() string {
+	var b strings.Builder
+	for _, epd := range r.Imported {
+		action := "replaced"
+		if epd.Created {
+			action = "created"
+		}
+		fmt.Fprintf(&b, "%s: %s EPD %d of product %d, %d metrics\n", epd.File, action, epd.EPDID, epd.ProductID, epd.Metrics)
+	}
+	return b.String()
+}
+
+// readEPDFile reads the declarations of a file, a JSON object or array.
+func readEPDFile(path string) ([]epdFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var declarations []epdFile
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		declarations = make([]epdFile, 1)
+		err = json.Unmarshal(data, &declarations[0])
+	} else {
+		err = json.Unmarshal(data, &declarations)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	validate := utils.NewValidator()
+	for i := range declarations {
+		if err := validate.Struct(&declarations[i]); err != nil {
+			return nil, fmt.Errorf("%s: declaration %d: %v", path, i+1, utils.ValidateErrors(err))
+		}
+	}
+	return declarations, nil
+}
+
+// runImportEPD imports the EPDs of the files, replacing the EPD and LCA
+// metrics a product had. All files are imported in one transaction, an
+// invalid one imports none.
+func runImportEPD(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("import-epd", importEPDUsage)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() == 0 {
+		return nil, errors.New("no EPD file given")
+	}
+
+	report := &epdReport{Imported: []importedEPD{}}
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		for _, path := range flags.Args() {
+			declarations, err := readEPDFile(path)
+			if err != nil {
+				return err
+			}
+			for i, declaration := range declarations {
+				imported, err := importEPD(ctx, tx, declaration)
+				if err != nil {
+					return fmt.Errorf("%s: declaration %d: %w", path, i+1, err)
+				}
+				imported.File = path
+				report.Imported = append(report.Imported, *imported)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.dryRun && len(report.Imported) > 0 {
+		invalidateSearches(ctx)
+	}
+	return report, nil
+}
+
+func importEPD(ctx context.Context, tx *gorm.DB, declaration epdFile) (*importedEPD, error) {
+	var product models.Product
+	scope := tx.Select("id", "name")
+	if declaration.ProductID != 0 {
+		scope = scope.Where("id = ?", declaration.ProductID)
+	} else {
+		scope = scope.Where("barcode = ?", declaration.Barcode)
+	}
+	if err := scope.First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("product not found")
+		}
+		return nil, err
+	}
+
+	epd := &models.EnvironmentalProductDeclaration{
+		ProductID:   product.ID,
+		Description: declaration.Description,
+		LCAMetrics:  make([]models.LCAMetrics, len(declaration.LCAMetrics)),
+	}
+	for i, metric := range declaration.LCAMetrics {
+		epd.LCAMetrics[i] = models.LCAMetrics{Name: metric.Name, Value: metric.Value, Unit: metric.Unit}
+	}
+
+	// the EPD replaces the product's one and records its epd.changed event
+	created, err := repository.NewPostgres(tx).EPDs.Save(ctx, epd)
+	if err != nil {
+		return nil, err
+	}
+	return &importedEPD{ProductID: product.ID, EPDID: epd.ID, Metrics: len(epd.LCAMetrics), Created: created}, nil
+}
@@ -0,0 +1,169 @@
+// Command ecolensctl runs the operational tasks of the API against its
+// database: migrations, seeding, user administration and maintenance.
+//
+// Usage:
+//
+//	ecolensctl [-dry-run] [-json] <command> [flags]
+//
+// With -dry-run the database changes of a command are rolled back, and no
+// other side effect is made, so its report tells what it would do. With
+// -json the report is printed as JSON for scripts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/config"
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/platform/db"
+)
+
+// command is a subcommand of ecolensctl. run returns the report of the
+// command, printed with its String method or as JSON. sections are the
+// configuration sections it needs besides the common ones.
+type command struct {
+	usage    string
+	summary  string
+	sections []string
+	run      func(ctx context.Context, opts *options, args []string) (fmt.Stringer, error)
+}
+
+// commonSections are the configuration sections every command needs
+var commonSections = []string{"postgres", "redis", "search", "semantic"}
+
+// cfg is the configuration, loaded before the command runs
+var cfg *config.Config
+
+// database is the connection to the database, opened before the command
+// runs
+var database *gorm.DB
+
+var commands = map[string]*command{
+	"migrate":              migrateCommand,
+	"seed":                 seedCommand,
+	"create-admin":         createAdminCommand,
+	"reset-password":       resetPasswordCommand,
+	"reindex":              reindexCommand,
+	"recompute-eco-scores": recomputeEcoScoresCommand,
+	"import-epd":           importEPDCommand,
+	"purge":                purgeCommand,
+}
+
+// options are the flags every command takes.
+type options struct {
+	dryRun bool
+	json   bool
+}
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// transaction runs fn in a transaction, rolled back on dry runs.
+func (o *options) transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if o.dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ecolensctl [-dry-run] [-json] <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-22s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	opts := &options{}
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "report the changes without making them")
+	flag.BoolVar(&opts.json, "json", false, "print the report as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(cmd, opts, flag.Args()[1:]); err != nil {
+		if opts.json {
+			json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"error": true, "message": err.Error()})
+		} else {
+			fmt.Fprintf(os.Stderr, "ecolensctl %s: %v\n", flag.Arg(0), err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(cmd *command, opts *options, args []string) error {
+	var err error
+	cfg, err = config.Load(append(commonSections, cmd.sections...)...)
+	if err != nil {
+		return err
+	}
+
+	languages, err := locale.New(cfg.Search.DefaultLanguage, cfg.Search.Languages)
+	if err != nil {
+		return fmt.Errorf("failed to configure the search languages: %w", err)
+	}
+	models.DefaultLanguage = languages.Default
+
+	database, err = db.OpenPostgresConnection(cfg.Postgres.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to the database: %w", err)
+	}
+
+	report, err := cmd.run(context.Background(), opts, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if opts.dryRun {
+		fmt.Println("dry run, nothing was changed")
+	}
+	fmt.Print(report.String())
+	return nil
+}
+
+// newFlagSet returns the flag set of a command, whose errors are returned.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ecolensctl %s %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/r3tr056/ecolens_api/platform/db"
+	"github.com/r3tr056/ecolens_api/platform/migrate"
+)
+
+const migrateUsage = "up | down [steps] | status"
+
+var migrateCommand = &command{
+	usage:   migrateUsage,
+	summary: "apply, roll back or list the schema migrations",
+	run:     runMigrate,
+}
+
+type migrateReport struct {
+	Action     string           `json:"action"`
+	Migrations []migrate.Status `json:"migrations"`
+}
+
+func (r *migrateReport) String() string {
+	var b strings.Builder
+	if len(r.Migrations) == 0 && r.Action != "status" {
+		fmt.Fprintf(&b, "no migrations to %s\n", r.Action)
+	}
+	for _, m := range r.Migrations {
+		appliedAt := "-"
+		if m.AppliedAt != nil {
+			appliedAt = m.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&b, "%04d  %-40s %-8s %s\n", m.Version, m.Name, m.State, appliedAt)
+	}
+	return b.String()
+}
+
+// runMigrate applies or rolls back migrations. Each migration commits its
+// own transaction, so dry runs only list the migrations that would run.
+func runMigrate(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: ecolensctl migrate %s", migrateUsage)
+	}
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &migrateReport{Action: args[0], Migrations: []migrate.Status{}}
+	switch args[0] {
+	case "status":
+		report.Migrations = statuses
+
+	case "up":
+		for _, status := range statuses {
+			if status.State == migrate.StatePending {
+				report.Migrations = append(report.Migrations, status)
+			}
+		}
+		if !opts.dryRun {
+			if _, err := migrator.Up(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return nil, fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		for i := len(statuses) - 1; i >= 0 && len(report.Migrations) < steps; i-- {
+			if statuses[i].State != migrate.StatePending && statuses[i].State != migrate.StateUnknown {
+				report.Migrations = append(report.Migrations, statuses[i])
+			}
+		}
+		if !opts.dryRun {
+			if _, err := migrator.Down(ctx, steps); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown action %q, usage: ecolensctl migrate %s", args[0], migrateUsage)
+	}
+
+	return report, nil
+}
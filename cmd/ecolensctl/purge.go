@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const purgeUsage = "[-older-than duration] [-tables table,...]"
+
+var purgeCommand = &command{
+	usage:   purgeUsage,
+	summary: "delete the soft-deleted records for good",
+	run:     runPurge,
+}
+
+// purgeTable is a table with soft-deleted rows. Rows still referenced by
+// the columns of references, as table.column, are kept.
+type purgeTable struct {
+	name       string
+	references []string
+}
+
+// purgeTables are purged in order, so rows referencing others go first.
+// Translations and embeddings go with their product.
+var purgeTables = []purgeTable{
+	{name: "lca_metrics"},
+	{name: "environmental_product_declarations", references: []string{"lca_metrics.epd_id"}},
+	{name: "reports"},
+	{name: "product_images"},
+	{name: "environment_tags"},
+	{name: "products", references: []string{
+		"environmental_product_declarations.product_id", "reports.epd_id",
+		"product_images.product_id", "environment_tags.product_id",
+	}},
+	{name: "marketplace_products"},
+	{name: "brands", references: []string{"products.brand_id", "marketplace_products.brand_id"}},
+	{name: "categories", references: []string{"products.category_id", "marketplace_products.category_id"}},
+	{name: "search_histories"},
+	{name: "uploaded_images"},
+	{name: "users", references: []string{"search_histories.user_id"}},
+	{name: "synonym_groups"},
+	{name: "dead_letters"},
+}
+
+type purgeReport struct {
+	DeletedBefore time.Time     `json:"deleted_before"`
+	Tables        []purgedTable `json:"tables"`
+}
+
+type purgedTable struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+func (r *purgeReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "records deleted before %s:\n", r.DeletedBefore.Format(time.RFC3339))
+	for _, table := range r.Tables {
+		fmt.Fprintf(&b, "%s: %d rows\n", table.Table, table.Rows)
+	}
+	return b.String()
+}
+
+// runPurge deletes the rows soft-deleted longer ago than -older-than, in
+// one transaction.
+func runPurge(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("purge", purgeUsage)
+	olderThan := flags.Duration("older-than", 30*24*time.Hour, "only purge records deleted longer ago")
+	only := flags.String("tables", "", "comma separated tables to purge, all when empty")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	if *only != "" {
+		known := map[string]bool{}
+		for _, table := range purgeTables {
+			known[table.name] = true
+		}
+		for _, name := range strings.Split(*only, ",") {
+			name = strings.TrimSpace(name)
+			if !known[name] {
+				return nil, fmt.Errorf("table %q has no soft-deleted records", name)
+			}
+			selected[name] = true
+		}
+	}
+
+	report := &purgeReport{DeletedBefore: time.Now().Add(-*olderThan), Tables: []purgedTable{}}
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		for _, table := range purgeTables {
+			if len(selected) > 0 && !selected[table.name] {
+				continue
+			}
+
+			sql := "DELETE FROM " + table.name + " t WHERE t.deleted_at < ?"
+			for _, reference := range table.references {
+				column := strings.SplitN(reference, ".", 2)
+				sql += " AND NOT EXISTS (SELECT 1 FROM " + column[0] + " r WHERE r." + column[1] + " = t.id)"
+			}
+
+			result := tx.Exec(sql, report.DeletedBefore)
+			if result.Error != nil {
+				return fmt.Errorf("failed to purge %s: %w", table.name, result.Error)
+			}
+			report.Tables = append(report.Tables, purgedTable{Table: table.name, Rows: result.RowsAffected})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
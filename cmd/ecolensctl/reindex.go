@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/db"
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+	"github.com/r3tr056/ecolens_api/platform/semantic"
+	"github.com/r3tr056/ecolens_api/platform/suggest"
+)
+
+const reindexUsage = "[-only vectors,suggest,embeddings,cache]"
+
+var reindexCommand = &command{
+	usage:   reindexUsage,
+	summary: "rebuild the search vectors, autocomplete index and embeddings",
+	run:     runReindex,
+}
+
+// Indexes rebuilt by reindex, in order
+const (
+	indexVectors    = "vectors"
+	indexSuggest    = "suggest"
+	indexEmbeddings = "embeddings"
+	indexCache      = "cache"
+)
+
+var indexes = []string{indexVectors, indexSuggest, indexEmbeddings, indexCache}
+
+type reindexReport struct {
+	Indexes []reindexed `json:"indexes"`
+}
+
+type reindexed struct {
+	Index string `json:"index"`
+	// Rows is the number of rows indexed, or to index on dry runs
+	Rows int64 `json:"rows"`
+	// Skipped is set on dry runs of the steps that cannot be rolled back,
+	// and for the embeddings when semantic search is disabled
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func (r *reindexReport) String() string {
+	var b strings.Builder
+	for _, index := range r.Indexes {
+		switch {
+		case index.Skipped:
+			fmt.Fprintf(&b, "%s: skipped\n", index.Index)
+		case index.Index == indexEmbeddings:
+			fmt.Fprintf(&b, "%s: synced\n", index.Index)
+		case index.Index == indexCache:
+			fmt.Fprintf(&b, "%s: invalidated\n", index.Index)
+		default:
+			fmt.Fprintf(&b, "%s: %d rows\n", index.Index, index.Rows)
+		}
+	}
+	return b.String()
+}
+
+// searchNamespaces are all the namespaces of the search cache
+var searchNamespaces = []string{searchcache.Products, searchcache.MarketplaceProducts, searchcache.Reports}
+
+// searchRedis is the Redis of the search cache and autocomplete, connected
+// by redisClient
+var searchRedis *redis.Client
+
+// redisClient connects to the Redis of the search cache and autocomplete.
+func redisClient() *redis.Client {
+	if searchRedis == nil {
+		searchRedis = db.CreateRedisClient(cfg.Redis.SearchCacheAddr, cfg.Redis.SearchCacheDB)
+	}
+	return searchRedis
+}
+
+// invalidateSearches drops the cached searches after changes to the
+// catalogue. A failure is only logged, the entries expire on their own.
+func invalidateSearches(ctx context.Context) {
+	cache := searchcache.New(redisClient(), searchcache.Options{
+		TTL:      cfg.Search.CacheTTL,
+		StaleTTL: cfg.Search.CacheStaleTTL,
+	})
+	if err := cache.Invalidate(ctx, searchNamespaces...); err != nil {
+		log.Printf("Failed to invalidate the search cache: %v", err)
+	}
+}
+
+// runReindex rebuilds the search indexes from the catalogue: the stored
+// search vectors of products, the autocomplete index in Redis, the
+// embeddings of the semantic search and the cached searches.
+func runReindex(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("reindex", reindexUsage)
+	only := flags.String("only", strings.Join(indexes, ","), "comma separated indexes to rebuild")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, index := range strings.Split(*only, ",") {
+		index = strings.TrimSpace(index)
+		if !contains(indexes, index) {
+			return nil, fmt.Errorf("unknown index %q, expected some of %s", index, strings.Join(indexes, ","))
+		}
+		selected[index] = true
+	}
+
+	report := &reindexReport{Indexes: []reindexed{}}
+	for _, index := range indexes {
+		if !selected[index] {
+			continue
+		}
+
+		result := reindexed{Index: index}
+		var err error
+		switch index {
+		case indexVectors:
+			result.Rows, err = reindexVectors(ctx, opts)
+		case indexSuggest:
+			result.Rows, err = reindexSuggest(ctx, opts)
+		case indexEmbeddings:
+			result.Skipped, err = reindexEmbeddings(ctx, opts)
+		case indexCache:
+			result.Skipped = opts.dryRun
+			if !opts.dryRun {
+				invalidateSearches(ctx)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild the %s index: %w", index, err)
+		}
+		report.Indexes = append(report.Indexes, result)
+	}
+
+	return report, nil
+}
+
+// reindexVectors recomputes the search vectors of products, touching their
+// brand fires the triggers maintaining them. Those of reports and
+// translations are generated columns, always current.
+func reindexVectors(ctx context.Context, opts *options) (int64, error) {
+	var rows int64
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		for _, table := range []string{"products", "marketplace_products"} {
+			result := tx.Exec("UPDATE " + table + " SET brand_id = brand_id")
+			if result.Error != nil {
+				return result.Error
+			}
+			rows += result.RowsAffected
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// reindexSuggest rebuilds the autocomplete index, dry runs count the names
+// it would index.
+func reindexSuggest(ctx context.Context, opts *options) (int64, error) {
+	if opts.dryRun {
+		var rows int64
+		for _, model := range []interface{}{&models.Product{}, &models.Brand{}, &models.Category{}} {
+			var count int64
+			if err := database.WithContext(ctx).Model(model).Count(&count).Error; err != nil {
+				return 0, err
+			}
+			rows += count
+		}
+		return rows, nil
+	}
+
+	indexed, err := suggest.NewIndex(redisClient()).Rebuild(ctx, database)
+	return int64(indexed), err
+}
+
+// reindexEmbeddings embeds the new and changed products and reports with
+// the configured embedder, as the API would within a minute. It is skipped
+// when semantic search is disabled.
+func reindexEmbeddings(ctx context.Context, opts *options) (bool, error) {
+	if opts.dryRun {
+		return true, nil
+	}
+
+	embedder, err := semantic.NewEmbedder(cfg.Semantic.EmbeddingsURL, cfg.Semantic.EmbeddingsAPIKey, cfg.Semantic.EmbeddingsModel, cfg.Semantic.EmbeddingsDimensions)
+	if err != nil || embedder == nil {
+		return true, err
+	}
+	if err := models.EnsureEmbeddingIndex(ctx, database, embedder.Model(), embedder.Dimensions()); err != nil {
+		return false, err
+	}
+	return false, semantic.NewService(database, embedder, cfg.Semantic.MinSimilarity).Sync(ctx)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+var seedCommand = &command{
+	summary: "add the demo categories, brands and products",
+	run:     runSeed,
+}
+
+// demoProduct is a product of the demo catalogue, by brand and category
+// name.
+type demoProduct struct {
+	name, brand, category, description string
+	price, ecoScore                    float64
+}
+
+var demoCategories = []models.Category{
+	{Name: "Personal care", Description: "Soaps, shampoos and toothpaste"},
+	{Name: "Household", Description: "Cleaning and laundry products"},
+	{Name: "Food and drink", Description: "Packaged food and beverages"},
+	{Name: "Clothing", Description: "Apparel and shoes"},
+}
+
+var demoBrands = []string{"GreenLeaf", "PureEarth", "Ecovia", "Terra Threads"}
+
+var demoProducts = []demoProduct{
+	{"Bamboo toothbrush", "GreenLeaf", "Personal care", "Biodegradable bamboo handle with plant-based bristles", 3.5, 86},
+	{"Solid shampoo bar", "PureEarth", "Personal care", "Plastic-free shampoo bar with coconut oil", 8.9, 82},
+	{"Refillable hand soap", "Ecovia", "Personal care", "Glass bottle hand soap with refill pouches", 6.5, 71},
+	{"Laundry detergent sheets", "Ecovia", "Household", "Pre-measured detergent sheets in a cardboard box", 12, 74},
+	{"Compostable sponges", "GreenLeaf", "Household", "Cellulose sponges that compost at home", 4.2, 68},
+	{"All-purpose cleaner concentrate", "PureEarth", "Household", "Concentrate diluted in a reusable spray bottle", 5.9, 63},
+	{"Organic oat drink", "PureEarth", "Food and drink", "Oat drink from organic farming in a recyclable carton", 2.4, 58},
+	{"Fair trade coffee beans", "GreenLeaf", "Food and drink", "Shade-grown coffee in a compostable bag", 9.8, 55},
+	{"Bottled spring water", "Ecovia", "Food and drink", "Spring water in a plastic bottle", 0.9, 22},
+	{"Organic cotton t-shirt", "Terra Threads", "Clothing", "T-shirt of organic cotton dyed without toxic chemicals", 19, 66},
+	{"Recycled polyester jacket", "Terra Threads", "Clothing", "Rain jacket of recycled plastic bottles", 89, 48},
+	{"Fast fashion jeans", "Terra Threads", "Clothing", "Conventional cotton jeans", 25, 15},
+}
+
+type seedReport struct {
+	Categories seedCounts `json:"categories"`
+	Brands     seedCounts `json:"brands"`
+	Products   seedCounts `json:"products"`
+}
+
+type seedCounts struct {
+	Created  int `json:"created"`
+	Existing int `json:"existing"`
+}
+
+func (r *seedReport) String() string {
+	return fmt.Sprintf("categories: %d created, %d existing\nbrands: %d created, %d existing\nproducts: %d created, %d existing\n",
+		r.Categories.Created, r.Categories.Existing,
+		r.Brands.Created, r.Brands.Existing,
+		r.Products.Created, r.Products.Existing)
+}
+
+// runSeed adds the demo catalogue, keeping the rows that already exist by
+// name, so seeding twice changes nothing. New products are announced in
+// the outbox like those added through the API.
+func runSeed(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("seed", "")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	report := &seedReport{}
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		categories := map[string]uint{}
+		for _, demo := range demoCategories {
+			category := demo
+			created, err := firstOrCreate(tx, &category, "name = ?", category.Name)
+			if err != nil {
+				return err
+			}
+			report.Categories.count(created)
+			categories[category.Name] = category.ID
+		}
+
+		brands := map[string]uint{}
+		for _, name := range demoBrands {
+			brand := models.Brand{Name: name}
+			created, err := firstOrCreate(tx, &brand, "name = ?", name)
+			if err != nil {
+				return err
+			}
+			report.Brands.count(created)
+			brands[name] = brand.ID
+		}
+
+		for _, demo := range demoProducts {
+			ecoScore := demo.ecoScore
+			product := models.Product{
+				Name:        demo.name,
+				BrandID:     brands[demo.brand],
+				CategoryID:  categories[demo.category],
+				Description: demo.description,
+				Price:       demo.price,
+				EcoScore:    &ecoScore,
+			}
+			created, err := firstOrCreate(tx, &product, "name = ?", demo.name)
+			if err != nil {
+				return err
+			}
+			report.Products.count(created)
+			if created {
+				if err := models.RecordProductEvents(tx, models.AggregateProduct, product.ID, models.EventProductCreated, &product); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.dryRun && report.Products.Created > 0 {
+		invalidateSearches(ctx)
+	}
+	return report, nil
+}
+
+func (c *seedCounts) count(created bool) {
+	if created {
+		c.Created++
+	} else {
+		c.Existing++
+	}
+}
+
+// firstOrCreate loads the row matching the condition into value, or
+// creates value when there is none, and tells whether it did.
+func firstOrCreate(tx *gorm.DB, value interface{}, condition string, args ...interface{}) (bool, error) {
+	result := tx.Where(condition, args...).Limit(1).Find(value)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+	return true, tx.Omit(clause.Associations).Create(value).Error
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+const (
+	createAdminUsage   = "-email address [-role admin|partner] [-password password] [-username name]"
+	resetPasswordUsage = "-email address [-password password]"
+)
+
+var createAdminCommand = &command{
+	usage:   createAdminUsage,
+	summary: "create an admin or partner user, or grant the role to an existing user",
+	run:     runCreateAdmin,
+}
+
+var resetPasswordCommand = &command{
+	usage:   resetPasswordUsage,
+	summary: "set the password of a user",
+	run:     runResetPassword,
+}
+
+type userReport struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Created bool   `json:"created"`
+	// Password is only reported when it was generated
+	Password string `json:"password,omitempty"`
+}
+
+func (r *userReport) String() string {
+	s := fmt.Sprintf("user %d <%s>, role %s\n", r.UserID, r.Email, r.Role)
+	if r.Created {
+		s = "created " + s
+	}
+	if r.Password != "" {
+		s += fmt.Sprintf("generated password: %s\n", r.Password)
+	}
+	return s
+}
+
+// generatePassword returns a random password for users created without
+// one.
+func generatePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// passwordHash hashes password, generated when empty, and returns the
+// password to report.
+func passwordHash(password string) (hash, generated string, err error) {
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return "", "", err
+		}
+		generated = password
+	}
+	hash, err = utils.GeneratePassword(password)
+	return hash, generated, err
+}
+
+func runCreateAdmin(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("create-admin", createAdminUsage)
+	email := flags.String("email", "", "email address of the user")
+	password := flags.String("password", "", "password of a new user, generated when empty")
+	username := flags.String("username", "", "username of a new user")
+	role := flags.String("role", models.RoleAdmin, "role granted, admin or partner")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *email == "" {
+		return nil, errors.New("-email is required")
+	}
+	if *role != models.RoleAdmin && *role != models.RolePartner {
+		return nil, fmt.Errorf("-role must be %s or %s", models.RoleAdmin, models.RolePartner)
+	}
+
+	report := &userReport{Email: *email, Role: *role}
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		users := repository.NewPostgres(tx).Users
+		user, err := users.GetByEmail(ctx, *email)
+		switch {
+		case err == nil:
+			// an existing user keeps their password
+			report.UserID = user.ID
+			return users.SetRole(ctx, user.ID, *role)
+		case !errors.Is(err, repository.ErrNotFound):
+			return err
+		}
+
+		hash, generated, err := passwordHash(*password)
+		if err != nil {
+			return err
+		}
+		user = &models.User{
+			Email:        *email,
+			Username:     *username,
+			PasswordHash: hash,
+			UserStatus:   1,
+			UserRole:     *role,
+			CreatedAt:    time.Now(),
+		}
+		if err := users.Create(ctx, user); err != nil {
+			var invalid validator.ValidationErrors
+			if errors.As(err, &invalid) {
+				return fmt.Errorf("invalid user: %v", utils.ValidateErrors(invalid))
+			}
+			return err
+		}
+
+		report.UserID = user.ID
+		report.Created = true
+		report.Password = generated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func runResetPassword(ctx context.Context, opts *options, args []string) (fmt.Stringer, error) {
+	flags := newFlagSet("reset-password", resetPasswordUsage)
+	email := flags.String("email", "", "email address of the user")
+	password := flags.String("password", "", "new password, generated when empty")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *email == "" {
+		return nil, errors.New("-email is required")
+	}
+
+	report := &userReport{Email: *email}
+	err := opts.transaction(ctx, func(tx *gorm.DB) error {
+		users := repository.NewPostgres(tx).Users
+		user, err := users.GetByEmail(ctx, *email)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("no user with email %s", *email)
+			}
+			return err
+		}
+
+		hash, generated, err := passwordHash(*password)
+		if err != nil {
+			return err
+		}
+		if err := users.SetPassword(ctx, user.ID, hash); err != nil {
+			return err
+		}
+
+		report.UserID = user.ID
+		report.Role = user.UserRole
+		report.Password = generated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
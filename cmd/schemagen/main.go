@@ -0,0 +1,36 @@
+// Command schemagen writes the JSON Schema of every RPC message contract so
+// the ML workers can validate the payloads they exchange with the API.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
+)
+
+func main() {
+	out := flag.String("out", "schemas", "directory to write the schemas to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+
+	for _, c := range contracts.All() {
+		data, err := json.MarshalIndent(c.JSONSchema(), "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode the %s schema: %v", c.Method, err)
+		}
+
+		path := filepath.Join(*out, fmt.Sprintf("%s.v%d.json", c.Method, c.Latest()))
+		if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		fmt.Println(path)
+	}
+}
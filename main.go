@@ -1,47 +1,87 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/joho/godotenv"
-	"github.com/r3tr056/ecolens_api/app/controllers"
+	"github.com/r3tr056/ecolens_api/app/container"
+	"github.com/r3tr056/ecolens_api/pkg/config"
 	"github.com/r3tr056/ecolens_api/pkg/middleware"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
 	"github.com/r3tr056/ecolens_api/pkg/routes"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+	"github.com/r3tr056/ecolens_api/pkg/utils/email"
 	"github.com/r3tr056/ecolens_api/platform/db"
 )
 
 func main() {
-	err := godotenv.Load()
+	// ecolens migrate up|down|status manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Refuse to start with a missing or invalid setting, listing them all
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Fatal(err)
 	}
+	log.Printf("Configuration:\n%s", cfg)
 
-	// open the connection to postgres database
-	db.OpenPostgresConnection()
-	db.CustomMigrate()
+	utils.TokenConfig = utils.TokenOptions{
+		SecretKey:  cfg.JWT.SecretKey,
+		AccessTTL:  cfg.JWT.AccessTTL,
+		RefreshKey: cfg.JWT.RefreshKey,
+		RefreshTTL: cfg.JWT.RefreshTTL,
+	}
+	if cfg.SMTP.Server != "" {
+		email.AuthSMTP(cfg.SMTP.Server, cfg.SMTP.Username, cfg.SMTP.Password)
+	}
 
-	app := fiber.New()
+	// Connect the databases and the broker and build the services
+	c, err := container.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	// Apply the pending migrations, replicas starting together take turns
+	applied, err := db.Migrate(context.Background(), c.DB)
+	if err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+	for _, migration := range applied {
+		log.Printf("Applied migration %s", migration)
+	}
+
+	// Start the RPC client and the background services
+	c.Start()
+
+	// Errors are rendered as problem documents, with their internal cause
+	// in development only
+	app := fiber.New(fiber.Config{
+		ErrorHandler: problem.Handler(cfg.Server.Stage == config.StageDev),
+	})
 
 	// Register middlewares
 	middleware.FiberMiddleware(app)
 
-	// Start RPC clients
-	controllers.StartSearchTaskRPC()
-
 	// TODO : Routes
-	routes.SetupRoutes(app)
+	routes.SetupRoutes(app, c.Handlers, c.Users)
 	routes.SwaggerRoute(app)
 	routes.NotFoundRoute(app)
 
 	// start server
-	if os.Getenv("STAGE_STATUS") == "dev" {
+	if cfg.Server.Stage == config.StageDev {
 		// Server run without gracefull shutdown
-		fiberUrl := fmt.Sprintf("%s:%s", os.Getenv("SERVER_HOST"), os.Getenv("SERVER_PORT"))
-		if err := app.Listen(fiberUrl); err != nil {
+		if err := app.Listen(cfg.Server.Addr()); err != nil {
 			log.Printf("Oops... Server is not running! Reason : %v", err)
 		}
 	} else {
@@ -50,10 +90,16 @@ func main() {
 		idleConnsClosed := make(chan struct{})
 		go func() {
 			sigint := make(chan os.Signal, 1)
-			signal.Notify(sigint, os.Interrupt)
+			signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 			<-sigint
 
-			// Received interrupt. Shutdown
+			// Received interrupt. Fail the readiness probe and keep
+			// serving until the load balancers stop sending traffic
+			c.Health.Drain()
+			log.Printf("Draining for %s before shutting down", cfg.Server.DrainDelay)
+			time.Sleep(cfg.Server.DrainDelay)
+
+			// Shutdown
 			if err := app.Shutdown(); err != nil {
 				log.Printf("Oops.... Server is not shutting down! Reason : %v", err)
 			}
@@ -62,8 +108,7 @@ func main() {
 		}()
 
 		// Run Server
-		fiberUrl := fmt.Sprintf("%s:%s", os.Getenv("SERVER_HOST"), os.Getenv("SERVER_PORT"))
-		if err := app.Listen(fiberUrl); err != nil {
+		if err := app.Listen(cfg.Server.Addr()); err != nil {
 			log.Printf("Oops... Server is not running! Reason : %v", err)
 		}
 
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/config"
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/platform/db"
+)
+
+const migrateUsage = "usage: ecolens migrate up | down [steps] | status"
+
+// runMigrate runs the migrate command: up applies the pending migrations,
+// down rolls back the last steps, one by default, and status lists them.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	// only the database settings are needed, and the default language the
+	// search vectors are stemmed in
+	cfg, err := config.Load("postgres", "search")
+	if err != nil {
+		return err
+	}
+	languages, err := locale.New(cfg.Search.DefaultLanguage, cfg.Search.Languages)
+	if err != nil {
+		return err
+	}
+	models.DefaultLanguage = languages.Default
+
+	database, err := db.OpenPostgresConnection(cfg.Postgres.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, migration := range done {
+			fmt.Printf("applied %s\n", migration)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		done, err := migrator.Down(ctx, steps)
+		for _, migration := range done {
+			fmt.Printf("rolled back %s\n", migration)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, status.State, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf(migrateUsage)
+}
@@ -0,0 +1,142 @@
+// Package config loads the configuration of the API and its tools into a
+// typed struct, from the defaults, an optional YAML file, the .env file and
+// the environment, each overriding the one before.
+//
+// Every setting names its environment variable with an env tag, its YAML
+// key with a yaml tag, and may have a default, validation rules, and be
+// marked secret so it is redacted when the configuration is logged.
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stages the API runs in
+const (
+	StageDev     = "dev"
+	StageStaging = "staging"
+	StageProd    = "prod"
+)
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Postgres Postgres `yaml:"postgres"`
+	Redis    Redis    `yaml:"redis"`
+	JWT      JWT      `yaml:"jwt"`
+	Broker   Broker   `yaml:"broker"`
+	Events   Events   `yaml:"events"`
+	Search   Search   `yaml:"search"`
+	Semantic Semantic `yaml:"semantic"`
+	SMTP     SMTP     `yaml:"smtp"`
+	Storage  Storage  `yaml:"storage"`
+}
+
+type Server struct {
+	// Stage dev runs without graceful shutdown and accepts plain HTTP
+	// webhook endpoints
+	Stage string `env:"STAGE_STATUS" yaml:"stage" default:"prod" validate:"oneof=dev staging prod"`
+	Host  string `env:"SERVER_HOST" yaml:"host"`
+	Port  int    `env:"SERVER_PORT" yaml:"port" default:"8000" validate:"min=1,max=65535"`
+	// DrainDelay is how long the server keeps serving once it is unready,
+	// for the load balancers to notice before it shuts down
+	DrainDelay time.Duration `env:"SERVER_DRAIN_DELAY" yaml:"drain_delay" unit:"s" default:"5s" validate:"min=0"`
+}
+
+// Addr is the address the server listens on.
+func (s Server) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+type Postgres struct {
+	Host     string `env:"POSTGRES_HOST" yaml:"host" validate:"required"`
+	Port     int    `env:"POSTGRES_PORT" yaml:"port" default:"5432" validate:"min=1,max=65535"`
+	User     string `env:"POSTGRES_USERNAME" yaml:"user" validate:"required"`
+	Password string `env:"POSTGRES_PASS" yaml:"password" secret:"true"`
+	Database string `env:"POSTGRES_DB" yaml:"database" validate:"required"`
+	SSLMode  string `env:"POSTGRES_SSLMODE" yaml:"sslmode" default:"prefer" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+}
+
+// DSN is the connection string of the database.
+func (p Postgres) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		quoteDSN(p.Host), quoteDSN(p.User), quoteDSN(p.Password), quoteDSN(p.Database), p.Port, p.SSLMode)
+}
+
+// quoteDSN quotes a value of a key=value connection string, so empty values
+// and values with spaces do not swallow the next key.
+func quoteDSN(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+type Redis struct {
+	// SearchCacheAddr is the Redis of the search cache and autocomplete
+	SearchCacheAddr string `env:"REDIS_SEARCH_CACHE" yaml:"search_cache_addr" default:"localhost:6379" validate:"hostname_port"`
+	SearchCacheDB   int    `env:"REDIS_SEARCH_CACHE_DB" yaml:"search_cache_db" default:"2" validate:"min=0"`
+}
+
+type JWT struct {
+	SecretKey string `env:"JWT_SECRET_KEY" yaml:"secret_key" secret:"true" validate:"required,min=16"`
+	// AccessTTL is how long access tokens are valid, in minutes in the
+	// environment
+	AccessTTL  time.Duration `env:"JWT_SECRET_KEY_EXPIRE_MIN_COUNT" yaml:"access_ttl" unit:"m" default:"15m" validate:"gt=0"`
+	RefreshKey string        `env:"JWT_REFRESH_KEY" yaml:"refresh_key" secret:"true" validate:"required,min=16"`
+	// RefreshTTL is how long refresh tokens are valid, in hours in the
+	// environment
+	RefreshTTL time.Duration `env:"JWT_REFRESH_KEY_EXPIRE_HOURS_COUNT" yaml:"refresh_ttl" unit:"h" default:"720h" validate:"gt=0"`
+}
+
+type Broker struct {
+	// Backend is one of pubsub.Backends, checked when loading
+	Backend       string        `env:"MESSAGE_BROKER" yaml:"backend" default:"google"`
+	GoogleProject string        `env:"GOOGLE_PROJECT_ID" yaml:"google_project" validate:"required_if=Backend google"`
+	RedisAddr     string        `env:"REDIS_BROKER_ADDR" yaml:"redis_addr" validate:"required_if=Backend redis"`
+	RedisDB       int           `env:"REDIS_BROKER_DB" yaml:"redis_db" validate:"min=0"`
+	RedisIdle     time.Duration `env:"REDIS_BROKER_GROUP_IDLE" yaml:"redis_idle" unit:"s" default:"1m" validate:"min=0"`
+	// SearchTopic and SearchSubscription carry the RPCs to the ML workers
+	SearchTopic        string `env:"SEARCH_TOPIC_NAME" yaml:"search_topic" validate:"required"`
+	SearchSubscription string `env:"SEARCH_SUB_NAME" yaml:"search_subscription" validate:"required"`
+}
+
+type Events struct {
+	// Topic the domain events of the outbox are published to
+	Topic               string `env:"PRODUCT_EVENTS_TOPIC" yaml:"topic" default:"product-events" validate:"required"`
+	WebhookSubscription string `env:"WEBHOOK_SUB_NAME" yaml:"webhook_subscription" default:"webhook-dispatcher" validate:"required"`
+	SuggestSubscription string `env:"SUGGEST_SUB_NAME" yaml:"suggest_subscription" default:"search-suggest" validate:"required"`
+	// Retention of the published events in the outbox
+	Retention time.Duration `env:"OUTBOX_RETENTION" yaml:"retention" unit:"h" default:"168h" validate:"gt=0"`
+}
+
+type Search struct {
+	DefaultLanguage string `env:"SEARCH_DEFAULT_LANGUAGE" yaml:"default_language" default:"en" validate:"required"`
+	// Languages are those searches run in, all supported ones when empty
+	Languages     []string      `env:"SEARCH_LANGUAGES" yaml:"languages"`
+	CacheTTL      time.Duration `env:"SEARCH_CACHE_TTL" yaml:"cache_ttl" unit:"s" default:"2m" validate:"min=0"`
+	CacheStaleTTL time.Duration `env:"SEARCH_CACHE_STALE_TTL" yaml:"cache_stale_ttl" unit:"s" default:"8m" validate:"min=0"`
+	// AnalyticsKey hashes user IDs in the search logs, a random key is used
+	// when empty and users are not recognized across restarts
+	AnalyticsKey string `env:"SEARCH_ANALYTICS_KEY" yaml:"analytics_key" secret:"true"`
+}
+
+type Semantic struct {
+	// EmbeddingsURL selects the remote embedder, semantic search is
+	// disabled when empty
+	EmbeddingsURL        string  `env:"EMBEDDINGS_URL" yaml:"embeddings_url" validate:"omitempty,url"`
+	EmbeddingsAPIKey     string  `env:"EMBEDDINGS_API_KEY" yaml:"embeddings_api_key" secret:"true"`
+	EmbeddingsModel      string  `env:"EMBEDDINGS_MODEL" yaml:"embeddings_model"`
+	EmbeddingsDimensions int     `env:"EMBEDDINGS_DIMENSIONS" yaml:"embeddings_dimensions" validate:"required_with=EmbeddingsURL,min=0"`
+	MinSimilarity        float64 `env:"SEMANTIC_MIN_SIMILARITY" yaml:"min_similarity" default:"0.3" validate:"min=0,max=1"`
+}
+
+type SMTP struct {
+	Server   string `env:"GMAIL_SMTP_SERVER" yaml:"server"`
+	Username string `env:"GMAIL_SMTP_USERNAME" yaml:"username"`
+	Password string `env:"GMAIL_SMTP_PASSWORD" yaml:"password" secret:"true"`
+}
+
+type Storage struct {
+	APIKey       string `env:"GCS_API_KEY" yaml:"api_key" secret:"true"`
+	AvatarBucket string `env:"AVATAR_BUCKET" yaml:"avatar_bucket"`
+	ImageBucket  string `env:"GCS_IMAGE_BUCKET" yaml:"image_bucket"`
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/locale"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+)
+
+// FileEnv names the environment variable of the optional YAML file
+const FileEnv = "ECOLENS_CONFIG"
+
+// Error lists every missing or invalid setting.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *Error) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Load loads the configuration, reading the YAML file named by
+// ECOLENS_CONFIG when set. Only the sections given by their YAML key are
+// validated, all of them when none is given, so tools can run without the
+// settings of the server.
+func Load(sections ...string) (*Config, error) {
+	// the environment may come from the shell alone
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+	return LoadFile(os.Getenv(FileEnv), sections...)
+}
+
+// LoadFile loads the configuration from the defaults, the YAML file when
+// path is not empty, and the environment.
+func LoadFile(path string, sections ...string) (*Config, error) {
+	cfg := &Config{}
+	problems := &Error{}
+
+	eachSetting(cfg, func(field reflect.StructField, value reflect.Value) {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if err := parse(value, def, field.Tag.Get("unit")); err != nil {
+				panic(fmt.Sprintf("config: bad default of %s: %v", field.Tag.Get("env"), err))
+			}
+		}
+	})
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+		}
+		// unknown keys are reported, they are likely misspelt
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			problems.add("%s: %v", path, err)
+		}
+	}
+
+	eachSetting(cfg, func(field reflect.StructField, value reflect.Value) {
+		key := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(key)
+		if !ok || (raw == "" && value.Kind() != reflect.String) {
+			return
+		}
+		if err := parse(value, raw, field.Tag.Get("unit")); err != nil {
+			problems.add("%s: %v", key, err)
+		}
+	})
+
+	validateSections(cfg, sections, problems)
+
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+	return cfg, nil
+}
+
+// eachSetting calls fn with every setting of cfg.
+func eachSetting(cfg *Config, fn func(field reflect.StructField, value reflect.Value)) {
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			fn(section.Type().Field(j), section.Field(j))
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parse sets value from its text. Durations are Go durations, e.g. 90s, or
+// plain numbers in the unit of the setting, seconds by default, as the
+// environment variables always took them.
+func parse(value reflect.Value, raw, unit string) error {
+	raw = strings.TrimSpace(raw)
+
+	if value.Type() == durationType {
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			if unit == "" {
+				unit = "s"
+			}
+			d, err := time.ParseDuration("1" + unit)
+			if err != nil {
+				return err
+			}
+			value.SetInt(n * int64(d))
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// validateSections checks the settings of the sections against their
+// validate tags and adds a problem for each invalid one.
+func validateSections(cfg *Config, sections []string, problems *Error) {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("env")
+	})
+
+	selected := map[string]bool{}
+	for _, section := range sections {
+		selected[section] = true
+	}
+
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		name := root.Type().Field(i).Tag.Get("yaml")
+		if len(selected) > 0 && !selected[name] {
+			continue
+		}
+
+		err := validate.Struct(root.Field(i).Addr().Interface())
+		var fieldErrors validator.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			continue
+		}
+		for _, fieldError := range fieldErrors {
+			problems.add("%s %s", fieldError.Field(), describe(fieldError))
+		}
+	}
+
+	if len(selected) == 0 || selected["broker"] {
+		if !supportedBackend(cfg.Broker.Backend) {
+			problems.add("MESSAGE_BROKER must be one of %s", strings.Join(pubsub.Backends, " "))
+		}
+	}
+
+	if len(selected) == 0 || selected["search"] {
+		if _, err := locale.New(cfg.Search.DefaultLanguage, cfg.Search.Languages); err != nil {
+			problems.add("SEARCH_DEFAULT_LANGUAGE, SEARCH_LANGUAGES: %v", err)
+		}
+	}
+}
+
+func supportedBackend(backend string) bool {
+	for _, supported := range pubsub.Backends {
+		if backend == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// describe words a failed validation rule.
+func describe(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required", "required_if", "required_with":
+		return "is required"
+	case "oneof":
+		return "must be one of " + fieldError.Param()
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return "must be at least " + fieldError.Param() + " characters long"
+		}
+		return "must be at least " + fieldError.Param()
+	case "max":
+		return "must be at most " + fieldError.Param()
+	case "gt":
+		return "must be positive"
+	case "url":
+		return "must be a URL"
+	case "hostname_port":
+		return "must be a host:port address"
+	}
+	return "fails the " + fieldError.Tag() + " rule"
+}
+
+// String lists the settings as environment variables, with the secrets
+// redacted, for the startup log.
+func (c *Config) String() string {
+	lines := []string{}
+	eachSetting(c, func(field reflect.StructField, value reflect.Value) {
+		text := fmt.Sprint(value.Interface())
+		if value.Kind() == reflect.Slice {
+			text = strings.Join(value.Interface().([]string), ",")
+		}
+		if field.Tag.Get("secret") == "true" && text != "" {
+			text = "[redacted]"
+		}
+		lines = append(lines, field.Tag.Get("env")+"="+text)
+	})
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+)
+
+// setBrokerEnv sets the settings of the broker without defaults.
+func setBrokerEnv(t *testing.T) {
+	t.Setenv("GOOGLE_PROJECT_ID", "ecolens-test")
+	t.Setenv("SEARCH_TOPIC_NAME", "search")
+	t.Setenv("SEARCH_SUB_NAME", "search-api")
+}
+
+// TestDefaultBroker checks the broker of the default configuration can be
+// built.
+func TestDefaultBroker(t *testing.T) {
+	setBrokerEnv(t)
+	// restored after the test
+	t.Setenv("MESSAGE_BROKER", "")
+	os.Unsetenv("MESSAGE_BROKER")
+	// the client does not connect before its first call
+	t.Setenv("PUBSUB_EMULATOR_HOST", "localhost:8681")
+
+	cfg, err := LoadFile("", "broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Broker.Backend != pubsub.BackendGoogle {
+		t.Errorf("backend = %q, want %q", cfg.Broker.Backend, pubsub.BackendGoogle)
+	}
+
+	broker, err := pubsub.NewBroker(context.Background(), pubsub.BrokerConfig{
+		Backend:        cfg.Broker.Backend,
+		GoogleProject:  cfg.Broker.GoogleProject,
+		RedisAddr:      cfg.Broker.RedisAddr,
+		RedisDB:        cfg.Broker.RedisDB,
+		RedisGroupIdle: cfg.Broker.RedisIdle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.Close()
+}
+
+func TestBrokerBackend(t *testing.T) {
+	setBrokerEnv(t)
+
+	for _, backend := range pubsub.Backends {
+		t.Setenv("MESSAGE_BROKER", backend)
+		t.Setenv("REDIS_BROKER_ADDR", "localhost:6379")
+		if _, err := LoadFile("", "broker"); err != nil {
+			t.Errorf("MESSAGE_BROKER=%s: %v", backend, err)
+		}
+	}
+
+	t.Setenv("MESSAGE_BROKER", "gcp")
+	_, err := LoadFile("", "broker")
+	var problems *Error
+	if !errors.As(err, &problems) || len(problems.Problems) != 1 || !strings.HasPrefix(problems.Problems[0], "MESSAGE_BROKER") {
+		t.Errorf("MESSAGE_BROKER=gcp: %v, want it refused", err)
+	}
+}
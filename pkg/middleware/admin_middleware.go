@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+)
+
+// UserRoles looks up the roles of users
+type UserRoles interface {
+	Role(ctx context.Context, userID uint) (string, error)
+}
+
+// AdminProtected only lets users with the admin role through. It must be
+// registered after JWTProtected.
+func AdminProtected(users UserRoles) func(*fiber.Ctx) error {
+	return RoleProtected(users, models.RoleAdmin)
+}
+
+// RoleProtected only lets users with one of roles through. It must be
+// registered after JWTProtected.
+func RoleProtected(users UserRoles, roles ...string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		userID, err := CurrentUserID(c)
+		if err != nil {
+			return problem.Unauthorized(err.Error())
+		}
+
+		if userRole, err := users.Role(c.Context(), userID); err == nil {
+			for _, role := range roles {
+				if userRole == role {
+					return c.Next()
+				}
+			}
+		}
+
+		return problem.Forbidden("insufficient role for this endpoint")
+	}
+}
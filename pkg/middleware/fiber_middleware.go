@@ -4,17 +4,28 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/session/v2"
+
+	"github.com/r3tr056/ecolens_api/platform/metrics"
 )
 
 var SessionStore *session.Session
 
 func FiberMiddleware(a *fiber.App) {
 	a.Use(
+		// Tag each request with an ID, sent back in X-Request-ID and in
+		// the problem documents
+		requestid.New(),
 		// Add CORS to each routes
 		cors.New(),
 		// simple logger
-		logger.New(),
+		logger.New(logger.Config{
+			Format: "[${time}] ${locals:requestid} ${status} - ${latency} ${method} ${path}\n",
+		}),
+		// Measure requests by route template and status, after the logger
+		// as it renders the errors it measures
+		metrics.HTTP(),
 	)
 
 	SessionStore = session.New(session.Config{
@@ -1,15 +1,18 @@
 package middleware
 
 import (
-	"os"
+	"errors"
 
 	jwtMiddleware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
 )
 
 func JWTProtected() func(*fiber.Ctx) error {
 	config := jwtMiddleware.Config{
-		SigningKey:   jwtMiddleware.SigningKey{Key: []byte(os.Getenv("JWT_SECRET_KEY"))},
+		SigningKey:   jwtMiddleware.SigningKey{Key: []byte(utils.TokenConfig.SecretKey)},
 		ContextKey:   "jwt",
 		ErrorHandler: jwtError,
 	}
@@ -18,15 +21,29 @@ func JWTProtected() func(*fiber.Ctx) error {
 }
 
 func jwtError(c *fiber.Ctx, err error) error {
-	if err.Error() == "Missing or malformed JWT" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": true,
-			"msg":   err.Error(),
-		})
+	if errors.Is(err, jwtMiddleware.ErrJWTMissingOrMalformed) {
+		return problem.BadRequest(err.Error()).WithCode(problem.CodeInvalidToken)
 	}
 
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"error": true,
-		"msg":   err.Error(),
-	})
+	return problem.Unauthorized("Invalid or expired JWT").WithCode(problem.CodeInvalidToken)
+}
+
+// CurrentUserID returns the ID of the user the request's JWT was issued to.
+func CurrentUserID(c *fiber.Ctx) (uint, error) {
+	token, ok := c.Locals("jwt").(*jwt.Token)
+	if !ok {
+		return 0, errors.New("missing JWT")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("malformed JWT claims")
+	}
+
+	id, ok := claims["id"].(float64)
+	if !ok || id <= 0 {
+		return 0, errors.New("JWT has no user id")
+	}
+
+	return uint(id), nil
 }
@@ -0,0 +1,91 @@
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// RequestIDKey is the key of the request ID in the locals of a request, set
+// by the requestid middleware
+const RequestIDKey = "requestid"
+
+// Document is the RFC 7807 body of a problem. Code, RequestID, Errors and
+// Debug are extension members.
+type Document struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	// Debug is the internal cause of the problem, only shown in development
+	Debug string `json:"debug,omitempty"`
+	// Extensions are more members, specific to the problem
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the extension members to those of the document.
+func (d Document) MarshalJSON() ([]byte, error) {
+	type document Document
+	data, err := json.Marshal(document(d))
+	if err != nil || len(d.Extensions) == 0 {
+		return data, err
+	}
+
+	extensions, err := json.Marshal(d.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(data[:len(data)-1], ','), extensions[1:]...), nil
+}
+
+// TypeURI returns the type of the problems with code.
+func TypeURI(code string) string {
+	return "urn:ecolens:problem:" + code
+}
+
+// RequestID returns the ID of the request of c.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(RequestIDKey).(string)
+	return id
+}
+
+// Handler returns the Fiber error handler rendering the errors returned by
+// the handlers and middlewares as problem documents. Server errors are
+// logged with their cause and request ID. Only in development, dev, the
+// cause is also sent to the client.
+func Handler(dev bool) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		problem := From(err)
+		requestID := RequestID(c)
+
+		if problem.Status >= fiber.StatusInternalServerError {
+			log.Printf("Request %s %s %s failed: %v", requestID, c.Method(), c.Path(), err)
+		}
+
+		document := Document{
+			Type:       TypeURI(problem.Code),
+			Title:      http.StatusText(problem.Status),
+			Status:     problem.Status,
+			Detail:     problem.Detail,
+			Instance:   c.Path(),
+			Code:       problem.Code,
+			RequestID:  requestID,
+			Errors:     problem.Fields,
+			Extensions: problem.Extensions,
+		}
+		if dev && problem.Err != nil {
+			document.Debug = problem.Err.Error()
+		}
+
+		return c.Status(problem.Status).JSON(document, ContentType)
+	}
+}
@@ -0,0 +1,196 @@
+// Package problem is the error model of the API. Handlers return a *Error,
+// or any error, and the Fiber error handler of the package renders it as an
+// RFC 7807 problem details document, application/problem+json, with a
+// stable code clients can switch on.
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+)
+
+// Codes of the problems. They are part of the API: a code is never renamed
+// or reused for another problem.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeInvalidQuery       = "invalid_query"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeInvalidResetToken  = "invalid_reset_token"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeRouteNotFound      = "route_not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeEmailTaken         = "email_taken"
+	CodeGone               = "gone"
+	CodeSearchExpired      = "search_expired"
+	CodeBodyTooLarge       = "body_too_large"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeInternal           = "internal_error"
+	CodeUnavailable        = "service_unavailable"
+	CodeTimeout            = "timeout"
+)
+
+// statusCodes are the codes of the problems built from a bare status, like
+// the errors of Fiber
+var statusCodes = map[int]string{
+	fiber.StatusBadRequest:            CodeBadRequest,
+	fiber.StatusUnauthorized:          CodeUnauthorized,
+	fiber.StatusForbidden:             CodeForbidden,
+	fiber.StatusNotFound:              CodeNotFound,
+	fiber.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	fiber.StatusConflict:              CodeConflict,
+	fiber.StatusGone:                  CodeGone,
+	fiber.StatusRequestEntityTooLarge: CodeBodyTooLarge,
+	fiber.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	fiber.StatusUnprocessableEntity:   CodeValidationFailed,
+	fiber.StatusTooManyRequests:       CodeTooManyRequests,
+	fiber.StatusInternalServerError:   CodeInternal,
+	fiber.StatusServiceUnavailable:    CodeUnavailable,
+	fiber.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// Error is an error of the API. Detail is shown to clients, Err is the
+// internal cause, only shown in development.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Fields are the invalid fields of a request and what is wrong with them
+	Fields map[string]string
+	// Extensions are more members of the problem document
+	Extensions map[string]interface{}
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns a copy of e with a more specific code.
+func (e *Error) WithCode(code string) *Error {
+	copied := *e
+	copied.Code = code
+	return &copied
+}
+
+// With returns a copy of e with the extension member key.
+func (e *Error) With(key string, value interface{}) *Error {
+	copied := *e
+	copied.Extensions = make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return &copied
+}
+
+// New returns a problem with status and the generic code of the status.
+func New(status int, detail string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+		if status < fiber.StatusInternalServerError {
+			code = CodeBadRequest
+		}
+	}
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(detail string) *Error {
+	return New(fiber.StatusBadRequest, detail)
+}
+
+// Validation returns the problem of a request whose fields failed the
+// validate tags of its model, err is what the validator returned.
+func Validation(err error) *Error {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return &Error{Status: fiber.StatusBadRequest, Code: CodeValidationFailed, Detail: "The request is invalid", Err: err}
+	}
+	return &Error{
+		Status: fiber.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: "The request has invalid fields",
+		Fields: utils.ValidateErrors(invalid),
+	}
+}
+
+// InvalidBody returns the problem of a request body that could not be
+// parsed.
+func InvalidBody(err error) *Error {
+	return &Error{Status: fiber.StatusBadRequest, Code: CodeBadRequest, Detail: "The request body is malformed", Err: err}
+}
+
+func Unauthorized(detail string) *Error {
+	return New(fiber.StatusUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(fiber.StatusForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(fiber.StatusNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(fiber.StatusConflict, detail)
+}
+
+func Gone(detail string) *Error {
+	return New(fiber.StatusGone, detail)
+}
+
+// Internal returns the problem of a failure of the API, err is its cause.
+func Internal(detail string, err error) *Error {
+	return &Error{Status: fiber.StatusInternalServerError, Code: CodeInternal, Detail: detail, Err: err}
+}
+
+// Unavailable returns the problem of a dependency that is down, err is
+// what it failed with.
+func Unavailable(detail string, err error) *Error {
+	return &Error{Status: fiber.StatusServiceUnavailable, Code: CodeUnavailable, Detail: detail, Err: err}
+}
+
+// From returns the problem of err: the *Error it wraps, else the one of a
+// Fiber error, of invalid fields or of a timeout. Other errors are
+// internal, the errors of the app layer are mapped by the handlers.
+func From(err error) *Error {
+	var problem *Error
+	if errors.As(err, &problem) {
+		return problem
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return New(fiberErr.Code, fiberErr.Message)
+	}
+
+	var invalid validator.ValidationErrors
+	switch {
+	case errors.As(err, &invalid):
+		return Validation(invalid)
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: fiber.StatusGatewayTimeout, Code: CodeTimeout, Detail: "The request timed out", Err: err}
+	}
+	return Internal(http.StatusText(fiber.StatusInternalServerError), err)
+}
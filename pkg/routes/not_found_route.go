@@ -1,14 +1,15 @@
 package routes
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+)
 
 func NotFoundRoute(a *fiber.App) {
 	a.Use(
 		func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": true,
-				"msg":   "sorry, endpoint is not found",
-			})
+			return problem.NotFound("sorry, endpoint is not found").WithCode(problem.CodeRouteNotFound)
 		},
 	)
 }
@@ -2,13 +2,17 @@ package routes
 
 import (
 	"github.com/r3tr056/ecolens_api/app/controllers"
+	"github.com/r3tr056/ecolens_api/app/models"
 	"github.com/r3tr056/ecolens_api/pkg/middleware"
+	"github.com/r3tr056/ecolens_api/platform/metrics"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
-func SetupRoutes(app *fiber.App) {
+// SetupRoutes registers the routes of the API, served by h. users looks up
+// the roles of the role protected routes.
+func SetupRoutes(app *fiber.App, h *controllers.Handlers, users middleware.UserRoles) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
@@ -18,34 +22,72 @@ func SetupRoutes(app *fiber.App) {
 		MaxAge:           300,
 	}))
 
-	app.Use(middleware.HeartBeat("/ping"))
+	// probes of the orchestrator and the load balancers, /ping is kept for
+	// the probes configured before /readyz
+	app.Get("/healthz", h.Health.Live)
+	app.Get("/readyz", h.Health.Ready)
+	app.Get("/ping", h.Health.Ready)
+	app.Get("/metrics", metrics.Handler())
 
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 
-	v1.Post("/user/signin", controllers.UserSignIn)
-	v1.Post("/user/signup", controllers.UserSignUp)
+	v1.Post("/user/signin", h.Auth.UserSignIn)
+	v1.Post("/user/signup", h.Auth.UserSignUp)
 
 	// List all private routes
 	// user routes
-	v1.Get("/user/users", middleware.JWTProtected(), controllers.GetUsersHandler)
-	v1.Get("/user", middleware.JWTProtected(), controllers.GetUserHandler)
-	v1.Put("/user", middleware.JWTProtected(), controllers.UpdateUserHandler)
-	v1.Delete("/user", middleware.JWTProtected(), controllers.DeleteUserHandler)
+	v1.Get("/user/users", middleware.JWTProtected(), h.Users.GetUsersHandler)
+	v1.Get("/user", middleware.JWTProtected(), h.Users.GetUserHandler)
+	v1.Put("/user", middleware.JWTProtected(), h.Users.UpdateUserHandler)
+	v1.Delete("/user", middleware.JWTProtected(), h.Users.DeleteUserHandler)
 
 	// search routes
-	v1.Post("/autocomplete", middleware.JWTProtected(), controllers.MatchTS)
+	v1.Get("/search", middleware.JWTProtected(), h.Search.PerformSearch)
+	v1.Get("/autocomplete", middleware.JWTProtected(), h.Search.MatchTS)
+	v1.Post("/autocomplete", middleware.JWTProtected(), h.Search.MatchTS)
+
+	// search history of the signed-in user
+	me := v1.Group("/me", middleware.JWTProtected())
+	me.Get("/search-history", h.SearchHistory.GetSearchHistory)
+	me.Delete("/search-history", h.SearchHistory.DeleteSearchHistory)
+	me.Put("/search-history/settings", h.SearchHistory.UpdateSearchHistorySettings)
+	me.Post("/search-history/clicks", h.SearchHistory.RecordSearchClick)
 
 	// report search
-	v1.Post("/report/search", middleware.JWTProtected(), controllers.PerformReportSearch)
+	v1.Post("/report/search", middleware.JWTProtected(), h.Search.PerformReportSearch)
 
 	// product routes
-	v1.Post("/product/search", middleware.JWTProtected(), controllers.PerformProductSearch)
-	v1.Post("/product", middleware.JWTProtected(), controllers.AddProduct)
-	v1.Get("/product", middleware.JWTProtected(), controllers.GetProductByID)
-	v1.Post("/mkplcproduct", middleware.JWTProtected(), controllers.AddMarketPlaceProduct)
-	v1.Post("/mkplcproduct/search", middleware.JWTProtected(), controllers.PerformMarketplaceProductSearch)
-	v1.Put("/product", middleware.JWTProtected(), controllers.UpdateProduct)
-	v1.Get("/products", middleware.JWTProtected(), controllers.GetProducts)
+	v1.Post("/product/search", middleware.JWTProtected(), h.Search.PerformProductSearch)
+	v1.Post("/product", middleware.JWTProtected(), h.Products.AddProduct)
+	v1.Get("/product/:id", middleware.JWTProtected(), h.Products.GetProductByID)
+	v1.Post("/mkplcproduct", middleware.JWTProtected(), h.Products.AddMarketPlaceProduct)
+	v1.Post("/mkplcproduct/search", middleware.JWTProtected(), h.Search.PerformMarketplaceProductSearch)
+	v1.Put("/product/:id", middleware.JWTProtected(), h.Products.UpdateProduct)
+	v1.Get("/products", middleware.JWTProtected(), h.Products.GetProducts)
+	v1.Get("/product/:id/translations", middleware.JWTProtected(), h.Products.GetProductTranslations)
+	v1.Put("/product/:id/translations/:language", middleware.JWTProtected(), middleware.RoleProtected(users, models.RoleAdmin), h.Products.PutProductTranslation)
+	v1.Delete("/product/:id/translations/:language", middleware.JWTProtected(), middleware.RoleProtected(users, models.RoleAdmin), h.Products.DeleteProductTranslation)
+
+	// partner webhook routes
+	webhooks := v1.Group("/webhooks", middleware.JWTProtected(), middleware.RoleProtected(users, models.RolePartner, models.RoleAdmin))
+	webhooks.Post("/", h.Webhooks.CreateWebhook)
+	webhooks.Get("/", h.Webhooks.GetWebhooks)
+	webhooks.Delete("/:id", h.Webhooks.DeleteWebhook)
+	webhooks.Post("/:id/enable", h.Webhooks.EnableWebhook)
+	webhooks.Get("/:id/deliveries", h.Webhooks.GetWebhookDeliveries)
+	webhooks.Post("/:id/test", h.Webhooks.SendTestWebhook)
+
+	// admin routes
+	admin := v1.Group("/admin", middleware.JWTProtected(), middleware.AdminProtected(users))
+	admin.Get("/dead-letters", h.Admin.GetDeadLetters)
+	admin.Get("/dead-letters/:id", h.Admin.GetDeadLetter)
+	admin.Post("/dead-letters/:id/replay", h.Admin.ReplayDeadLetter)
+	admin.Get("/search-cache", h.Admin.GetSearchCacheStats)
+	admin.Get("/search-analytics/:report", h.Admin.GetSearchReport)
+	admin.Get("/synonyms", h.Admin.GetSynonyms)
+	admin.Post("/synonyms", h.Admin.CreateSynonyms)
+	admin.Put("/synonyms/:id", h.Admin.UpdateSynonyms)
+	admin.Delete("/synonyms/:id", h.Admin.DeleteSynonyms)
 
 }
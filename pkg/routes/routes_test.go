@@ -0,0 +1,393 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/r3tr056/ecolens_api/app/controllers"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/app/repository"
+	"github.com/r3tr056/ecolens_api/app/services"
+	"github.com/r3tr056/ecolens_api/pkg/problem"
+	"github.com/r3tr056/ecolens_api/pkg/routes"
+	"github.com/r3tr056/ecolens_api/pkg/utils"
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+)
+
+// fakeSearch, fakeMedia and fakeMessaging stand in for the services the
+// tested routes do not reach, calling them panics
+type fakeSearch struct{ services.Search }
+
+func (fakeSearch) Language(term, acceptLanguage string) string { return models.DefaultLanguage }
+
+func (fakeSearch) SupportsLanguage(language string) bool { return language == "fr" }
+
+func (fakeSearch) CacheStats() searchcache.Stats { return searchcache.Stats{Hits: 1} }
+
+// Resume knows no session, any cursor has expired
+func (fakeSearch) Resume(ctx context.Context, cursor, kind string) (*models.SearchSession, *models.SearchCursor, error) {
+	return nil, nil, models.ErrSearchSessionExpired
+}
+
+type fakeMedia struct{ services.Media }
+
+type fakeMessaging struct{ services.Messaging }
+
+// fakeAdmin and fakeWebhooks store nothing
+type fakeAdmin struct{ services.Admin }
+
+func (fakeAdmin) DeadLetter(ctx context.Context, id uint) (*models.DeadLetter, error) {
+	return nil, services.ErrNotFound
+}
+
+type fakeWebhooks struct{ services.Webhooks }
+
+func (fakeWebhooks) Get(ctx context.Context, userID, id uint) (*models.WebhookSubscription, error) {
+	return nil, services.ErrNotFound
+}
+
+// fakeSearchHistory records the deletes of the search history
+type fakeSearchHistory struct {
+	services.SearchHistory
+	deleted []uint
+}
+
+func (h *fakeSearchHistory) Delete(ctx context.Context, userID, id uint) error {
+	h.deleted = append(h.deleted, id)
+	return nil
+}
+
+// testDeps are the dependencies of the router the tests reach into.
+type testDeps struct {
+	repos   *repository.Repositories
+	cache   *searchcache.Cache
+	history *fakeSearchHistory
+}
+
+// newTestApp returns the router of the API on in-memory repositories and
+// search cache, returned in deps, and fakes of the other services.
+func newTestApp(t *testing.T) (*fiber.App, *testDeps) {
+	t.Helper()
+
+	utils.TokenConfig = utils.TokenOptions{
+		SecretKey:  "router-test-secret",
+		AccessTTL:  time.Minute,
+		RefreshKey: "router-test-refresh",
+		RefreshTTL: time.Hour,
+	}
+
+	server := miniredis.RunT(t)
+	deps := &testDeps{
+		repos:   repository.NewMemory(),
+		cache:   searchcache.New(redis.NewClient(&redis.Options{Addr: server.Addr()}), searchcache.Options{TTL: time.Minute}),
+		history: &fakeSearchHistory{},
+	}
+	repos := deps.repos
+	users := services.NewUsers(repos, nil)
+	products := services.NewProducts(repos.Products, deps.cache)
+	search := fakeSearch{}
+
+	handlers := &controllers.Handlers{
+		Auth:     controllers.NewAuthController(users),
+		Users:    controllers.NewUserController(users, fakeMedia{}),
+		Products: controllers.NewProductController(products, search),
+		Search:   controllers.NewSearchController(search, fakeMedia{}, fakeMessaging{}),
+		// the routes of the services below are checked, not what they store
+		SearchHistory: controllers.NewSearchHistoryController(deps.history, search),
+		Webhooks:      controllers.NewWebhookController(fakeWebhooks{}, nil, false),
+		Admin:         controllers.NewAdminController(fakeAdmin{}, search),
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler(false)})
+	routes.SetupRoutes(app, handlers, users)
+	routes.NotFoundRoute(app)
+	return app, deps
+}
+
+// do sends a JSON request to app and decodes the JSON response into out,
+// when not nil.
+func do(t *testing.T, app *fiber.App, method, path, token string, body interface{}, out interface{}) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: failed to decode the response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// expectProblem checks resp is a problem document with status and code.
+func expectProblem(t *testing.T, resp *http.Response, document *problem.Document, status int, code string) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		t.Errorf("status = %d, want %d", resp.StatusCode, status)
+	}
+	if got := resp.Header.Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, problem.ContentType)
+	}
+	if document.Code != code {
+		t.Errorf("code = %q, want %q", document.Code, code)
+	}
+}
+
+func signUpAndIn(t *testing.T, app *fiber.App, email string) string {
+	t.Helper()
+
+	signUp := models.SignUp{Email: email, Password: "correct horse"}
+	if resp := do(t, app, "POST", "/api/v1/user/signup", "", signUp, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("sign up status = %d", resp.StatusCode)
+	}
+
+	var signIn struct {
+		Tokens struct {
+			Access string `json:"access"`
+		} `json:"tokens"`
+	}
+	resp := do(t, app, "POST", "/api/v1/user/signin", "", models.SignIn{Email: email, Password: "correct horse"}, &signIn)
+	if resp.StatusCode != fiber.StatusOK || signIn.Tokens.Access == "" {
+		t.Fatalf("sign in status = %d, token %q", resp.StatusCode, signIn.Tokens.Access)
+	}
+	return signIn.Tokens.Access
+}
+
+// promote grants role to the user of email, as ecolensctl create-admin does.
+func promote(t *testing.T, repos *repository.Repositories, email, role string) {
+	t.Helper()
+
+	user, err := repos.Users.GetByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Users.SetRole(context.Background(), user.ID, role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	var document problem.Document
+	resp := do(t, app, "GET", "/api/v1/nope", "", nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusNotFound, problem.CodeRouteNotFound)
+}
+
+func TestProtectedRouteRequiresToken(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	var document problem.Document
+	resp := do(t, app, "GET", "/api/v1/products", "", nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusBadRequest, problem.CodeInvalidToken)
+
+	resp = do(t, app, "GET", "/api/v1/products", "not-a-jwt", nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusUnauthorized, problem.CodeInvalidToken)
+}
+
+func TestSignUp(t *testing.T) {
+	app, _ := newTestApp(t)
+	signUpAndIn(t, app, "ada@example.com")
+
+	var document problem.Document
+	taken := models.SignUp{Email: "ADA@example.com", Password: "another one"}
+	resp := do(t, app, "POST", "/api/v1/user/signup", "", taken, &document)
+	expectProblem(t, resp, &document, fiber.StatusConflict, problem.CodeEmailTaken)
+
+	invalid := models.SignUp{Email: "not an email", Password: "x"}
+	resp = do(t, app, "POST", "/api/v1/user/signup", "", invalid, &document)
+	expectProblem(t, resp, &document, fiber.StatusBadRequest, problem.CodeValidationFailed)
+	if _, ok := document.Errors["Email"]; !ok {
+		t.Errorf("errors = %v, want the Email field", document.Errors)
+	}
+
+	wrong := models.SignIn{Email: "ada@example.com", Password: "wrong"}
+	resp = do(t, app, "POST", "/api/v1/user/signin", "", wrong, &document)
+	expectProblem(t, resp, &document, fiber.StatusUnauthorized, problem.CodeInvalidCredentials)
+}
+
+func TestProducts(t *testing.T) {
+	app, deps := newTestApp(t)
+	token := signUpAndIn(t, app, "grace@example.com")
+
+	var created models.Product
+	resp := do(t, app, "POST", "/api/v1/product", token, models.Product{Name: "Bamboo toothbrush"}, &created)
+	if resp.StatusCode != fiber.StatusCreated || created.ID == 0 {
+		t.Fatalf("create status = %d, id %d", resp.StatusCode, created.ID)
+	}
+
+	var products []models.Product
+	resp = do(t, app, "GET", "/api/v1/products", token, nil, &products)
+	if resp.StatusCode != fiber.StatusOK || len(products) != 1 || products[0].Name != "Bamboo toothbrush" {
+		t.Fatalf("list status = %d, products %+v", resp.StatusCode, products)
+	}
+
+	// only admins translate products
+	var document problem.Document
+	translation := models.ProductTranslation{Name: "Brosse à dents en bambou"}
+	path := fmt.Sprintf("/api/v1/product/%d/translations/fr", created.ID)
+	resp = do(t, app, "PUT", path, token, translation, &document)
+	expectProblem(t, resp, &document, fiber.StatusForbidden, problem.CodeForbidden)
+	resp = do(t, app, "DELETE", path, token, nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusForbidden, problem.CodeForbidden)
+
+	promote(t, deps.repos, "grace@example.com", models.RoleAdmin)
+	resp = do(t, app, "PUT", path, token, translation, nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("translate status = %d", resp.StatusCode)
+	}
+
+	resp = do(t, app, "PUT", "/api/v1/product/999/translations/fr", token, translation, &document)
+	expectProblem(t, resp, &document, fiber.StatusNotFound, problem.CodeNotFound)
+
+	resp = do(t, app, "PUT", fmt.Sprintf("/api/v1/product/%d/translations/xx", created.ID), token, translation, &document)
+	expectProblem(t, resp, &document, fiber.StatusBadRequest, problem.CodeBadRequest)
+}
+
+func TestAdminRoutes(t *testing.T) {
+	app, deps := newTestApp(t)
+	repos := deps.repos
+	token := signUpAndIn(t, app, "user@example.com")
+
+	var document problem.Document
+	resp := do(t, app, "GET", "/api/v1/admin/search-cache", token, nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusForbidden, problem.CodeForbidden)
+
+	// the role in the body of a sign up is ignored
+	signUp := map[string]string{"email": "mallory@example.com", "password": "correct horse", "user_role": models.RoleAdmin}
+	if resp := do(t, app, "POST", "/api/v1/user/signup", "", signUp, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("sign up status = %d", resp.StatusCode)
+	}
+	if user, err := repos.Users.GetByEmail(context.Background(), "mallory@example.com"); err != nil || user.UserRole != models.RoleUser {
+		t.Fatalf("user = %+v, %v, want the user role", user, err)
+	}
+
+	adminToken := signUpAndIn(t, app, "admin@example.com")
+	promote(t, repos, "admin@example.com", models.RoleAdmin)
+	var stats searchcache.Stats
+	resp = do(t, app, "GET", "/api/v1/admin/search-cache", adminToken, nil, &stats)
+	if resp.StatusCode != fiber.StatusOK || stats.Hits != 1 {
+		t.Fatalf("status = %d, stats %+v", resp.StatusCode, stats)
+	}
+}
+
+// TestSearchCursor checks the search routes read the cursor of a page from
+// the query string, whatever the body holds.
+func TestSearchCursor(t *testing.T) {
+	app, _ := newTestApp(t)
+	token := signUpAndIn(t, app, "search@example.com")
+
+	for _, path := range []string{"/api/v1/report/search", "/api/v1/mkplcproduct/search"} {
+		var document problem.Document
+		resp := do(t, app, "POST", path+"?cursor=c2Vzc2lvbg", token, map[string]string{}, &document)
+		expectProblem(t, resp, &document, fiber.StatusGone, problem.CodeSearchExpired)
+	}
+}
+
+// TestUpdateProduct checks a product is updated by its ID and the searches
+// cached before miss.
+func TestUpdateProduct(t *testing.T) {
+	app, deps := newTestApp(t)
+	token := signUpAndIn(t, app, "linus@example.com")
+	ctx := context.Background()
+
+	var created models.Product
+	if resp := do(t, app, "POST", "/api/v1/product", token, models.Product{Name: "Cotton bag"}, &created); resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+
+	loads := 0
+	search := func() {
+		t.Helper()
+		var names []string
+		err := deps.cache.Fetch(ctx, searchcache.Products, "bag", &names, func(context.Context) (interface{}, error) {
+			loads++
+			return []string{"Cotton bag"}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	search()
+	search()
+	if loads != 1 {
+		t.Fatalf("loads = %d before the update, want the search cached", loads)
+	}
+
+	path := fmt.Sprintf("/api/v1/product/%d", created.ID)
+	var updated models.Product
+	resp := do(t, app, "PUT", path, token, models.Product{Name: "Hemp bag"}, &updated)
+	if resp.StatusCode != fiber.StatusOK || updated.Name != "Hemp bag" {
+		t.Fatalf("update status = %d, product %+v", resp.StatusCode, updated)
+	}
+	search()
+	if loads != 2 {
+		t.Errorf("loads = %d after the update, want the cached search invalidated", loads)
+	}
+
+	var product models.Product
+	resp = do(t, app, "GET", path, token, nil, &product)
+	if resp.StatusCode != fiber.StatusOK || product.Name != "Hemp bag" {
+		t.Errorf("get status = %d, product %+v", resp.StatusCode, product)
+	}
+
+	var document problem.Document
+	resp = do(t, app, "PUT", "/api/v1/product/999", token, models.Product{Name: "Hemp bag"}, &document)
+	expectProblem(t, resp, &document, fiber.StatusNotFound, problem.CodeNotFound)
+}
+
+// TestServiceRoutes checks the search history, webhook and admin routes
+// reach their services.
+func TestServiceRoutes(t *testing.T) {
+	app, deps := newTestApp(t)
+	token := signUpAndIn(t, app, "ken@example.com")
+
+	if resp := do(t, app, "DELETE", "/api/v1/me/search-history?id=3", token, nil, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("delete status = %d", resp.StatusCode)
+	}
+	if resp := do(t, app, "DELETE", "/api/v1/me/search-history", token, nil, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("clear status = %d", resp.StatusCode)
+	}
+	if len(deps.history.deleted) != 2 || deps.history.deleted[0] != 3 || deps.history.deleted[1] != 0 {
+		t.Errorf("deleted = %v, want [3 0]", deps.history.deleted)
+	}
+
+	var document problem.Document
+	resp := do(t, app, "DELETE", "/api/v1/me/search-history?id=x", token, nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusBadRequest, problem.CodeBadRequest)
+
+	promote(t, deps.repos, "ken@example.com", models.RoleAdmin)
+	resp = do(t, app, "POST", "/api/v1/webhooks/7/enable", token, nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusNotFound, problem.CodeNotFound)
+	resp = do(t, app, "GET", "/api/v1/admin/dead-letters/7", token, nil, &document)
+	expectProblem(t, resp, &document, fiber.StatusNotFound, problem.CodeNotFound)
+}
@@ -0,0 +1,181 @@
+// Package locale selects the language of a search: the text search
+// configuration its terms are stemmed with and the translations its results
+// are returned in.
+package locale
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// configs maps the supported languages to their PostgreSQL text search
+// configuration. PostgreSQL has no Hindi stemmer, Hindi is only split into
+// words.
+var configs = map[string]string{
+	"en": "english",
+	"de": "german",
+	"fr": "french",
+	"es": "spanish",
+	"hi": "simple",
+}
+
+// Codes returns the supported languages, sorted.
+func Codes() []string {
+	codes := make([]string, 0, len(configs))
+	for code := range configs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Config returns the text search configuration of a language, "simple"
+// for unsupported ones.
+func Config(code string) string {
+	if config, ok := configs[code]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// Languages are the languages searches are run in.
+type Languages struct {
+	// Default is the language of the untranslated texts, and of searches in
+	// no enabled language
+	Default string
+	enabled map[string]bool
+}
+
+// New returns the Languages enabling codes, all supported languages when
+// codes is empty. The default language is always enabled.
+func New(def string, codes []string) (*Languages, error) {
+	if _, ok := configs[def]; !ok {
+		return nil, fmt.Errorf("default language %q is not supported", def)
+	}
+	if len(codes) == 0 {
+		codes = Codes()
+	}
+
+	l := &Languages{Default: def, enabled: map[string]bool{def: true}}
+	for _, code := range codes {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if _, ok := configs[code]; !ok {
+			return nil, fmt.Errorf("language %q is not supported", code)
+		}
+		l.enabled[code] = true
+	}
+	return l, nil
+}
+
+// Supports tells whether searches run in the language.
+func (l *Languages) Supports(code string) bool {
+	return l.enabled[code]
+}
+
+// Resolve returns the language of a search for text: the detected language
+// of text, else the preferred language of the Accept-Language header, else
+// the default.
+func (l *Languages) Resolve(text, acceptLanguage string) string {
+	if code, ok := l.Detect(text); ok {
+		return code
+	}
+	return l.Negotiate(acceptLanguage)
+}
+
+// Negotiate returns the enabled language an Accept-Language header prefers,
+// the default when it accepts none. Regional variants, e.g. de-AT, select
+// their language.
+func (l *Languages) Negotiate(header string) string {
+	best, bestQuality := l.Default, 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.IndexByte(tag, '-'); i != -1 {
+			tag = tag[:i]
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+
+		// earlier tags win ties, as listed by the client
+		if l.enabled[tag] && quality > bestQuality {
+			best, bestQuality = tag, quality
+		}
+	}
+	return best
+}
+
+// stopwords are frequent words telling a language apart from the others.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "for", "with", "without", "of", "from", "free"},
+	"de": {"und", "der", "die", "das", "mit", "ohne", "für", "aus", "frei"},
+	"fr": {"le", "la", "les", "et", "avec", "sans", "pour", "des", "du"},
+	"es": {"el", "los", "las", "y", "con", "sin", "para", "del"},
+}
+
+// letters are letters only, or mostly, written in a language.
+var letters = map[string]string{
+	"de": "äöüß",
+	"fr": "çèêëàâîïôœùû",
+	"es": "ñáíóú¿¡",
+}
+
+// Detect guesses the enabled language text is written in from its script,
+// its frequent words and its accented letters. It returns false when text
+// is too short or ambiguous to tell, e.g. a single brand name.
+func (l *Languages) Detect(text string) (string, bool) {
+	text = strings.ToLower(text)
+
+	for _, r := range text {
+		if unicode.Is(unicode.Devanagari, r) {
+			return "hi", l.enabled["hi"]
+		}
+	}
+
+	scores := map[string]int{}
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for code, words := range stopwords {
+			for _, stopword := range words {
+				if word == stopword {
+					scores[code] += 2
+				}
+			}
+		}
+	}
+	for code, set := range letters {
+		for _, r := range text {
+			if strings.ContainsRune(set, r) {
+				scores[code]++
+			}
+		}
+	}
+
+	best, bestScore, tie := "", 0, false
+	for code, score := range scores {
+		if !l.enabled[code] {
+			continue
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = code, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	if bestScore == 0 || tie {
+		return "", false
+	}
+	return best, true
+}
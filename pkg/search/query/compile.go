@@ -0,0 +1,116 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Condition is a SQL condition with its bind arguments.
+type Condition struct {
+	SQL  string
+	Args []interface{}
+}
+
+// HasText reports whether the query has free text to match, as opposed to
+// only field filters.
+func (q *Query) HasText() bool {
+	return len(q.Clauses) > 0
+}
+
+// WebSearch returns the free text part of the query in the syntax of
+// websearch_to_tsquery. Every term is quoted so nothing the user typed is
+// read as an operator, and websearch_to_tsquery never fails on its input,
+// unlike to_tsquery.
+func (q *Query) WebSearch() string {
+	parts := make([]string, 0, len(q.Clauses))
+	for _, clause := range q.Clauses {
+		alternatives := make([]string, 0, len(clause.Terms))
+		for _, term := range clause.Terms {
+			text := `"` + strings.ReplaceAll(term.Text, `"`, " ") + `"`
+			if term.Negated {
+				text = "-" + text
+			}
+			alternatives = append(alternatives, text)
+		}
+		parts = append(parts, strings.Join(alternatives, " or "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Words returns the words of the terms that are not excluded, for
+// highlighting and substring fallbacks.
+func (q *Query) Words() []string {
+	var words []string
+	for _, clause := range q.Clauses {
+		for _, term := range clause.Terms {
+			if !term.Negated {
+				words = append(words, strings.Fields(term.Text)...)
+			}
+		}
+	}
+	return words
+}
+
+// Conditions compiles the field filters into SQL. fields maps each field to
+// a condition with a single placeholder that receives the lower cased
+// values, e.g. "brand_id IN (SELECT id FROM brands WHERE lower(name) IN ?)".
+func (q *Query) Conditions(fields map[string]string) ([]Condition, error) {
+	conditions := make([]Condition, 0, len(q.Filters))
+	for _, filter := range q.Filters {
+		sql, ok := fields[filter.Field]
+		if !ok {
+			return nil, &ParseError{Query: q.Raw, Position: 0, Message: fmt.Sprintf("field %q is not supported here", filter.Field)}
+		}
+
+		values := make([]string, len(filter.Values))
+		for i, value := range filter.Values {
+			values[i] = strings.ToLower(value)
+		}
+
+		if filter.Negated {
+			sql = "NOT (" + sql + ")"
+		}
+		conditions = append(conditions, Condition{SQL: sql, Args: []interface{}{values}})
+	}
+	return conditions, nil
+}
+
+// String returns the query in a canonical form, so equivalent queries share
+// cache entries.
+func (q *Query) String() string {
+	var b strings.Builder
+	for _, clause := range q.Clauses {
+		for i, term := range clause.Terms {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			writeTerm(&b, "", term.Text, term.Phrase, term.Negated)
+		}
+		b.WriteByte(' ')
+	}
+	for _, filter := range q.Filters {
+		for i, value := range filter.Values {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			writeTerm(&b, filter.Field, strings.ToLower(value), strings.ContainsRune(value, ' '), filter.Negated)
+		}
+		b.WriteByte(' ')
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func writeTerm(b *strings.Builder, field, text string, phrase, negated bool) {
+	if negated {
+		b.WriteByte('-')
+	}
+	if field != "" {
+		b.WriteString(field)
+		b.WriteByte(':')
+	}
+	if phrase {
+		b.WriteString(`"` + text + `"`)
+		return
+	}
+	b.WriteString(text)
+}
@@ -0,0 +1,69 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Span is a highlighted range of a text, in runes.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Normalize lower cases text and splits it into words of letters and
+// digits, dropping everything else.
+func Normalize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PrefixTSQuery returns a to_tsquery expression matching every word of text
+// as a prefix, e.g. "bamboo:* & toot:*", or "" when text has no words.
+// Normalize leaves nothing to_tsquery would read as an operator.
+func PrefixTSQuery(text string) string {
+	words := Normalize(text)
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// Highlight returns the spans of text where a word starts with one of
+// words, which must be normalized.
+func Highlight(text string, words []string) []Span {
+	spans := []Span{}
+	runes := []rune(strings.ToLower(text))
+
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		word := string(runes[i:end])
+		longest := 0
+		for _, w := range words {
+			if n := len([]rune(w)); n > longest && strings.HasPrefix(word, w) {
+				longest = n
+			}
+		}
+		if longest > 0 {
+			spans = append(spans, Span{Start: i, End: i + longest})
+		}
+
+		i = end
+	}
+
+	return spans
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
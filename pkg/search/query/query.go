@@ -0,0 +1,246 @@
+// Package query parses the search box syntax into a query tree and compiles
+// it into a websearch_to_tsquery expression and field filters that are safe
+// to pass to Postgres.
+//
+// Supported syntax:
+//
+//	bamboo brush          both words must match
+//	"tooth brush"         phrase
+//	-plastic              exclusion
+//	glass OR steel        either word, OR binds tighter than the implicit AND
+//	brand:acme tag:vegan  field filters, values may be quoted
+//	-brand:acme           excluded field value
+//
+// Words with a colon that does not follow a supported field, such as 10:30
+// or https://example.com, are plain text.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits that keep a single query cheap to run
+const (
+	MaxQueryLength = 256
+	MaxClauses     = 32
+)
+
+// Term is a word or a phrase of the free text part of the query.
+type Term struct {
+	Text    string
+	Phrase  bool
+	Negated bool
+}
+
+// Clause is a group of alternatives joined with OR. Clauses are ANDed.
+type Clause struct {
+	Terms []Term
+}
+
+// Filter restricts the results to rows whose field matches one of Values.
+type Filter struct {
+	Field   string
+	Values  []string
+	Negated bool
+}
+
+// Query is a parsed search query.
+type Query struct {
+	Raw     string
+	Clauses []Clause
+	Filters []Filter
+	// Language is the language of the terms, see package locale, the
+	// default language when empty. It is not part of the canonical form.
+	Language string
+}
+
+// ParseError describes why a query could not be parsed. Position is the
+// byte offset in the query where the problem was found.
+type ParseError struct {
+	Query    string
+	Position int
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d: %s", e.Position, e.Message)
+}
+
+// Options configures the parser.
+type Options struct {
+	// Fields lists the field prefixes the searched entity supports.
+	Fields []string
+}
+
+func (o Options) allows(field string) bool {
+	for _, f := range o.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOr
+)
+
+type token struct {
+	kind    tokenKind
+	text    string
+	field   string
+	negated bool
+	pos     int
+}
+
+// Parse parses raw into a Query.
+func Parse(raw string, opts Options) (*Query, error) {
+	if len(raw) > MaxQueryLength {
+		return nil, &ParseError{Query: raw, Position: MaxQueryLength, Message: fmt.Sprintf("query is longer than %d characters", MaxQueryLength)}
+	}
+	if !utf8.ValidString(raw) {
+		return nil, &ParseError{Query: raw, Position: 0, Message: "query is not valid UTF-8"}
+	}
+
+	tokens, err := tokenize(raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &ParseError{Query: raw, Position: 0, Message: "query is empty"}
+	}
+
+	q := &Query{Raw: raw}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.kind == tokenOr {
+			return nil, &ParseError{Query: raw, Position: tok.pos, Message: "OR must be placed between two terms"}
+		}
+
+		// collect the alternatives joined to this token with OR
+		group := []token{tok}
+		for i+1 < len(tokens) && tokens[i+1].kind == tokenOr {
+			if i+2 >= len(tokens) || tokens[i+2].kind == tokenOr {
+				return nil, &ParseError{Query: raw, Position: tokens[i+1].pos, Message: "OR must be placed between two terms"}
+			}
+			group = append(group, tokens[i+2])
+			i += 2
+		}
+
+		if err := q.add(raw, group); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(q.Clauses)+len(q.Filters) > MaxClauses {
+		return nil, &ParseError{Query: raw, Position: 0, Message: fmt.Sprintf("query has more than %d terms", MaxClauses)}
+	}
+
+	return q, nil
+}
+
+// add appends a group of OR'ed tokens to the query as a clause or a filter.
+func (q *Query) add(raw string, group []token) error {
+	field := group[0].field
+	for _, tok := range group {
+		if tok.field != field {
+			return &ParseError{Query: raw, Position: tok.pos, Message: "OR can only join terms of the same field"}
+		}
+		if len(group) > 1 && tok.negated {
+			return &ParseError{Query: raw, Position: tok.pos, Message: "exclusions cannot be combined with OR"}
+		}
+	}
+
+	if field != "" {
+		filter := Filter{Field: field, Negated: group[0].negated}
+		for _, tok := range group {
+			filter.Values = append(filter.Values, tok.text)
+		}
+		q.Filters = append(q.Filters, filter)
+		return nil
+	}
+
+	clause := Clause{}
+	for _, tok := range group {
+		clause.Terms = append(clause.Terms, Term{Text: tok.text, Phrase: tok.kind == tokenPhrase, Negated: tok.negated})
+	}
+	q.Clauses = append(q.Clauses, clause)
+	return nil
+}
+
+func tokenize(raw string, opts Options) ([]token, error) {
+	var tokens []token
+
+	i := 0
+	for i < len(raw) {
+		r, size := utf8.DecodeRuneInString(raw[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		tok := token{pos: i}
+		if r == '-' {
+			tok.negated = true
+			i++
+			if i >= len(raw) || isSpaceAt(raw, i) {
+				return nil, &ParseError{Query: raw, Position: tok.pos, Message: "- must be followed by the term to exclude"}
+			}
+		}
+
+		// a field prefix is a known name followed by a colon, other words
+		// with a colon, such as 10:30 or an URL, are plain text
+		if end := strings.IndexByte(raw[i:], ':'); end > 0 && !strings.ContainsAny(raw[i:i+end], " \t\n\"") && opts.allows(strings.ToLower(raw[i:i+end])) {
+			name := strings.ToLower(raw[i : i+end])
+			tok.field = name
+			i += end + 1
+			if i >= len(raw) || isSpaceAt(raw, i) {
+				return nil, &ParseError{Query: raw, Position: i, Message: fmt.Sprintf("%s: needs a value", name)}
+			}
+		}
+
+		if raw[i] == '"' {
+			end := strings.IndexByte(raw[i+1:], '"')
+			if end < 0 {
+				return nil, &ParseError{Query: raw, Position: i, Message: "unterminated quote"}
+			}
+			text := strings.Join(strings.Fields(raw[i+1:i+1+end]), " ")
+			i += end + 2
+			if text == "" {
+				return nil, &ParseError{Query: raw, Position: tok.pos, Message: "empty quotes"}
+			}
+			tok.kind = tokenPhrase
+			tok.text = text
+		} else {
+			start := i
+			for i < len(raw) {
+				r, size := utf8.DecodeRuneInString(raw[i:])
+				if unicode.IsSpace(r) || r == '"' {
+					break
+				}
+				i += size
+			}
+			tok.kind = tokenWord
+			tok.text = raw[start:i]
+			if tok.text == "OR" && !tok.negated && tok.field == "" {
+				tok.kind = tokenOr
+			}
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+func isSpaceAt(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsSpace(r)
+}
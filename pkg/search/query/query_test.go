@@ -0,0 +1,143 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var productOptions = Options{Fields: []string{"brand", "category", "tag"}}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		clauses []Clause
+		filters []Filter
+	}{
+		{
+			name:    "words",
+			raw:     "bamboo  brush",
+			clauses: []Clause{{Terms: []Term{{Text: "bamboo"}}}, {Terms: []Term{{Text: "brush"}}}},
+		},
+		{
+			name:    "phrase",
+			raw:     `"tooth   brush" bamboo`,
+			clauses: []Clause{{Terms: []Term{{Text: "tooth brush", Phrase: true}}}, {Terms: []Term{{Text: "bamboo"}}}},
+		},
+		{
+			name:    "negation",
+			raw:     `brush -plastic -"single use"`,
+			clauses: []Clause{{Terms: []Term{{Text: "brush"}}}, {Terms: []Term{{Text: "plastic", Negated: true}}}, {Terms: []Term{{Text: "single use", Phrase: true, Negated: true}}}},
+		},
+		{
+			name:    "OR group",
+			raw:     `glass OR steel OR "stainless steel" bottle`,
+			clauses: []Clause{{Terms: []Term{{Text: "glass"}, {Text: "steel"}, {Text: "stainless steel", Phrase: true}}}, {Terms: []Term{{Text: "bottle"}}}},
+		},
+		{
+			name:    "lower case or is a word",
+			raw:     "glass or steel",
+			clauses: []Clause{{Terms: []Term{{Text: "glass"}}}, {Terms: []Term{{Text: "or"}}}, {Terms: []Term{{Text: "steel"}}}},
+		},
+		{
+			name:    "filters",
+			raw:     `Brand:Acme category:"home care" -tag:vegan`,
+			filters: []Filter{{Field: "brand", Values: []string{"Acme"}}, {Field: "category", Values: []string{"home care"}}, {Field: "tag", Values: []string{"vegan"}, Negated: true}},
+		},
+		{
+			name:    "filter OR group",
+			raw:     "soap brand:acme OR brand:ecover",
+			clauses: []Clause{{Terms: []Term{{Text: "soap"}}}},
+			filters: []Filter{{Field: "brand", Values: []string{"acme", "ecover"}}},
+		},
+		{
+			name:    "time",
+			raw:     "open 10:30",
+			clauses: []Clause{{Terms: []Term{{Text: "open"}}}, {Terms: []Term{{Text: "10:30"}}}},
+		},
+		{
+			name:    "URL",
+			raw:     "https://example.com/p?id=1",
+			clauses: []Clause{{Terms: []Term{{Text: "https://example.com/p?id=1"}}}},
+		},
+		{
+			name:    "unsupported field",
+			raw:     "color:red -size:xl",
+			clauses: []Clause{{Terms: []Term{{Text: "color:red"}}}, {Terms: []Term{{Text: "size:xl", Negated: true}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.raw, productOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.Clauses, tt.clauses) {
+				t.Errorf("clauses = %+v, want %+v", q.Clauses, tt.clauses)
+			}
+			if !reflect.DeepEqual(q.Filters, tt.filters) {
+				t.Errorf("filters = %+v, want %+v", q.Filters, tt.filters)
+			}
+
+			// the canonical form parses to the same query
+			again, err := Parse(q.String(), productOptions)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", q.String(), err)
+			}
+			if again.String() != q.String() {
+				t.Errorf("canonical form %q parses to %q", q.String(), again.String())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		position int
+		message  string
+	}{
+		{"empty", "   ", 0, "query is empty"},
+		{"too long", strings.Repeat("a", MaxQueryLength+1), MaxQueryLength, "longer than"},
+		{"invalid UTF-8", "bamboo \xff", 0, "not valid UTF-8"},
+		{"too many terms", strings.Repeat("a ", MaxClauses+1), 0, "more than"},
+		{"lone dash", "brush - plastic", 6, "must be followed"},
+		{"unterminated quote", `brush "bamboo`, 6, "unterminated quote"},
+		{"empty quotes", `brush ""`, 6, "empty quotes"},
+		{"leading OR", "OR glass", 0, "OR must be placed"},
+		{"trailing OR", "glass OR", 6, "OR must be placed"},
+		{"double OR", "glass OR OR steel", 6, "OR must be placed"},
+		{"OR across fields", "glass OR brand:acme", 9, "same field"},
+		{"negated OR", "glass OR -steel", 9, "cannot be combined"},
+		{"filter without value", "brand: acme", 6, "needs a value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.raw, productOptions)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse(%q) = %v, want a ParseError", tt.raw, err)
+			}
+			if perr.Position != tt.position || !strings.Contains(perr.Message, tt.message) {
+				t.Errorf("Parse(%q) = %v at %d, want %q at %d", tt.raw, perr.Message, perr.Position, tt.message, tt.position)
+			}
+		})
+	}
+}
+
+func TestWebSearch(t *testing.T) {
+	q, err := Parse(`bamboo "tooth brush" glass OR steel -plastic 10:30 brand:acme`, productOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `"bamboo" "tooth brush" "glass" or "steel" -"plastic" "10:30"`
+	if got := q.WebSearch(); got != want {
+		t.Errorf("WebSearch() = %s, want %s", got, want)
+	}
+}
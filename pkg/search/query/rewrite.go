@@ -0,0 +1,113 @@
+package query
+
+import (
+	"strings"
+)
+
+// termKey is the form synonyms and vocabulary words are looked up by.
+func termKey(text string) string {
+	return strings.Join(Normalize(text), " ")
+}
+
+// Expand returns a copy of q whose terms also match their synonyms.
+// synonyms maps a normalized term to its equivalent terms. An excluded term
+// excludes its synonyms as well.
+func (q *Query) Expand(synonyms map[string][]string) *Query {
+	out := &Query{Raw: q.Raw, Filters: q.Filters, Language: q.Language}
+
+	for _, clause := range q.Clauses {
+		if len(clause.Terms) == 1 && clause.Terms[0].Negated {
+			term := clause.Terms[0]
+			out.Clauses = append(out.Clauses, clause)
+			for _, synonym := range synonyms[termKey(term.Text)] {
+				if termKey(synonym) != termKey(term.Text) {
+					out.Clauses = append(out.Clauses, Clause{Terms: []Term{synonymTerm(synonym, true)}})
+				}
+			}
+			continue
+		}
+
+		expanded := Clause{}
+		seen := map[string]bool{}
+		for _, term := range clause.Terms {
+			if !seen[termKey(term.Text)] {
+				seen[termKey(term.Text)] = true
+				expanded.Terms = append(expanded.Terms, term)
+			}
+			for _, synonym := range synonyms[termKey(term.Text)] {
+				if !seen[termKey(synonym)] {
+					seen[termKey(synonym)] = true
+					expanded.Terms = append(expanded.Terms, synonymTerm(synonym, false))
+				}
+			}
+		}
+		out.Clauses = append(out.Clauses, expanded)
+	}
+
+	return out
+}
+
+func synonymTerm(text string, negated bool) Term {
+	return Term{Text: text, Phrase: strings.Contains(strings.TrimSpace(text), " "), Negated: negated}
+}
+
+// SpellableWords returns the words the speller may correct: those of the
+// terms that are single plain words and not excluded, lower cased.
+func (q *Query) SpellableWords() []string {
+	var words []string
+	for _, clause := range q.Clauses {
+		if word, ok := spellable(clause); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func spellable(clause Clause) (string, bool) {
+	if len(clause.Terms) != 1 {
+		return "", false
+	}
+	term := clause.Terms[0]
+	words := Normalize(term.Text)
+	if term.Negated || term.Phrase || len(words) != 1 {
+		return "", false
+	}
+	return words[0], true
+}
+
+// Correct returns a copy of q with unknown words replaced by their entry in
+// fixes, and two adjacent words joined when the joined word is known and
+// at least one of them is not, so "tooth brush" finds "toothbrush". The
+// second result is false when nothing was corrected.
+func (q *Query) Correct(known map[string]bool, fixes map[string]string) (*Query, bool) {
+	out := &Query{Filters: q.Filters, Language: q.Language}
+	changed := false
+
+	for i := 0; i < len(q.Clauses); i++ {
+		word, ok := spellable(q.Clauses[i])
+		if !ok {
+			out.Clauses = append(out.Clauses, q.Clauses[i])
+			continue
+		}
+
+		if i+1 < len(q.Clauses) {
+			if next, ok := spellable(q.Clauses[i+1]); ok && known[word+next] && !(known[word] && known[next]) {
+				out.Clauses = append(out.Clauses, Clause{Terms: []Term{{Text: word + next}}})
+				changed = true
+				i++
+				continue
+			}
+		}
+
+		if fix, ok := fixes[word]; ok && !known[word] {
+			out.Clauses = append(out.Clauses, Clause{Terms: []Term{{Text: fix}}})
+			changed = true
+			continue
+		}
+
+		out.Clauses = append(out.Clauses, q.Clauses[i])
+	}
+
+	out.Raw = out.String()
+	return out, changed
+}
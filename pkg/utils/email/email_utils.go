@@ -2,26 +2,26 @@ package email
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
-	"os"
 
 	"net/smtp"
 )
 
 var SmtpAuth *smtp.Auth
 
-func AuthSMTP() {
-	smtpServer := os.Getenv("GMAIL_SMTP_SERVER")
-	smtpUsername := os.Getenv("GMAIL_SMTP_USERNAME")
-	smtpPassword := os.Getenv("GMAIL_SMTP_PASSWORD")
+// SMTPServer is the mail server the emails are sent through
+var SMTPServer string
 
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpServer)
+func AuthSMTP(server, username, password string) {
+	SMTPServer = server
+	auth := smtp.PlainAuth("", username, password, server)
 	SmtpAuth = &auth
 }
 
 func SendRegistrationEmail(email, name, username string) error {
-	smtpServer := os.Getenv("GMAIL_SMTP_SERVER")
+	smtpServer := SMTPServer
 	smtpPort := 587
 	senderEmail := "sender@example.com"
 
@@ -45,6 +45,33 @@ func SendRegistrationEmail(email, name, username string) error {
 	return nil
 }
 
+// SendResetEmail sends the token resetting the password of username to
+// email.
+func SendResetEmail(email, name, username, token string) error {
+	if SmtpAuth == nil {
+		return errors.New("no SMTP server configured")
+	}
+
+	htmlTemplate, err := template.ParseFiles("templates/reset_password.html")
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML template : %v", err)
+	}
+
+	var body bytes.Buffer
+
+	headers := "MIME-version: 1.0;\nContent-Type: text/html;"
+	body.Write([]byte(fmt.Sprintf("Subject: Reset your EcoLens password\n%s\n\n", headers)))
+
+	if err := htmlTemplate.Execute(&body, map[string]string{"Name": name, "Username": username, "Token": token}); err != nil {
+		return fmt.Errorf("failed to execute HTML template : %v", err)
+	}
+
+	if err := smtp.SendMail(fmt.Sprintf("%s:%d", SMTPServer, 587), *SmtpAuth, "sender@example.com", []string{email}, body.Bytes()); err != nil {
+		return fmt.Errorf("failed to send the email : %v", err)
+	}
+	return nil
+}
+
 func SendLoginAlert(email, name, username string) error {
 	return nil
 }
@@ -4,8 +4,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,6 +14,17 @@ type Tokens struct {
 	Refresh string
 }
 
+// TokenOptions sign the tokens and set how long they are valid
+type TokenOptions struct {
+	SecretKey  string
+	AccessTTL  time.Duration
+	RefreshKey string
+	RefreshTTL time.Duration
+}
+
+// TokenConfig is set from the configuration at startup
+var TokenConfig TokenOptions
+
 func GenerateNewTokens(id uint) (*Tokens, error) {
 	// Generate JWT Access Token
 	accessToken, err := generateNewAccessToken(id)
@@ -36,9 +45,7 @@ func GenerateNewTokens(id uint) (*Tokens, error) {
 }
 
 func generateNewAccessToken(id uint) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET_KEY"))
-
-	minutesCount, _ := strconv.Atoi(os.Getenv("JWT_SECRET_KEY_EXPIRE_MIN_COUNT"))
+	secret := []byte(TokenConfig.SecretKey)
 
 	// create new claims
 	claims := jwt.MapClaims{}
@@ -46,7 +53,7 @@ func generateNewAccessToken(id uint) (string, error) {
 	// set public claims
 	claims["id"] = id
 	claims["issuer"] = id
-	claims["expires"] = time.Now().Add(time.Minute * time.Duration(minutesCount)).Unix()
+	claims["expires"] = time.Now().Add(TokenConfig.AccessTTL).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -62,16 +69,14 @@ func generateNewAccessToken(id uint) (string, error) {
 func generateNewRefreshToken() (string, error) {
 	hash := sha256.New()
 
-	refresh := os.Getenv("JWT_REFRESH_KEY") + time.Now().String()
+	refresh := TokenConfig.RefreshKey + time.Now().String()
 
 	_, err := hash.Write([]byte(refresh))
 	if err != nil {
 		return "", err
 	}
 
-	hoursCount, _ := strconv.Atoi(os.Getenv("JWT_REFRESH_KEY_EXPIRE_HOURS_COUNT"))
-
-	expireTime := fmt.Sprint(time.Now().Add(time.Hour * time.Duration(hoursCount)).Unix())
+	expireTime := fmt.Sprint(time.Now().Add(TokenConfig.RefreshTTL).Unix())
 	t := hex.EncodeToString(hash.Sum(nil)) + "." + expireTime
 	return t, nil
 }
@@ -0,0 +1,192 @@
+// Package analytics logs anonymized searches and clicks and rolls them up
+// into hourly stats per query, which the admin search reports read.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"gorm.io/gorm"
+)
+
+const (
+	queueSize     = 4096
+	batchSize     = 200
+	flushInterval = time.Second
+	// rollupInterval is how often the hourly stats are recomputed,
+	// rollupLookback how many past hours each run recomputes so late
+	// clicks are counted
+	rollupInterval = 10 * time.Minute
+	rollupLookback = 3 * time.Hour
+	// retention is how long raw events are kept
+	retention = 30 * 24 * time.Hour
+)
+
+// Service logs searches and clicks in the background and keeps the hourly
+// stats up to date. Events arriving while the queue is full are dropped.
+type Service struct {
+	db     *gorm.DB
+	key    []byte
+	events chan interface{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewService returns a Service hashing user IDs with key. Without one a
+// random key is used, and the same user is then not recognized across
+// restarts.
+func NewService(db *gorm.DB, key []byte) *Service {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate the search analytics key: %v", err)
+		}
+	}
+
+	return &Service{
+		db:     db,
+		key:    key,
+		events: make(chan interface{}, queueSize),
+		done:   make(chan struct{}, 2),
+	}
+}
+
+// anonymize returns a keyed hash of userID, "" for anonymous users.
+func (s *Service) anonymize(userID uint) string {
+	if userID == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strconv.FormatUint(uint64(userID), 10)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// LogSearch queues a search of userID, 0 when anonymous.
+func (s *Service) LogSearch(searchID, kind, query string, userID uint, results int64, latency time.Duration) {
+	s.enqueue(&models.SearchEvent{
+		SearchID:    searchID,
+		Kind:        kind,
+		Query:       query,
+		UserHash:    s.anonymize(userID),
+		ResultCount: results,
+		LatencyMs:   latency.Milliseconds(),
+		CreatedAt:   time.Now(),
+	})
+}
+
+// LogClick queues a click on the result at position of a search.
+func (s *Service) LogClick(searchID string, position int) {
+	s.enqueue(&models.SearchClickEvent{
+		SearchID:  searchID,
+		Position:  position,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (s *Service) enqueue(event interface{}) {
+	select {
+	case s.events <- event:
+	default:
+		log.Printf("Search analytics queue is full, dropping an event")
+	}
+}
+
+// Start writes the queued events and rolls up the stats.
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go s.write(ctx)
+	go s.rollup(ctx)
+}
+
+// Stop writes the queued events and stops the service.
+func (s *Service) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	<-s.done
+}
+
+func (s *Service) write(ctx context.Context) {
+	defer func() { s.done <- struct{}{} }()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := []interface{}{}
+	for {
+		select {
+		case event := <-s.events:
+			batch = append(batch, event)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			for len(s.events) > 0 {
+				batch = append(batch, <-s.events)
+			}
+			s.flush(batch)
+			return
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (s *Service) flush(batch []interface{}) {
+	searches := []*models.SearchEvent{}
+	clicks := []*models.SearchClickEvent{}
+	for _, event := range batch {
+		switch event := event.(type) {
+		case *models.SearchEvent:
+			searches = append(searches, event)
+		case *models.SearchClickEvent:
+			clicks = append(clicks, event)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if len(searches) > 0 {
+		if err := s.db.WithContext(ctx).Create(&searches).Error; err != nil {
+			log.Printf("Failed to log %d searches: %v", len(searches), err)
+		}
+	}
+	if len(clicks) > 0 {
+		if err := s.db.WithContext(ctx).Create(&clicks).Error; err != nil {
+			log.Printf("Failed to log %d search clicks: %v", len(clicks), err)
+		}
+	}
+}
+
+func (s *Service) rollup(ctx context.Context) {
+	defer func() { s.done <- struct{}{} }()
+
+	for {
+		if err := models.RollupSearchStats(ctx, s.db, time.Now().Add(-rollupLookback)); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to roll up the search stats: %v", err)
+		}
+		if err := models.PurgeSearchEvents(ctx, s.db, time.Now().Add(-retention)); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to purge old search events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rollupInterval):
+		}
+	}
+}
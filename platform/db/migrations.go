@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"strings"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/migrate"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// goMigrations are the migrations whose SQL is built in Go, from the
+// default language among others. Their checksum covers the SQL they
+// render, so a database migrated in another language is reported rather
+// than left with vectors stemmed in the wrong one.
+var goMigrations = []*migrate.Migration{
+	{
+		Version: 3,
+		Name:    "product_translation_search_vector",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx, productTranslationSearchVector()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx, "ALTER TABLE product_translations DROP COLUMN IF EXISTS search_vector")
+		},
+		Source: func() string {
+			return strings.Join(productTranslationSearchVector(), ";\n")
+		},
+	},
+	{
+		// stemmed in the default language of the first migration
+		Version: 4,
+		Name:    "search_vectors",
+		Up: func(tx *gorm.DB) error {
+			return execAll(tx, models.SearchVectorSchema()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return execAll(tx, models.DropSearchVectorSchema()...)
+		},
+		Source: func() string {
+			return strings.Join(models.SearchVectorSchema(), ";\n")
+		},
+	},
+}
+
+// productTranslationSearchVector returns the statements searching the
+// translations by a vector stemmed in their language.
+func productTranslationSearchVector() []string {
+	return []string{
+		"ALTER TABLE product_translations ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (" + models.ProductTranslationSearchVector() + ") STORED",
+		"CREATE INDEX IF NOT EXISTS idx_product_translations_search ON product_translations USING gin (search_vector)",
+	}
+}
+
+func execAll(tx *gorm.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMigrator returns the migrator of the schema of db: the SQL files of
+// migrations/, embedded in the binary, and the migrations in Go.
+func NewMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	migrations, err := migrate.FromFS(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, append(migrations, goMigrations...))
+}
+
+// Migrate applies the pending migrations to db.
+func Migrate(ctx context.Context, db *gorm.DB) ([]*migrate.Migration, error) {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Up(ctx)
+}
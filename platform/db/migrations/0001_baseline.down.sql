@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS
+	"search_query_stats",
+	"search_click_events",
+	"search_events",
+	"search_history_settings",
+	"search_histories",
+	"vocabulary_words",
+	"synonym_groups",
+	"webhook_attempts",
+	"webhook_deliveries",
+	"webhook_subscriptions",
+	"dead_letters",
+	"outbox_events",
+	"marketplace_products",
+	"product_translations",
+	"environment_tags",
+	"reports",
+	"lca_metrics",
+	"environmental_product_declarations",
+	"product_images",
+	"products",
+	"categories",
+	"brands",
+	"uploaded_images",
+	"users";
@@ -0,0 +1,99 @@
+-- The schema AutoMigrate used to create. Every statement is skipped where
+-- its object exists, so databases it created adopt the migrations; the
+-- columns added since the first of them are added to their tables below.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- AutoMigrate named the marketplace table after the struct, the searches
+-- always read marketplace_products
+DO $$
+BEGIN
+	IF to_regclass('market_place_products') IS NOT NULL AND to_regclass('marketplace_products') IS NULL THEN
+		ALTER TABLE market_place_products RENAME TO marketplace_products;
+		ALTER INDEX IF EXISTS idx_market_place_products_deleted_at RENAME TO idx_marketplace_products_deleted_at;
+	END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"first_name" text,"last_name" text,"username" text,"avatar_url" text,"email" text,"password_hash" text,"user_status" bigint,"user_role" text,"uploaded_images" json,"visited_products" json,"visited_pages" json,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "uploaded_images" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"content_type" text NOT NULL,"content_url" text NOT NULL,"description" text,"is_public" boolean DEFAULT false,"upload_date" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_uploaded_images_deleted_at" ON "uploaded_images" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "brands" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_brands_deleted_at" ON "brands" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "categories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"description" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_categories_deleted_at" ON "categories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "products" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" varchar(255),"brand_id" bigint,"barcode" text,"description" text,"price" decimal,"link" text,"category_id" bigint,"eco_score" decimal,PRIMARY KEY ("id"),CONSTRAINT "fk_categories_products" FOREIGN KEY ("category_id") REFERENCES "categories"("id"),CONSTRAINT "fk_products_brand" FOREIGN KEY ("brand_id") REFERENCES "brands"("id"));
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "eco_score" decimal;
+CREATE INDEX IF NOT EXISTS "idx_products_eco_score" ON "products" ("eco_score");
+CREATE INDEX IF NOT EXISTS "idx_products_deleted_at" ON "products" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "product_images" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"image" text,PRIMARY KEY ("id"),CONSTRAINT "fk_products_images" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_product_images_deleted_at" ON "product_images" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "environmental_product_declarations" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"description" text,PRIMARY KEY ("id"),CONSTRAINT "fk_products_epd" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_environmental_product_declarations_deleted_at" ON "environmental_product_declarations" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "lca_metrics" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"value" decimal,"unit" text,"epd_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_environmental_product_declarations_lca_metrics" FOREIGN KEY ("epd_id") REFERENCES "environmental_product_declarations"("id"));
+CREATE INDEX IF NOT EXISTS "idx_lca_metrics_deleted_at" ON "lca_metrics" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "reports" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"epd_id" bigint,"summary" text,PRIMARY KEY ("id"),CONSTRAINT "fk_products_reports" FOREIGN KEY ("epd_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_reports_deleted_at" ON "reports" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "environment_tags" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"product_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_products_environment_tags" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_environment_tags_deleted_at" ON "environment_tags" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "product_translations" ("product_id" bigint,"language" varchar(8),"name" varchar(255) NOT NULL,"description" text,"updated_at" timestamptz,PRIMARY KEY ("product_id","language"),CONSTRAINT "fk_products_translations" FOREIGN KEY ("product_id") REFERENCES "products"("id") ON DELETE CASCADE);
+
+CREATE TABLE IF NOT EXISTS "marketplace_products" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" varchar(255),"brand_id" bigint,"barcode" text,"description" text,"price" text,"link" text,"category_id" bigint,"eco_score" decimal,"stock" bigint,"desc" text,"pub_date" text,"quantity" bigint,"bar_code" text,"expiry_date" text,"date_of_manufacture" text,PRIMARY KEY ("id"),CONSTRAINT "fk_marketplace_products_brand" FOREIGN KEY ("brand_id") REFERENCES "brands"("id"),CONSTRAINT "fk_marketplace_products_category" FOREIGN KEY ("category_id") REFERENCES "categories"("id"));
+ALTER TABLE "marketplace_products" ADD COLUMN IF NOT EXISTS "eco_score" decimal;
+CREATE INDEX IF NOT EXISTS "idx_marketplace_products_eco_score" ON "marketplace_products" ("eco_score");
+CREATE INDEX IF NOT EXISTS "idx_marketplace_products_deleted_at" ON "marketplace_products" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "outbox_events" ("id" bigserial,"created_at" timestamptz,"aggregate_type" varchar(64) NOT NULL,"aggregate_id" bigint NOT NULL,"event_type" varchar(64) NOT NULL,"dedupe_key" varchar(64) NOT NULL,"payload" jsonb NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"next_attempt_at" timestamptz NOT NULL,"published_at" timestamptz,"last_error" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_outbox_events_published_at" ON "outbox_events" ("published_at");
+CREATE INDEX IF NOT EXISTS "idx_outbox_events_next_attempt_at" ON "outbox_events" ("next_attempt_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_outbox_events_dedupe_key" ON "outbox_events" ("dedupe_key");
+CREATE INDEX IF NOT EXISTS "idx_outbox_aggregate" ON "outbox_events" ("aggregate_type","aggregate_id");
+
+CREATE TABLE IF NOT EXISTS "dead_letters" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"topic" varchar(255) NOT NULL,"subscription" varchar(255),"message_id" varchar(255),"data" bytea,"attributes" jsonb,"delivery_attempts" bigint,"reason" text,"replay_count" bigint,"replayed_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_dead_letters_topic" ON "dead_letters" ("topic");
+CREATE INDEX IF NOT EXISTS "idx_dead_letters_deleted_at" ON "dead_letters" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "webhook_subscriptions" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"url" varchar(2048) NOT NULL,"secret" varchar(128) NOT NULL,"events" jsonb NOT NULL,"product_ids" jsonb,"active" boolean NOT NULL DEFAULT true,"consecutive_failures" bigint NOT NULL DEFAULT 0,"disabled_at" timestamptz,"disabled_reason" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_webhook_subscriptions_user_id" ON "webhook_subscriptions" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_subscriptions_deleted_at" ON "webhook_subscriptions" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"subscription_id" bigint NOT NULL,"event_id" varchar(64) NOT NULL,"event_type" varchar(64) NOT NULL,"payload" jsonb NOT NULL,"status" varchar(16) NOT NULL,"attempts" bigint NOT NULL DEFAULT 0,"next_attempt_at" timestamptz NOT NULL,"last_status_code" bigint,"last_error" text,"delivered_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_next_attempt_at" ON "webhook_deliveries" ("next_attempt_at");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_status" ON "webhook_deliveries" ("status");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_webhook_delivery_event" ON "webhook_deliveries" ("subscription_id","event_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_deleted_at" ON "webhook_deliveries" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "webhook_attempts" ("id" bigserial,"delivery_id" bigint NOT NULL,"attempt" bigint,"status_code" bigint,"error" text,"duration_ms" bigint,"requested_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_webhook_attempts_delivery_id" ON "webhook_attempts" ("delivery_id");
+
+CREATE TABLE IF NOT EXISTS "synonym_groups" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"terms" jsonb NOT NULL,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_synonym_groups_deleted_at" ON "synonym_groups" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "vocabulary_words" ("word" varchar(64),"frequency" bigint NOT NULL,PRIMARY KEY ("word"));
+
+CREATE TABLE IF NOT EXISTS "search_histories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"search_id" varchar(36),"kind" varchar(32),"query" varchar(256),"filters" jsonb,"result_count" bigint,"clicked_type" varchar(32),"clicked_id" bigint,"search_date" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_users_search_history" FOREIGN KEY ("user_id") REFERENCES "users"("id"));
+CREATE INDEX IF NOT EXISTS "idx_search_histories_search_id" ON "search_histories" ("search_id");
+CREATE INDEX IF NOT EXISTS "idx_search_histories_user_id" ON "search_histories" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_search_histories_deleted_at" ON "search_histories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "search_history_settings" ("user_id" bigint,"paused" boolean NOT NULL DEFAULT false,"updated_at" timestamptz,PRIMARY KEY ("user_id"));
+
+CREATE TABLE IF NOT EXISTS "search_events" ("id" bigserial,"search_id" varchar(36),"kind" varchar(32) NOT NULL,"query" varchar(256) NOT NULL,"user_hash" varchar(32),"result_count" bigint,"latency_ms" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_search_events_created_at" ON "search_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_search_events_search_id" ON "search_events" ("search_id");
+
+CREATE TABLE IF NOT EXISTS "search_click_events" ("id" bigserial,"search_id" varchar(36) NOT NULL,"position" bigint NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_search_click_events_search_id" ON "search_click_events" ("search_id");
+
+CREATE TABLE IF NOT EXISTS "search_query_stats" ("hour" timestamptz,"kind" varchar(32),"query" varchar(256),"searches" bigint NOT NULL,"users" bigint NOT NULL,"zero_results" bigint NOT NULL,"clicked_searches" bigint NOT NULL,"click_position_sum" bigint NOT NULL,"latency_ms_sum" bigint NOT NULL,PRIMARY KEY ("hour","kind","query"));
+
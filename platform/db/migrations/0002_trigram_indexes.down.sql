@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_products_name_trgm;
+DROP INDEX IF EXISTS idx_brands_name_trgm;
+DROP INDEX IF EXISTS idx_categories_name_trgm;
+DROP INDEX IF EXISTS idx_vocabulary_words_word_trgm;
@@ -0,0 +1,5 @@
+-- trigram matching for the autocomplete and the spelling correction
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_brands_name_trgm ON brands USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_vocabulary_words_word_trgm ON vocabulary_words USING gin (word gin_trgm_ops);
@@ -0,0 +1,23 @@
+-- one account per email, regardless of case; deleted accounts free theirs.
+-- Accounts sharing an email must be merged or deleted by hand first, this
+-- names them rather than failing on the first conflict of the index.
+DO $$
+DECLARE
+	duplicates text;
+BEGIN
+	SELECT string_agg(email || ' (users ' || ids || ')', ', ' ORDER BY email) INTO duplicates
+	FROM (
+		SELECT lower(email) AS email, string_agg(id::text, ', ' ORDER BY id) AS ids
+		FROM users
+		WHERE deleted_at IS NULL
+		GROUP BY lower(email)
+		HAVING count(*) > 1
+	) AS shared;
+
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION 'accounts share their email: %', duplicates
+			USING HINT = 'Merge or delete the duplicate accounts, then migrate again.';
+	END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_unique ON users (lower(email)) WHERE deleted_at IS NULL;
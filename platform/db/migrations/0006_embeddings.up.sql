@@ -0,0 +1,13 @@
+-- The embeddings of the semantic search are stored with pgvector. Where the
+-- extension is not installed the table is left out, semantic search cannot
+-- be enabled there; installing pgvector and migrating down 1 then up again
+-- adds it.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+		CREATE EXTENSION IF NOT EXISTS vector;
+		CREATE TABLE IF NOT EXISTS "embeddings" ("entity_type" varchar(32),"entity_id" bigint,"model" varchar(128),"content_hash" char(64) NOT NULL,"embedding" vector NOT NULL,"updated_at" timestamptz,PRIMARY KEY ("entity_type","entity_id","model"));
+	ELSE
+		RAISE NOTICE 'pgvector is not available, semantic search is disabled';
+	END IF;
+END $$;
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+// TestGoMigrationChecksums checks the checksums of the Go migrations change
+// with the default language their SQL is stemmed in.
+func TestGoMigrationChecksums(t *testing.T) {
+	defer func(language string) { models.DefaultLanguage = language }(models.DefaultLanguage)
+
+	checksums := func() map[int64]string {
+		sums := map[int64]string{}
+		for _, migration := range goMigrations {
+			sums[migration.Version] = migration.Checksum()
+		}
+		return sums
+	}
+
+	models.DefaultLanguage = "en"
+	english := checksums()
+	if again := checksums(); again[4] != english[4] {
+		t.Errorf("checksum of migration 4 = %s then %s, want it stable", english[4], again[4])
+	}
+
+	models.DefaultLanguage = "de"
+	german := checksums()
+	if german[4] == english[4] {
+		t.Error("checksum of migration 4 is the same in English and German")
+	}
+	// the translations are stemmed in their own language
+	if german[3] != english[3] {
+		t.Error("checksum of migration 3 changed with the default language")
+	}
+}
@@ -1,16 +1,14 @@
 package db
 
 import (
-	"os"
-
 	"github.com/go-redis/redis/v8"
 )
 
-var RedisClient *redis.Client
-
-func CreateRedisClient() {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_SEARCH_CACHE"),
-		DB:   2,
+// CreateRedisClient returns the client of the Redis at addr, the
+// connections are made when it is first used.
+func CreateRedisClient(addr string, db int) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr: addr,
+		DB:   db,
 	})
 }
@@ -0,0 +1,128 @@
+// Package federated searches every searchable entity at once and merges
+// the results, answering with whatever finished before the deadline.
+package federated
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// Result is the outcome of a federated search.
+type Result struct {
+	// Groups holds the hits of every type that answered, in the order of
+	// models.SearchTypes
+	Groups []*models.SearchTypeHits `json:"groups"`
+	// Partial is true when a type timed out or failed, Warnings says which
+	Partial  bool     `json:"partial"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type answer struct {
+	kind string
+	hits *models.SearchTypeHits
+	err  error
+}
+
+// Search runs q against every type of types concurrently and returns the
+// limit best hits of each, scored against the best hit of all. Types still running when ctx is done are left
+// out with a warning, as are types that failed. Types that cannot be
+// filtered by the fields of q are skipped silently. The error is only set
+// when no type answered.
+func Search(ctx context.Context, db *gorm.DB, q *query.Query, types []string, limit int) (*Result, error) {
+	answers := make(chan answer, len(types))
+	for _, kind := range types {
+		go func(kind string) {
+			hits, err := models.SearchType(ctx, db, kind, q, limit)
+			answers <- answer{kind: kind, hits: hits, err: err}
+		}(kind)
+	}
+
+	result := &Result{Groups: []*models.SearchTypeHits{}}
+	pending := map[string]bool{}
+	for _, kind := range types {
+		pending[kind] = true
+	}
+
+	failed := 0
+	for len(pending) > 0 {
+		select {
+		case a := <-answers:
+			delete(pending, a.kind)
+			switch {
+			case a.err == nil:
+				result.Groups = append(result.Groups, a.hits)
+			case errors.Is(a.err, models.ErrSearchTypeNotSupported):
+			case ctx.Err() != nil:
+				failed++
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s search timed out", a.kind))
+			default:
+				failed++
+				log.Printf("Failed to search %s for %q: %v", a.kind, q.Raw, a.err)
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s search failed", a.kind))
+			}
+		case <-ctx.Done():
+			for _, kind := range types {
+				if pending[kind] {
+					failed++
+					result.Warnings = append(result.Warnings, fmt.Sprintf("%s search timed out", kind))
+				}
+			}
+			pending = nil
+		}
+	}
+
+	if failed > 0 && len(result.Groups) == 0 {
+		return nil, errors.New("no search type answered in time")
+	}
+
+	models.NormalizeScores(result.Groups)
+	result.Partial = failed > 0
+	sort.SliceStable(result.Groups, func(i, j int) bool {
+		return typeOrder(result.Groups[i].Type) < typeOrder(result.Groups[j].Type)
+	})
+	sort.Strings(result.Warnings)
+	return result, nil
+}
+
+// Interleave merges the hits of every group, best score first.
+// Ties go to the type listed first in models.SearchTypes and then to the
+// better hit within its type.
+func (r *Result) Interleave() []models.SearchHit {
+	hits := []models.SearchHit{}
+	for _, group := range r.Groups {
+		hits = append(hits, group.Hits...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return typeOrder(hits[i].Type) < typeOrder(hits[j].Type)
+	})
+	return hits
+}
+
+// Totals maps every type that answered to its number of matches.
+func (r *Result) Totals() map[string]int64 {
+	totals := map[string]int64{}
+	for _, group := range r.Groups {
+		totals[group.Type] = group.Total
+	}
+	return totals
+}
+
+func typeOrder(kind string) int {
+	for i, t := range models.SearchTypes {
+		if t == kind {
+			return i
+		}
+	}
+	return len(models.SearchTypes)
+}
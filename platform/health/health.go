@@ -0,0 +1,185 @@
+// Package health checks the dependencies of the API for its liveness and
+// readiness probes. Every dependency is checked with its own timeout and the
+// result is reused for a while, so probes hitting every replica often do
+// not load the databases.
+package health
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of a dependency and of the API
+const (
+	StatusUp = "up"
+	// StatusDegraded is the status of the API when an optional dependency
+	// is down, it still serves
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Check returns an error when the dependency it checks is unusable. It must
+// return when ctx is done.
+type Check func(ctx context.Context) error
+
+type Options struct {
+	// Timeout bounds a run of the check
+	Timeout time.Duration
+	// TTL is how long the result of a run is reused
+	TTL time.Duration
+	// Optional dependencies being down degrade the API without making it
+	// unready
+	Optional bool
+}
+
+// DefaultOptions are the options of a required dependency.
+func DefaultOptions() Options {
+	return Options{
+		Timeout: 2 * time.Second,
+		TTL:     5 * time.Second,
+	}
+}
+
+// Result is the outcome of the last run of a check.
+type Result struct {
+	Status string `json:"status"`
+	// LatencyMS is how long the check took, in milliseconds
+	LatencyMS float64 `json:"latency_ms"`
+	// Error is why the dependency is down. It tells a timeout from a
+	// failure, the cause is logged rather than shown to the probes.
+	Error     string    `json:"error,omitempty"`
+	Optional  bool      `json:"optional,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the health of the API and of each of its dependencies.
+type Report struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining,omitempty"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+// Ready tells if the API should be sent traffic.
+func (r Report) Ready() bool {
+	return r.Status != StatusDown && !r.Draining
+}
+
+type dependency struct {
+	name  string
+	check Check
+	opts  Options
+
+	// mu is held during a run, so concurrent probes wait for its result
+	// rather than running the check again
+	mu     sync.Mutex
+	result Result
+	ran    bool
+}
+
+// Service runs the checks of the dependencies of the API.
+type Service struct {
+	dependencies []*dependency
+	draining     int32
+}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+// Register adds the check of the dependency name. Dependencies are
+// registered while the API is built, before it serves.
+func (s *Service) Register(name string, check Check, opts Options) {
+	s.dependencies = append(s.dependencies, &dependency{name: name, check: check, opts: opts})
+}
+
+// Drain makes the API unready, for the load balancers to stop sending it
+// traffic before it shuts down.
+func (s *Service) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *Service) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Report checks the dependencies whose result is older than their TTL, in
+// parallel, and returns the health of the API.
+func (s *Service) Report() Report {
+	results := make([]Result, len(s.dependencies))
+
+	var wg sync.WaitGroup
+	for i, d := range s.dependencies {
+		wg.Add(1)
+		go func(i int, d *dependency) {
+			defer wg.Done()
+			results[i] = d.run()
+		}(i, d)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:   StatusUp,
+		Draining: s.Draining(),
+		Checks:   make(map[string]Result, len(results)),
+	}
+	for i, result := range results {
+		report.Checks[s.dependencies[i].name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Optional {
+			if report.Status == StatusUp {
+				report.Status = StatusDegraded
+			}
+		} else {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (d *dependency) run() Result {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ran && time.Since(d.result.CheckedAt) < d.opts.TTL {
+		return d.result
+	}
+
+	// A check is not bound to the probe that ran it, its result is shared
+	ctx, cancel := context.WithTimeout(context.Background(), d.opts.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := d.check(ctx)
+	result := Result{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+		Optional:  d.opts.Optional,
+		CheckedAt: started,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = "unavailable"
+		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			result.Error = "timeout"
+		}
+	}
+
+	// Log the changes of status rather than every failed run
+	if result.Status != d.result.Status {
+		if err != nil {
+			log.Printf("Health check %s failed: %v", d.name, err)
+		} else if d.ran {
+			log.Printf("Health check %s recovered", d.name)
+		}
+	}
+
+	d.result = result
+	d.ran = true
+	return result
+}
@@ -0,0 +1,104 @@
+// Package history records the searches of signed-in users off the request
+// path, in batches.
+package history
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"gorm.io/gorm"
+)
+
+const (
+	queueSize     = 1024
+	batchSize     = 100
+	flushInterval = time.Second
+)
+
+// Recorder stores searches in the background. Searches arriving while the
+// queue is full are dropped, history is not worth slowing searches down.
+type Recorder struct {
+	db      *gorm.DB
+	entries chan models.SearchHistory
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{
+		db:      db,
+		entries: make(chan models.SearchHistory, queueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Record queues a search for storage without blocking.
+func (r *Recorder) Record(entry models.SearchHistory) {
+	if entry.SearchDate.IsZero() {
+		entry.SearchDate = time.Now()
+	}
+
+	select {
+	case r.entries <- entry:
+	default:
+		log.Printf("Search history queue is full, dropping a search of user %d", entry.UserID)
+	}
+}
+
+func (r *Recorder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		batch := []models.SearchHistory{}
+		for {
+			select {
+			case entry := <-r.entries:
+				batch = append(batch, entry)
+				if len(batch) < batchSize {
+					continue
+				}
+			case <-ticker.C:
+			case <-ctx.Done():
+				// store what is queued before stopping
+				for len(r.entries) > 0 {
+					batch = append(batch, <-r.entries)
+				}
+				r.flush(batch)
+				return
+			}
+
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}()
+}
+
+// Stop stores the queued searches and stops the recorder.
+func (r *Recorder) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+func (r *Recorder) flush(batch []models.SearchHistory) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := models.SaveSearchHistory(ctx, r.db, batch); err != nil {
+		log.Printf("Failed to store %d searches in the search history: %v", len(batch), err)
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+
+	"github.com/r3tr056/ecolens_api/platform/searchcache"
+)
+
+// RegisterPostgres times the statements of db and exposes the stats of its
+// connection pool.
+func RegisterPostgres(db *gorm.DB) error {
+	if err := db.Use(GormPlugin{}); err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, "postgres"))
+}
+
+// RegisterRedis exposes the stats of the connection pool of client, name
+// tells the clients apart.
+func RegisterRedis(name string, client *redis.Client) error {
+	return Registry.Register(newRedisPoolCollector(name, client))
+}
+
+// RegisterSearchCache exposes the lookups of cache.
+func RegisterSearchCache(cache *searchcache.Cache) error {
+	return Registry.Register(&searchCacheCollector{
+		cache: cache,
+		lookups: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "search_cache", "lookups_total"),
+			"Lookups of the search cache, by result: hit, stale_hit, miss or error.",
+			[]string{"result"}, nil,
+		),
+	})
+}
+
+type searchCacheCollector struct {
+	cache   *searchcache.Cache
+	lookups *prometheus.Desc
+}
+
+func (c *searchCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lookups
+}
+
+func (c *searchCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.StaleHits), "stale_hit")
+	ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.Errors), "error")
+}
+
+type redisPoolCollector struct {
+	client *redis.Client
+
+	hits, misses, timeouts        *prometheus.Desc
+	totalConns, idleConns, stales *prometheus.Desc
+}
+
+func newRedisPoolCollector(name string, client *redis.Client) *redisPoolCollector {
+	labels := prometheus.Labels{"client": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "redis_pool", metric), help, nil, labels)
+	}
+
+	return &redisPoolCollector{
+		client:     client,
+		hits:       desc("hits_total", "Times a free connection was found in the pool."),
+		misses:     desc("misses_total", "Times a free connection was not found in the pool."),
+		timeouts:   desc("timeouts_total", "Times waiting for a connection timed out."),
+		totalConns: desc("connections", "Connections in the pool."),
+		idleConns:  desc("idle_connections", "Idle connections in the pool."),
+		stales:     desc("stale_connections_total", "Stale connections removed from the pool."),
+	}
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.stales
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stales, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// startedKey is the instance setting holding when a statement started
+const startedKey = "metrics:started"
+
+var dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "db",
+	Name:      "query_duration_seconds",
+	Help:      "Time taken by the statements of gorm, by operation, table and status.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"operation", "table", "status"})
+
+// GormPlugin times the statements run through gorm. Raw statements have no
+// table, they are labelled with none.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+
+	for _, p := range processors {
+		if err := p.before("metrics:before_"+p.operation, startStatement); err != nil {
+			return err
+		}
+		if err := p.after("metrics:after_"+p.operation, observeStatement(p.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startStatement(db *gorm.DB) {
+	db.InstanceSet(startedKey, time.Now())
+}
+
+func observeStatement(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startedKey)
+		if !ok {
+			return
+		}
+		started, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "none"
+		}
+		status := "ok"
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			status = "error"
+		}
+		dbQueryDuration.WithLabelValues(operation, table, status).Observe(time.Since(started).Seconds())
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute labels the requests answered before reaching a route, by
+// a middleware or the not found handler
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Requests served, by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve requests, by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Requests being served.",
+	})
+)
+
+// methods are the methods counted under their name, the others are counted
+// as OTHER
+var methods = map[string]bool{
+	fiber.MethodGet:     true,
+	fiber.MethodHead:    true,
+	fiber.MethodPost:    true,
+	fiber.MethodPut:     true,
+	fiber.MethodPatch:   true,
+	fiber.MethodDelete:  true,
+	fiber.MethodOptions: true,
+}
+
+// HTTP returns the middleware measuring the requests. Errors returned by
+// the handlers are rendered by the error handler of the app here, for
+// their status to be counted, so it goes after the middlewares rendering
+// errors themselves, like the logger.
+func HTTP() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		started := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		method := c.Method()
+		if !methods[method] {
+			method = "OTHER"
+		}
+
+		// The catch-all routes of the middlewares have the template /
+		route := c.Route().Path
+		if route == "/" && c.Path() != "/" {
+			route = unmatchedRoute
+		}
+
+		status := strconv.Itoa(c.Response().StatusCode())
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpDuration.WithLabelValues(method, route, status).Observe(time.Since(started).Seconds())
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+// Package metrics exposes the Prometheus metrics of the API on /metrics.
+// Labels only take values from bounded sets, route templates rather than
+// paths, status codes, tables and the RPC methods of the contracts, so the
+// number of series does not grow with the traffic.
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the metrics of the API
+const namespace = "ecolens"
+
+// Registry holds the metrics served by Handler, with the ones of the Go
+// runtime and of the process.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		httpInFlight,
+		dbQueryDuration,
+		RPCPublished,
+		RPCReceived,
+		RPCFailed,
+		RPCInFlight,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		Registry: Registry,
+	}))
+}
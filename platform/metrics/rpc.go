@@ -0,0 +1,47 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics of the RPCs to the ML workers, by method of the contracts
+var (
+	RPCPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "published_total",
+		Help:      "Requests published to the ML workers, by method.",
+	}, []string{"method"})
+
+	RPCReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "received_total",
+		Help:      "Responses received from the ML workers, by method.",
+	}, []string{"method"})
+
+	// RPCFailed counts the calls by reason: publish, timeout, stopped, the
+	// remote method failing or its result breaking the contract
+	RPCFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "failed_total",
+		Help:      "Calls to the ML workers that failed, by method and reason.",
+	}, []string{"method", "reason"})
+
+	// RPCInFlight is the number of calls waiting for their response, image
+	// search jobs among them
+	RPCInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "in_flight",
+		Help:      "Calls to the ML workers waiting for their response, by method.",
+	}, []string{"method"})
+)
+
+// Reasons of the failed RPCs
+const (
+	RPCFailedPublish = "publish"
+	RPCFailedTimeout = "timeout"
+	RPCFailedStopped = "stopped"
+	RPCFailedRemote  = "remote"
+	RPCFailedInvalid = "invalid"
+)
@@ -0,0 +1,270 @@
+// Package migrate applies versioned schema migrations, in SQL or Go, and
+// records them with their checksums in the schema_migrations table. A
+// PostgreSQL advisory lock makes replicas starting together migrate one at
+// a time.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockKey identifies the advisory lock of the migrations
+const lockKey int64 = 0x65636f6c656e73 // "ecolens"
+
+// Migration is a versioned schema change. SQL migrations set UpSQL and
+// DownSQL, Go migrations Up and Down. Each runs in a transaction.
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	// Source renders the SQL run by a Go migration building it at runtime,
+	// so that its checksum changes with it.
+	Source func() string
+}
+
+// Checksum identifies the content of a SQL migration, and the version, name
+// and rendered source of a Go migration, whose code cannot be hashed.
+func (m *Migration) Checksum() string {
+	content := m.UpSQL + "\x00" + m.DownSQL
+	if m.Up != nil {
+		content = fmt.Sprintf("go:%d:%s", m.Version, m.Name)
+		if m.Source != nil {
+			content += "\x00" + m.Source()
+		}
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+func (m *Migration) up(tx *gorm.DB) error {
+	if m.Up != nil {
+		return m.Up(tx)
+	}
+	return tx.Exec(m.UpSQL).Error
+}
+
+func (m *Migration) down(tx *gorm.DB) error {
+	if m.Down != nil {
+		return m.Down(tx)
+	}
+	if m.DownSQL == "" {
+		return ErrIrreversible
+	}
+	return tx.Exec(m.DownSQL).Error
+}
+
+// ErrIrreversible is returned when rolling back a migration without a down
+// step.
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// ErrChecksumMismatch is returned when an applied migration was changed
+// since. Applied migrations must not be edited, a new one must follow.
+var ErrChecksumMismatch = errors.New("applied migration was modified")
+
+// AppliedMigration is a row of the schema_migrations table.
+type AppliedMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	Checksum  string    `gorm:"type:char(64);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (AppliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// States of a migration
+const (
+	StatePending  = "pending"
+	StateApplied  = "applied"
+	StateModified = "modified"
+	// StateUnknown is a migration applied by a newer binary
+	StateUnknown = "unknown"
+)
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*Migration
+}
+
+// New returns a Migrator of migrations, which need distinct versions.
+func New(db *gorm.DB, migrations []*Migration) (*Migrator, error) {
+	sorted := append([]*Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %s: version must be positive", m)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", sorted[i-1], m)
+		}
+		if m.Up == nil && m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %s has no up step", m)
+		}
+	}
+
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// locked runs fn on a single connection holding the advisory lock, after
+// creating the schema_migrations table. Other replicas wait for the lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+
+		if err := conn.AutoMigrate(&AppliedMigration{}); err != nil {
+			return fmt.Errorf("failed to create the migrations table: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+func applied(conn *gorm.DB) (map[int64]AppliedMigration, error) {
+	var rows []AppliedMigration
+	if err := conn.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]AppliedMigration, len(rows))
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+	return byVersion, nil
+}
+
+// Up applies the pending migrations in order and returns them. It stops at
+// the first failure, the migrations before it stay applied.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	done := []*Migration{}
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		rows, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if row, ok := rows[migration.Version]; ok {
+				if row.Checksum != migration.Checksum() {
+					return fmt.Errorf("%s: %w", migration, ErrChecksumMismatch)
+				}
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&AppliedMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					Checksum:  migration.Checksum(),
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	done := []*Migration{}
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		rows, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			row, ok := rows[migration.Version]
+			if !ok {
+				continue
+			}
+			if row.Checksum != migration.Checksum() {
+				return fmt.Errorf("%s: %w", migration, ErrChecksumMismatch)
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&AppliedMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to roll back %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns the state of every known migration, and of the applied
+// migrations this binary does not know, by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	statuses := []Status{}
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		rows, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name, State: StatePending}
+			if row, ok := rows[migration.Version]; ok {
+				appliedAt := row.AppliedAt
+				status.AppliedAt = &appliedAt
+				status.State = StateApplied
+				if row.Checksum != migration.Checksum() {
+					status.State = StateModified
+				}
+				delete(rows, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+
+		for _, row := range rows {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, Status{Version: row.Version, Name: row.Name, State: StateUnknown, AppliedAt: &appliedAt})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,197 @@
+// Package outbox publishes domain events recorded in the outbox table to the
+// message broker.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Message attributes set on every published event
+const (
+	AttrEventType     = "event_type"
+	AttrAggregateType = "aggregate_type"
+	AttrAggregateID   = "aggregate_id"
+	AttrDedupeKey     = "dedupe_key"
+)
+
+type Options struct {
+	Topic        string
+	PollInterval time.Duration
+	BatchSize    int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// published events are deleted once Retention has passed, checked every
+	// PurgeInterval
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// DefaultOptions returns the relay defaults, publishing to topic.
+func DefaultOptions(topic string) Options {
+	return Options{
+		Topic:         topic,
+		PollInterval:  time.Second,
+		BatchSize:     100,
+		BaseBackoff:   time.Second,
+		MaxBackoff:    5 * time.Minute,
+		Retention:     7 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+// Relay polls the outbox table and publishes pending events. Only the oldest
+// unpublished event of each aggregate is picked up, so a failing event holds
+// back the later events of the same aggregate and ordering is preserved.
+// Rows are claimed with SKIP LOCKED, several replicas can run a relay.
+type Relay struct {
+	db     *gorm.DB
+	broker pubsub.Broker
+	opts   Options
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(db *gorm.DB, broker pubsub.Broker, opts Options) *Relay {
+	return &Relay{
+		db:     db,
+		broker: broker,
+		opts:   opts,
+		done:   make(chan struct{}),
+	}
+}
+
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		defer close(r.done)
+
+		var purgedAt time.Time
+		for {
+			if time.Since(purgedAt) >= r.opts.PurgeInterval {
+				if _, err := r.PurgePublished(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Outbox relay failed to purge published events: %v", err)
+				}
+				purgedAt = time.Now()
+			}
+
+			published, err := r.PublishPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Outbox relay failed to publish events: %v", err)
+			}
+
+			// keep draining while there is a backlog
+			if published > 0 && err == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.opts.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop stops the relay and waits for the batch in flight.
+func (r *Relay) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// PublishPending publishes one batch of due events and returns how many were
+// published.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	published := 0
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []models.OutboxEvent
+
+		heads := tx.Model(&models.OutboxEvent{}).
+			Select("MIN(id)").
+			Where("published_at IS NULL").
+			Group("aggregate_type, aggregate_id")
+
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id IN (?) AND next_attempt_at <= ?", heads, time.Now()).
+			Order("id").
+			Limit(r.opts.BatchSize).
+			Find(&events).
+			Error
+		if err != nil {
+			return err
+		}
+
+		for i := range events {
+			event := &events[i]
+
+			if err := r.publish(ctx, event); err != nil {
+				event.Attempts++
+				event.LastError = err.Error()
+				event.NextAttemptAt = time.Now().Add(pubsub.Backoff(r.opts.BaseBackoff, r.opts.MaxBackoff, event.Attempts))
+				log.Printf("Failed to publish outbox event %d (%s), attempt %d: %v", event.ID, event.EventType, event.Attempts, err)
+			} else {
+				now := time.Now()
+				event.Attempts++
+				event.LastError = ""
+				event.PublishedAt = &now
+				published++
+			}
+
+			if err := tx.Save(event).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return published, err
+}
+
+// PurgePublished deletes the events published longer ago than the retention,
+// a batch at a time, and returns how many were deleted.
+func (r *Relay) PurgePublished(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-r.opts.Retention)
+	expired := r.db.Model(&models.OutboxEvent{}).
+		Select("id").
+		Where("published_at < ?", before).
+		Limit(r.opts.BatchSize)
+
+	var purged int64
+	for {
+		result := r.db.WithContext(ctx).Where("id IN (?)", expired).Delete(&models.OutboxEvent{})
+		purged += result.RowsAffected
+		if result.Error != nil || result.RowsAffected < int64(r.opts.BatchSize) {
+			return purged, result.Error
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, event *models.OutboxEvent) error {
+	_, err := r.broker.Publish(ctx, r.opts.Topic, &pubsub.Message{
+		Data: event.Payload,
+		Attributes: map[string]string{
+			AttrEventType:     event.EventType,
+			AttrAggregateType: event.AggregateType,
+			AttrAggregateID:   fmt.Sprint(event.AggregateID),
+			AttrDedupeKey:     event.DedupeKey,
+		},
+	})
+	return err
+}
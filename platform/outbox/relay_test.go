@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/db"
+)
+
+// testDB returns a migrated database with an empty outbox. The tests using
+// it are skipped unless ECOLENS_TEST_DSN names a disposable Postgres
+// database.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("ECOLENS_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ECOLENS_TEST_DSN is not set")
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Exec("TRUNCATE outbox_events RESTART IDENTITY").Error; err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// TestPurgePublished checks only the events published before the retention
+// are deleted.
+func TestPurgePublished(t *testing.T) {
+	conn := testDB(t)
+	opts := DefaultOptions("events")
+	opts.Retention = time.Hour
+	opts.BatchSize = 2
+	relay := NewRelay(conn, nil, opts)
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+	published := map[string]*time.Time{"old-1": &old, "old-2": &old, "old-3": &old, "recent": &recent, "pending": nil}
+	for key, publishedAt := range published {
+		event := models.OutboxEvent{
+			AggregateType: models.AggregateProduct,
+			AggregateID:   1,
+			EventType:     models.EventProductUpdated,
+			DedupeKey:     key,
+			Payload:       []byte("{}"),
+			NextAttemptAt: time.Now(),
+			PublishedAt:   publishedAt,
+		}
+		if err := conn.Create(&event).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := relay.PurgePublished(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 3 {
+		t.Errorf("purged = %d, want 3", purged)
+	}
+
+	var kept []string
+	if err := conn.Model(&models.OutboxEvent{}).Order("dedupe_key").Pluck("dedupe_key", &kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0] != "pending" || kept[1] != "recent" {
+		t.Errorf("kept = %v, want the pending and recent events", kept)
+	}
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Supported broker backends
+const (
+	BackendGoogle = "google"
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+)
+
+// Backends lists the supported broker backends.
+var Backends = []string{BackendGoogle, BackendRedis, BackendMemory}
+
+// Attribute keys set by the brokers when a message is dead-lettered
+const (
+	AttrDeadLetterReason = "dead_letter_reason"
+	AttrOriginalTopic    = "original_topic"
+)
+
+// Message is a transport-agnostic message handed to subscribers. Every
+// received message must be settled with exactly one call to Ack or Nack.
+type Message struct {
+	ID              string
+	Topic           string
+	Data            []byte
+	Attributes      map[string]string
+	DeliveryAttempt int
+	PublishTime     time.Time
+
+	once sync.Once
+	ack  func()
+	nack func(delay time.Duration)
+}
+
+// Ack acknowledges the message so the broker does not redeliver it.
+func (m *Message) Ack() {
+	m.once.Do(func() {
+		if m.ack != nil {
+			m.ack()
+		}
+	})
+}
+
+// Nack returns the message to the broker for immediate redelivery.
+func (m *Message) Nack() {
+	m.NackWithDelay(0)
+}
+
+// NackWithDelay returns the message to the broker to be redelivered once
+// delay has passed.
+func (m *Message) NackWithDelay(delay time.Duration) {
+	m.once.Do(func() {
+		if m.nack != nil {
+			m.nack(delay)
+		}
+	})
+}
+
+// Handler processes a single message. The handler is responsible for
+// calling Ack or Nack on the message.
+type Handler func(ctx context.Context, msg *Message)
+
+// Broker is the interface every messaging backend implements.
+type Broker interface {
+	// Publish sends data to the topic and returns the broker assigned ID.
+	Publish(ctx context.Context, topic string, msg *Message) (string, error)
+
+	// Subscribe delivers messages published on the topic to handler until ctx
+	// is cancelled. Subscribers sharing a subscription name compete for messages.
+	Subscribe(ctx context.Context, topic, subscription string, handler Handler) error
+
+	// DeadLetter moves the message to the topic's dead-letter topic and acks it.
+	DeadLetter(ctx context.Context, msg *Message, reason string) error
+
+	// Ping checks the broker is reachable and, when the backend can tell,
+	// that the topic exists.
+	Ping(ctx context.Context, topic string) error
+
+	Close() error
+}
+
+// BrokerConfig selects and configures a broker backend.
+type BrokerConfig struct {
+	Backend        string
+	GoogleProject  string
+	RedisAddr      string
+	RedisDB        int
+	RedisGroupIdle time.Duration
+}
+
+// NewBroker creates the broker selected by cfg.Backend.
+func NewBroker(ctx context.Context, cfg BrokerConfig) (Broker, error) {
+	switch cfg.Backend {
+	case BackendGoogle:
+		return NewGoogleBroker(ctx, cfg.GoogleProject)
+	case BackendRedis:
+		return NewRedisBroker(cfg.RedisAddr, cfg.RedisDB, cfg.RedisGroupIdle)
+	case BackendMemory:
+		return NewMemoryBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown message broker backend %q", cfg.Backend)
+	}
+}
+
+// DeadLetterTopic returns the name of the dead-letter topic for topic.
+func DeadLetterTopic(topic string) string {
+	return topic + "-dead-letter"
+}
+
+func deadLetterAttributes(msg *Message, reason string) map[string]string {
+	attrs := make(map[string]string, len(msg.Attributes)+2)
+	for k, v := range msg.Attributes {
+		attrs[k] = v
+	}
+	attrs[AttrDeadLetterReason] = reason
+	attrs[AttrOriginalTopic] = msg.Topic
+	return attrs
+}
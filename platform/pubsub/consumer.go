@@ -0,0 +1,134 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ConsumerHandler processes a message. Returning nil acks the message, a
+// Permanent error dead-letters it and any other error schedules a retry.
+type ConsumerHandler func(ctx context.Context, msg *Message) error
+
+// DeadLetterRecorder persists a dead-lettered message so it can be inspected
+// and replayed later.
+type DeadLetterRecorder func(ctx context.Context, subscription string, msg *Message, reason string) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type RetryPolicy struct {
+	// MaxDeliveries is the number of deliveries after which a failing
+	// message is dead-lettered.
+	MaxDeliveries int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxDeliveries: 5,
+		BaseBackoff:   time.Second,
+		MaxBackoff:    time.Minute,
+	}
+}
+
+// Backoff returns the delay before retry number attempt, doubling base on
+// every attempt up to max.
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Consumer subscribes to a topic with retry, backoff and dead-letter semantics
+// on top of a Broker.
+type Consumer struct {
+	broker   Broker
+	policy   RetryPolicy
+	recorder DeadLetterRecorder
+}
+
+// NewConsumer creates a Consumer. recorder may be nil when dead letters only
+// need to reach the dead-letter topic.
+func NewConsumer(broker Broker, policy RetryPolicy, recorder DeadLetterRecorder) *Consumer {
+	return &Consumer{
+		broker:   broker,
+		policy:   policy,
+		recorder: recorder,
+	}
+}
+
+// Run delivers the messages of the subscription to handler until ctx is
+// cancelled.
+func (c *Consumer) Run(ctx context.Context, topic, subscription string, handler ConsumerHandler) error {
+	return c.broker.Subscribe(ctx, topic, subscription, func(ctx context.Context, msg *Message) {
+		err := c.handle(ctx, msg, handler)
+		if err == nil {
+			msg.Ack()
+			return
+		}
+
+		if IsPermanent(err) || msg.DeliveryAttempt >= c.policy.MaxDeliveries {
+			c.deadLetter(ctx, subscription, msg, err)
+			return
+		}
+
+		delay := Backoff(c.policy.BaseBackoff, c.policy.MaxBackoff, msg.DeliveryAttempt)
+		log.Printf("Message %s on %s failed on attempt %d, retrying in %s: %v", msg.ID, topic, msg.DeliveryAttempt, delay, err)
+		msg.NackWithDelay(delay)
+	})
+}
+
+// handle runs handler and turns a panic into a retryable error.
+func (c *Consumer) handle(ctx context.Context, msg *Message, handler ConsumerHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while handling message: %v", r)
+		}
+	}()
+
+	return handler(ctx, msg)
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, subscription string, msg *Message, cause error) {
+	reason := cause.Error()
+	log.Printf("Dead-lettering message %s on %s after %d deliveries: %s", msg.ID, msg.Topic, msg.DeliveryAttempt, reason)
+
+	if err := c.broker.DeadLetter(ctx, msg, reason); err != nil {
+		log.Printf("Failed to dead-letter message %s, returning it for redelivery: %v", msg.ID, err)
+		msg.NackWithDelay(c.policy.MaxBackoff)
+		return
+	}
+
+	if c.recorder != nil {
+		if err := c.recorder(ctx, subscription, msg, reason); err != nil {
+			log.Printf("Failed to record dead letter %s: %v", msg.ID, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package contracts defines the versioned message contracts exchanged with
+// the ML workers. Every method has typed argument and result structs, a list
+// of supported schema versions and converters down to the older versions, so
+// workers speaking an old version keep working while the contract evolves.
+package contracts
+
+//go:generate go run ../../../cmd/schemagen -out schemas
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// LegacyVersion is the schema version of payloads that carry no
+// schema_version field.
+const LegacyVersion = 1
+
+// Converter rewrites the JSON arguments of one schema version into another.
+type Converter func(json.RawMessage) (json.RawMessage, error)
+
+// Contract describes one RPC method.
+type Contract struct {
+	Method string
+	// Versions lists the supported schema versions, oldest first. The last
+	// one is described by NewArgs and NewResult.
+	Versions []int
+	// TypedSince is the first version with a typed result. Results of older
+	// versions are passed through untouched.
+	TypedSince int
+	NewArgs    func() interface{}
+	NewResult  func() interface{}
+	// Downgrades[v] converts arguments of version v+1 to v. The API only
+	// sends requests, the workers upgrade the arguments they receive.
+	Downgrades map[int]Converter
+}
+
+var (
+	registry = map[string]*Contract{}
+	validate = validator.New()
+)
+
+func Register(c *Contract) {
+	registry[c.Method] = c
+}
+
+// Lookup returns the contract registered for method.
+func Lookup(method string) (*Contract, error) {
+	c, ok := registry[method]
+	if !ok {
+		return nil, fmt.Errorf("no message contract registered for method %q", method)
+	}
+	return c, nil
+}
+
+// All returns every registered contract sorted by method name.
+func All() []*Contract {
+	all := make([]*Contract, 0, len(registry))
+	for _, c := range registry {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Method < all[j].Method })
+	return all
+}
+
+func (c *Contract) Latest() int {
+	return c.Versions[len(c.Versions)-1]
+}
+
+func (c *Contract) Supports(version int) bool {
+	for _, v := range c.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate returns the highest version supported by both the contract and
+// the peer.
+func (c *Contract) Negotiate(peerVersions []int) (int, error) {
+	for i := len(c.Versions) - 1; i >= 0; i-- {
+		for _, pv := range peerVersions {
+			if pv == c.Versions[i] {
+				return pv, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no common schema version for %s, we support %v and the peer %v", c.Method, c.Versions, peerVersions)
+}
+
+// EncodeArgs validates args, which must be the latest argument struct, and
+// encodes them at the requested version.
+func (c *Contract) EncodeArgs(args interface{}, version int) (json.RawMessage, error) {
+	if !c.Supports(version) {
+		return nil, fmt.Errorf("%s does not support schema version %d", c.Method, version)
+	}
+
+	if err := validate.Struct(args); err != nil {
+		return nil, fmt.Errorf("invalid %s arguments: %v", c.Method, err)
+	}
+
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	for v := c.Latest() - 1; v >= version; v-- {
+		down, ok := c.Downgrades[v]
+		if !ok {
+			return nil, fmt.Errorf("%s has no downgrade from version %d to %d", c.Method, v+1, v)
+		}
+		if raw, err = down(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	return raw, nil
+}
+
+// DecodeResult decodes and validates a result sent at version.
+func (c *Contract) DecodeResult(raw json.RawMessage, version int) (interface{}, error) {
+	if !c.Supports(version) {
+		return nil, fmt.Errorf("%s does not support schema version %d", c.Method, version)
+	}
+
+	if version < c.TypedSince {
+		return raw, nil
+	}
+
+	result := c.NewResult()
+	if err := json.Unmarshal(raw, result); err != nil {
+		return nil, fmt.Errorf("invalid %s result: %v", c.Method, err)
+	}
+	if err := validate.Struct(result); err != nil {
+		return nil, fmt.Errorf("invalid %s result: %v", c.Method, err)
+	}
+
+	return result, nil
+}
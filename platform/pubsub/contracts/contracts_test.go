@@ -0,0 +1,95 @@
+package contracts_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
+)
+
+func lookup(t *testing.T, method string) *contracts.Contract {
+	t.Helper()
+	c, err := contracts.Lookup(method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestEncodeArgs checks the arguments sent to the workers speaking the
+// version 1, untyped, protocol have its shapes.
+func TestEncodeArgs(t *testing.T) {
+	tests := []struct {
+		method  string
+		args    interface{}
+		version int
+		want    string
+	}{
+		{contracts.MethodProductAnalysis, &contracts.ProductAnalysisArgs{ProductID: 42, ProductType: "product"}, contracts.LegacyVersion, `42`},
+		{contracts.MethodProductAnalysis, &contracts.ProductAnalysisArgs{ProductID: 42, ProductType: "product"}, 2, `{"product_id":42,"product_type":"product"}`},
+		{contracts.MethodImageSearch, &contracts.ImageSearchArgs{ImageReference: "images/1.jpg", UserID: 7, MaxResults: 5}, contracts.LegacyVersion, `{"image_reference":"images/1.jpg"}`},
+		{contracts.MethodImageSearch, &contracts.ImageSearchArgs{ImageReference: "images/1.jpg", UserID: 7}, 2, `{"image_reference":"images/1.jpg","user_id":7}`},
+	}
+
+	for _, tt := range tests {
+		raw, err := lookup(t, tt.method).EncodeArgs(tt.args, tt.version)
+		if err != nil {
+			t.Errorf("%s v%d: %v", tt.method, tt.version, err)
+			continue
+		}
+		if string(raw) != tt.want {
+			t.Errorf("%s v%d = %s, want %s", tt.method, tt.version, raw, tt.want)
+		}
+	}
+
+	analysis := lookup(t, contracts.MethodProductAnalysis)
+	if _, err := analysis.EncodeArgs(&contracts.ProductAnalysisArgs{ProductID: 42, ProductType: "service"}, 2); err == nil {
+		t.Error("invalid arguments were encoded")
+	}
+	if _, err := analysis.EncodeArgs(&contracts.ProductAnalysisArgs{ProductID: 42, ProductType: "product"}, 3); err == nil {
+		t.Error("arguments were encoded at an unsupported version")
+	}
+}
+
+// TestDecodeLegacyResult checks the results of the untyped versions are
+// passed through and the typed ones validated.
+func TestDecodeLegacyResult(t *testing.T) {
+	analysis := lookup(t, contracts.MethodProductAnalysis)
+
+	legacy := json.RawMessage(`{"score": "B", "notes": ["recycled steel"]}`)
+	result, err := analysis.DecodeResult(legacy, contracts.LegacyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := result.(json.RawMessage); !ok || string(raw) != string(legacy) {
+		t.Errorf("legacy result = %#v, want it untouched", result)
+	}
+
+	result, err = analysis.DecodeResult(json.RawMessage(`{"product_id": 42, "eco_score": 71.5}`), 2)
+	want := &contracts.ProductAnalysisResult{ProductID: 42, EcoScore: 71.5}
+	if err != nil || !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %#v, %v, want %#v", result, err, want)
+	}
+
+	if _, err := analysis.DecodeResult(json.RawMessage(`{"product_id": 42, "eco_score": 140}`), 2); err == nil {
+		t.Error("a result out of range was decoded")
+	}
+	if _, err := analysis.DecodeResult(json.RawMessage(`{"score": "B"}`), 2); err == nil {
+		t.Error("a legacy result was decoded as a typed one")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	search := lookup(t, contracts.MethodImageSearch)
+
+	if version, err := search.Negotiate([]int{1, 2, 3}); err != nil || version != 2 {
+		t.Errorf("Negotiate = %d, %v, want 2", version, err)
+	}
+	if version, err := search.Negotiate([]int{1}); err != nil || version != 1 {
+		t.Errorf("Negotiate = %d, %v, want 1", version, err)
+	}
+	if _, err := search.Negotiate([]int{3}); err == nil {
+		t.Error("Negotiate found a version the contract does not support")
+	}
+}
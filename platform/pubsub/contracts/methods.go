@@ -0,0 +1,98 @@
+package contracts
+
+import "encoding/json"
+
+// RPC methods served by the ML workers
+const (
+	MethodImageSearch      = "image-search"
+	MethodProductAnalysis  = "analyze-product-info"
+	MethodReportGeneration = "generate-report"
+)
+
+// ImageSearchArgs asks the worker to identify the products in an image.
+// Version 1 only carried image_reference.
+type ImageSearchArgs struct {
+	ImageReference string `json:"image_reference" validate:"required"`
+	UserID         uint   `json:"user_id,omitempty"`
+	MaxResults     int    `json:"max_results,omitempty" validate:"omitempty,min=1,max=50"`
+}
+
+type ImageSearchMatch struct {
+	ProductID  uint    `json:"product_id,omitempty"`
+	Label      string  `json:"label" validate:"required"`
+	Confidence float64 `json:"confidence" validate:"min=0,max=1"`
+}
+
+type ImageSearchResult struct {
+	Matches []ImageSearchMatch `json:"matches" validate:"dive"`
+}
+
+// ProductAnalysisArgs asks the worker to analyse a product's environmental
+// information. Version 1 sent the bare product ID as args.
+type ProductAnalysisArgs struct {
+	ProductID   uint   `json:"product_id" validate:"required"`
+	ProductType string `json:"product_type" validate:"required,oneof=product marketplace_product"`
+}
+
+type ProductAnalysisResult struct {
+	ProductID uint    `json:"product_id" validate:"required"`
+	EcoScore  float64 `json:"eco_score" validate:"min=0,max=100"`
+	Summary   string  `json:"summary"`
+}
+
+// ReportGenerationArgs asks the worker to build a report from a product's EPD.
+type ReportGenerationArgs struct {
+	ProductID uint   `json:"product_id" validate:"required"`
+	EPDID     uint   `json:"epd_id,omitempty"`
+	Format    string `json:"format,omitempty" validate:"omitempty,oneof=json pdf"`
+}
+
+type ReportGenerationResult struct {
+	ReportID uint   `json:"report_id" validate:"required"`
+	Summary  string `json:"summary"`
+	URL      string `json:"url,omitempty" validate:"omitempty,url"`
+}
+
+func init() {
+	Register(&Contract{
+		Method:     MethodImageSearch,
+		Versions:   []int{1, 2},
+		TypedSince: 2,
+		NewArgs:    func() interface{} { return &ImageSearchArgs{} },
+		NewResult:  func() interface{} { return &ImageSearchResult{} },
+		Downgrades: map[int]Converter{
+			1: func(raw json.RawMessage) (json.RawMessage, error) {
+				var args ImageSearchArgs
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, err
+				}
+				return json.Marshal(map[string]string{"image_reference": args.ImageReference})
+			},
+		},
+	})
+
+	Register(&Contract{
+		Method:     MethodProductAnalysis,
+		Versions:   []int{1, 2},
+		TypedSince: 2,
+		NewArgs:    func() interface{} { return &ProductAnalysisArgs{} },
+		NewResult:  func() interface{} { return &ProductAnalysisResult{} },
+		Downgrades: map[int]Converter{
+			1: func(raw json.RawMessage) (json.RawMessage, error) {
+				var args ProductAnalysisArgs
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, err
+				}
+				return json.Marshal(args.ProductID)
+			},
+		},
+	})
+
+	Register(&Contract{
+		Method:     MethodReportGeneration,
+		Versions:   []int{1},
+		TypedSince: 1,
+		NewArgs:    func() interface{} { return &ReportGenerationArgs{} },
+		NewResult:  func() interface{} { return &ReportGenerationResult{} },
+	})
+}
@@ -0,0 +1,194 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// JSONSchema returns the JSON Schema of the request and response envelopes
+// of the contract's latest version, generated from the Go structs.
+func (c *Contract) JSONSchema() map[string]interface{} {
+	version := c.Latest()
+
+	request := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message_id":      map[string]interface{}{"type": "string", "minLength": 1},
+			"method":          map[string]interface{}{"const": c.Method},
+			"schema_version":  map[string]interface{}{"const": version},
+			"accept_versions": versionsSchema(),
+			"args":            schemaFor(reflect.TypeOf(c.NewArgs())),
+		},
+		"required": []string{"message_id", "method", "schema_version", "args"},
+	}
+
+	response := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message_id":      map[string]interface{}{"type": "string", "minLength": 1},
+			"method":          map[string]interface{}{"const": c.Method},
+			"schema_version":  map[string]interface{}{"const": version},
+			"accept_versions": versionsSchema(),
+			"result":          schemaFor(reflect.TypeOf(c.NewResult())),
+			"error":           map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"message_id", "schema_version"},
+		"oneOf": []interface{}{
+			map[string]interface{}{"required": []string{"result"}},
+			map[string]interface{}{"required": []string{"error"}},
+		},
+	}
+
+	return map[string]interface{}{
+		"$schema": schemaDialect,
+		"$id":     fmt.Sprintf("https://ecolens.app/schemas/rpc/%s.v%d.json", c.Method, version),
+		"title":   fmt.Sprintf("%s v%d", c.Method, version),
+		"$defs": map[string]interface{}{
+			"request":  request,
+			"response": response,
+		},
+		"oneOf": []interface{}{
+			map[string]interface{}{"$ref": "#/$defs/request"},
+			map[string]interface{}{"$ref": "#/$defs/response"},
+		},
+	}
+}
+
+func versionsSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "integer", "minimum": 1},
+	}
+}
+
+func schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		prop := schemaFor(field.Type)
+		if applyValidateTag(prop, field.Tag.Get("validate")) {
+			required = append(required, name)
+		}
+		properties[name] = prop
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyValidateTag translates the validator rules we use into JSON Schema
+// keywords and reports whether the field is required.
+func applyValidateTag(prop map[string]interface{}, tag string) bool {
+	required := false
+	isString := prop["type"] == "string"
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, value := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, value = rule[:i], rule[i+1:]
+		}
+
+		switch key {
+		case "required":
+			required = true
+			if isString {
+				prop["minLength"] = 1
+			} else if prop["minimum"] == 0 {
+				// a required unsigned ID must be non zero
+				prop["minimum"] = 1
+			}
+		case "min", "gte":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				if isString {
+					prop["minLength"] = n
+				} else {
+					prop["minimum"] = n
+				}
+			}
+		case "max", "lte":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				if isString {
+					prop["maxLength"] = n
+				} else {
+					prop["maximum"] = n
+				}
+			}
+		case "oneof":
+			prop["enum"] = strings.Fields(value)
+		case "url":
+			prop["format"] = "uri"
+		case "email":
+			prop["format"] = "email"
+		}
+	}
+
+	return required
+}
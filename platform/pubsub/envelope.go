@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope is the wire format of RPC requests and responses exchanged with
+// the ML workers. Payloads without a schema_version are version 1, the
+// untyped format the workers spoke before contracts were versioned.
+type Envelope struct {
+	MessageID      string          `json:"message_id"`
+	Method         string          `json:"method,omitempty"`
+	SchemaVersion  int             `json:"schema_version,omitempty"`
+	AcceptVersions []int           `json:"accept_versions,omitempty"`
+	Args           json.RawMessage `json:"args,omitempty"`
+	Kwargs         json.RawMessage `json:"kwargs,omitempty"`
+	Result         json.RawMessage `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// IsResponse reports whether the envelope carries a result or an error
+// rather than a request.
+func (e *Envelope) IsResponse() bool {
+	return e.Result != nil || e.Error != ""
+}
+
+// DecodeEnvelope decodes data into an Envelope. It never panics, malformed
+// payloads are reported as permanent errors so they are dead-lettered
+// instead of being retried.
+func DecodeEnvelope(data []byte) (env *Envelope, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			env = nil
+			err = Permanent(fmt.Errorf("panic while decoding message: %v", r))
+		}
+	}()
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, Permanent(fmt.Errorf("empty message"))
+	}
+
+	env = &Envelope{}
+	if err := json.Unmarshal(data, env); err != nil {
+		return nil, Permanent(fmt.Errorf("failed to decode JSON message: %v", err))
+	}
+
+	if env.MessageID == "" {
+		return nil, Permanent(fmt.Errorf("message has no message_id"))
+	}
+
+	return env, nil
+}
@@ -0,0 +1,207 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GoogleBroker is a Broker backed by Google Cloud Pub/Sub.
+type GoogleBroker struct {
+	client *pubsub.Client
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
+}
+
+func NewGoogleBroker(ctx context.Context, projectID string) (*GoogleBroker, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pub/Sub client : %v", err)
+	}
+
+	return &GoogleBroker{
+		client: client,
+		topics: make(map[string]*pubsub.Topic),
+	}, nil
+}
+
+func (b *GoogleBroker) topic(name string) *pubsub.Topic {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok {
+		t = b.client.Topic(name)
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *GoogleBroker) Publish(ctx context.Context, topic string, msg *Message) (string, error) {
+	result := b.topic(topic).Publish(ctx, &pubsub.Message{
+		Data:       msg.Data,
+		Attributes: msg.Attributes,
+	})
+
+	return result.Get(ctx)
+}
+
+// Delivery policy of the subscriptions created by GoogleBroker. Pub/Sub
+// only counts the deliveries of a message when its subscription has a
+// dead-letter policy. The Consumer dead-letters a failing message itself
+// after its own MaxDeliveries, Pub/Sub does after googleMaxDeliveries, the
+// most it allows, for the messages that keep the consumer from settling
+// them.
+const (
+	googleMaxDeliveries = 100
+	googleMinBackoff    = time.Second
+	googleMaxBackoff    = time.Minute
+)
+
+func (b *GoogleBroker) Subscribe(ctx context.Context, topic, subscription string, handler Handler) error {
+	sub, err := b.subscription(ctx, topic, subscription)
+	if err != nil {
+		return err
+	}
+
+	return sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		// set as the subscription has a dead-letter policy
+		attempt := 1
+		if m.DeliveryAttempt != nil {
+			attempt = *m.DeliveryAttempt
+		}
+
+		handler(ctx, &Message{
+			ID:              m.ID,
+			Topic:           topic,
+			Data:            m.Data,
+			Attributes:      m.Attributes,
+			DeliveryAttempt: attempt,
+			PublishTime:     m.PublishTime,
+			ack:             m.Ack,
+			nack: func(delay time.Duration) {
+				// Pub/Sub has no per message redelivery delay, keep the lease
+				// until the delay has passed and nack then
+				if delay <= 0 {
+					m.Nack()
+					return
+				}
+				time.AfterFunc(delay, m.Nack)
+			},
+		})
+	})
+}
+
+// subscription returns the subscription to topic, creating it when
+// missing, with the dead-letter and retry policies of the broker. Those of
+// a subscription created without them are updated. The Pub/Sub service
+// account needs to publish to the dead-letter topic and to subscribe to
+// the subscription for Pub/Sub to forward the messages.
+func (b *GoogleBroker) subscription(ctx context.Context, topic, subscription string) (*pubsub.Subscription, error) {
+	deadLetters, err := b.ensureTopic(ctx, DeadLetterTopic(topic))
+	if err != nil {
+		return nil, err
+	}
+	deadLetterPolicy := &pubsub.DeadLetterPolicy{
+		DeadLetterTopic:     deadLetters.String(),
+		MaxDeliveryAttempts: googleMaxDeliveries,
+	}
+	retryPolicy := &pubsub.RetryPolicy{
+		MinimumBackoff: googleMinBackoff,
+		MaximumBackoff: googleMaxBackoff,
+	}
+
+	sub := b.client.Subscription(subscription)
+	exists, err := sub.Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		sub, err = b.client.CreateSubscription(ctx, subscription, pubsub.SubscriptionConfig{
+			Topic:            b.topic(topic),
+			AckDeadline:      20 * time.Second,
+			DeadLetterPolicy: deadLetterPolicy,
+			RetryPolicy:      retryPolicy,
+		})
+		if err == nil {
+			return sub, nil
+		}
+		if status.Code(err) != codes.AlreadyExists {
+			return nil, fmt.Errorf("failed to create Pub/Sub subscription: %v", err)
+		}
+		// created by another replica meanwhile
+		sub = b.client.Subscription(subscription)
+	}
+
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DeadLetterPolicy == nil {
+		_, err = sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{
+			DeadLetterPolicy: deadLetterPolicy,
+			RetryPolicy:      retryPolicy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set the dead-letter policy of Pub/Sub subscription %s: %v", subscription, err)
+		}
+	}
+	return sub, nil
+}
+
+// ensureTopic returns the topic name, creating it when missing.
+func (b *GoogleBroker) ensureTopic(ctx context.Context, name string) (*pubsub.Topic, error) {
+	t := b.topic(name)
+	exists, err := t.Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return t, nil
+	}
+
+	if _, err := b.client.CreateTopic(ctx, name); err != nil && status.Code(err) != codes.AlreadyExists {
+		return nil, fmt.Errorf("failed to create Pub/Sub topic %s: %v", name, err)
+	}
+	return t, nil
+}
+
+func (b *GoogleBroker) DeadLetter(ctx context.Context, msg *Message, reason string) error {
+	_, err := b.Publish(ctx, DeadLetterTopic(msg.Topic), &Message{
+		Data:       msg.Data,
+		Attributes: deadLetterAttributes(msg, reason),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.Ack()
+	return nil
+}
+
+func (b *GoogleBroker) Ping(ctx context.Context, topic string) error {
+	exists, err := b.topic(topic).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	return nil
+}
+
+func (b *GoogleBroker) Close() error {
+	b.mu.Lock()
+	for _, t := range b.topics {
+		t.Stop()
+	}
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
@@ -0,0 +1,137 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const memoryQueueSize = 1024
+
+// MemoryBroker is an in-process Broker built on channels. It is meant for
+// local development and CI, messages are lost when the process exits.
+type MemoryBroker struct {
+	mu      sync.RWMutex
+	topics  map[string]map[string]chan *Message
+	counter uint64
+	closed  bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]map[string]chan *Message),
+	}
+}
+
+// queue returns the queue of a subscription, creating it on first use.
+func (b *MemoryBroker) queue(topic, subscription string) chan *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[string]chan *Message)
+		b.topics[topic] = subs
+	}
+
+	q, ok := subs[subscription]
+	if !ok {
+		q = make(chan *Message, memoryQueueSize)
+		subs[subscription] = q
+	}
+	return q
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg *Message) (string, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return "", errors.New("memory broker is closed")
+	}
+	b.counter++
+	id := fmt.Sprintf("mem_%d", b.counter)
+
+	queues := make([]chan *Message, 0, len(b.topics[topic]))
+	for _, q := range b.topics[topic] {
+		queues = append(queues, q)
+	}
+	b.mu.Unlock()
+
+	// every subscription gets its own copy of the message
+	for _, q := range queues {
+		m := &Message{
+			ID:              id,
+			Topic:           topic,
+			Data:            msg.Data,
+			Attributes:      msg.Attributes,
+			DeliveryAttempt: 1,
+			PublishTime:     time.Now(),
+		}
+		select {
+		case q <- m:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	return id, nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic, subscription string, handler Handler) error {
+	q := b.queue(topic, subscription)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m := <-q:
+			delivery := &Message{
+				ID:              m.ID,
+				Topic:           m.Topic,
+				Data:            m.Data,
+				Attributes:      m.Attributes,
+				DeliveryAttempt: m.DeliveryAttempt,
+				PublishTime:     m.PublishTime,
+				ack:             func() {},
+				nack: func(delay time.Duration) {
+					m.DeliveryAttempt++
+					time.AfterFunc(delay, func() { q <- m })
+				},
+			}
+			handler(ctx, delivery)
+		}
+	}
+}
+
+func (b *MemoryBroker) DeadLetter(ctx context.Context, msg *Message, reason string) error {
+	_, err := b.Publish(ctx, DeadLetterTopic(msg.Topic), &Message{
+		Data:       msg.Data,
+		Attributes: deadLetterAttributes(msg, reason),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.Ack()
+	return nil
+}
+
+func (b *MemoryBroker) Ping(ctx context.Context, topic string) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return errors.New("memory broker is closed")
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	return nil
+}
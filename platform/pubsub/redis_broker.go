@@ -0,0 +1,302 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	redisStreamPrefix  = "stream:"
+	redisDelayedPrefix = "stream-delayed:"
+	redisStreamMaxLen  = 100000
+	redisReadCount     = 10
+	redisReadBlock     = 2 * time.Second
+)
+
+// redisMoveDue moves the retries of KEYS[1] due by ARGV[1], ARGV[2] at most,
+// to the stream KEYS[2] for the group ARGV[4]. Being a script, a retry is
+// moved once however many consumers run it.
+var redisMoveDue = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, retry in ipairs(due) do
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', 'group', ARGV[4], 'retry', retry)
+	redis.call('ZREM', KEYS[1], retry)
+end
+return #due
+`)
+
+// RedisBroker is a Broker backed by Redis Streams. Every subscription maps
+// to a consumer group on the topic stream. A nacked entry is acked and kept
+// in a sorted set of the subscription until its delay has passed, then
+// added back to the stream for that subscription alone, so it is never
+// pending while it waits.
+type RedisBroker struct {
+	client   *redis.Client
+	consumer string
+	// pending entries idle for longer than claimIdle are taken over from
+	// consumers that died before settling them
+	claimIdle time.Duration
+}
+
+func NewRedisBroker(addr string, db int, claimIdle time.Duration) (*RedisBroker, error) {
+	if addr == "" {
+		return nil, errors.New("redis broker address is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+		DB:   db,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis broker: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &RedisBroker{
+		client:    client,
+		consumer:  fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+		claimIdle: claimIdle,
+	}, nil
+}
+
+func streamKey(topic string) string {
+	return redisStreamPrefix + topic
+}
+
+func delayedKey(topic, subscription string) string {
+	return redisDelayedPrefix + topic + ":" + subscription
+}
+
+// redisRetry is a nacked entry waiting for its delay. ID keeps the retries
+// of equal messages apart in the sorted set.
+type redisRetry struct {
+	ID         string            `json:"id"`
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attrs"`
+	Attempt    int               `json:"attempt"`
+}
+
+func (b *RedisBroker) add(ctx context.Context, topic string, data []byte, attrs map[string]string, attempt int) (string, error) {
+	encodedAttrs, err := json.Marshal(attrs)
+	if err != nil {
+		return "", err
+	}
+
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(topic),
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"data":    data,
+			"attrs":   encodedAttrs,
+			"attempt": attempt,
+		},
+	}).Result()
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, topic string, msg *Message) (string, error) {
+	return b.add(ctx, topic, msg.Data, msg.Attributes, 1)
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, topic, subscription string, handler Handler) error {
+	stream := streamKey(topic)
+
+	// the group starts at the beginning of the stream, so the messages
+	// published before its first subscriber are delivered
+	err := b.client.XGroupCreateMkStream(ctx, stream, subscription, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %v", err)
+	}
+
+	deliver := func(entry redis.XMessage, extraAttempts int) {
+		// retries are added for the subscription that nacked them
+		if group, ok := entry.Values["group"].(string); ok && group != subscription {
+			if err := b.client.XAck(ctx, stream, subscription, entry.ID).Err(); err != nil {
+				log.Printf("Failed to ack message %s: %v", entry.ID, err)
+			}
+			return
+		}
+		handler(ctx, b.message(topic, subscription, entry, extraAttempts))
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := redisMoveDue.Run(ctx, b.client, []string{delayedKey(topic, subscription), stream},
+			time.Now().UnixMilli(), redisReadCount, redisStreamMaxLen, subscription).Err()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to requeue the due retries on %s: %v", stream, err)
+		}
+
+		claimed, err := b.claim(ctx, stream, subscription)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim idle messages on %s: %v", stream, err)
+		}
+		for _, entry := range claimed {
+			deliver(entry, 1)
+		}
+
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    subscription,
+			Consumer: b.consumer,
+			Streams:  []string{stream, ">"},
+			Count:    redisReadCount,
+			Block:    redisReadBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for _, s := range streams {
+			for _, entry := range s.Messages {
+				deliver(entry, 0)
+			}
+		}
+	}
+}
+
+// claim takes over the entries of group idle for longer than claimIdle.
+// XAUTOCLAIM is not used, go-redis v8 cannot read its reply since Redis 7.
+func (b *RedisBroker) claim(ctx context.Context, stream, group string) ([]redis.XMessage, error) {
+	pending, err := b.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Idle:   b.claimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  redisReadCount,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	for i, entry := range pending {
+		ids[i] = entry.ID
+	}
+	return b.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: b.consumer,
+		MinIdle:  b.claimIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// message converts a stream entry into a Message. extraAttempts is added to
+// the recorded attempt for entries that were claimed from another consumer.
+func (b *RedisBroker) message(topic, group string, entry redis.XMessage, extraAttempts int) *Message {
+	stream := streamKey(topic)
+
+	data, _ := entry.Values["data"].(string)
+	attempt, _ := strconv.Atoi(fmt.Sprint(entry.Values["attempt"]))
+	attrs := map[string]string{}
+	if raw, ok := entry.Values["attrs"].(string); ok && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+			log.Printf("Failed to decode attributes of message %s: %v", entry.ID, err)
+		}
+	}
+
+	if raw, ok := entry.Values["retry"].(string); ok {
+		var retry redisRetry
+		if err := json.Unmarshal([]byte(raw), &retry); err != nil {
+			log.Printf("Failed to decode retry %s: %v", entry.ID, err)
+		}
+		data, attempt = string(retry.Data), retry.Attempt
+		if retry.Attributes != nil {
+			attrs = retry.Attributes
+		}
+	}
+
+	if attempt < 1 {
+		attempt = 1
+	}
+	attempt += extraAttempts
+
+	var publishTime time.Time
+	if ms, err := strconv.ParseInt(strings.SplitN(entry.ID, "-", 2)[0], 10, 64); err == nil {
+		publishTime = time.UnixMilli(ms)
+	}
+
+	ack := func() {
+		if err := b.client.XAck(context.Background(), stream, group, entry.ID).Err(); err != nil {
+			log.Printf("Failed to ack message %s: %v", entry.ID, err)
+		}
+	}
+
+	return &Message{
+		ID:              entry.ID,
+		Topic:           topic,
+		Data:            []byte(data),
+		Attributes:      attrs,
+		DeliveryAttempt: attempt,
+		PublishTime:     publishTime,
+		ack:             ack,
+		nack: func(delay time.Duration) {
+			if err := b.retry(topic, group, entry.ID, []byte(data), attrs, attempt+1, delay); err != nil {
+				log.Printf("Failed to requeue message %s: %v", entry.ID, err)
+			}
+		},
+	}
+}
+
+// retry settles the entry id and schedules its redelivery to group once
+// delay has passed, in one transaction. Should it fail, the entry stays
+// pending and is claimed again.
+func (b *RedisBroker) retry(topic, group, id string, data []byte, attrs map[string]string, attempt int, delay time.Duration) error {
+	encoded, err := json.Marshal(&redisRetry{ID: id, Data: data, Attributes: attrs, Attempt: attempt})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, delayedKey(topic, group), &redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: encoded,
+		})
+		pipe.XAck(ctx, streamKey(topic), group, id)
+		return nil
+	})
+	return err
+}
+
+func (b *RedisBroker) DeadLetter(ctx context.Context, msg *Message, reason string) error {
+	if _, err := b.add(ctx, DeadLetterTopic(msg.Topic), msg.Data, deadLetterAttributes(msg, reason), msg.DeliveryAttempt); err != nil {
+		return err
+	}
+
+	msg.Ack()
+	return nil
+}
+
+func (b *RedisBroker) Ping(ctx context.Context, topic string) error {
+	return b.client.Ping(ctx).Err()
+}
+
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,121 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// recorder records the delivery attempts of the messages a subscription
+// handles, by message data.
+type recorder struct {
+	mu       sync.Mutex
+	attempts map[string][]int
+}
+
+func (r *recorder) record(data string, attempt int) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.attempts == nil {
+		r.attempts = map[string][]int{}
+	}
+	r.attempts[data] = append(r.attempts[data], attempt)
+	return r.attempts[data]
+}
+
+func (r *recorder) get(data string) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.attempts[data]...)
+}
+
+// waitFor polls cond until it holds or timeout has passed.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func newTestRedisBroker(t *testing.T, claimIdle time.Duration) *RedisBroker {
+	t.Helper()
+	server := miniredis.RunT(t)
+	b, err := NewRedisBroker(server.Addr(), 0, claimIdle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// TestRedisBrokerDeliversEarlierMessages checks a new subscription gets the
+// messages published before its first subscriber started.
+func TestRedisBrokerDeliversEarlierMessages(t *testing.T) {
+	b := newTestRedisBroker(t, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := b.Publish(ctx, "events", &Message{Data: []byte("early")}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got recorder
+	go b.Subscribe(ctx, "events", "late", func(ctx context.Context, msg *Message) {
+		got.record(string(msg.Data), msg.DeliveryAttempt)
+		msg.Ack()
+	})
+
+	if !waitFor(t, 5*time.Second, func() bool { return len(got.get("early")) == 1 }) {
+		t.Errorf("attempts = %v, want the early message delivered", got.get("early"))
+	}
+}
+
+// TestRedisBrokerNack checks a nacked message is redelivered once after its
+// delay, to its subscription alone, even when idle entries are claimed at
+// once.
+func TestRedisBrokerNack(t *testing.T) {
+	b := newTestRedisBroker(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var retried, other recorder
+	var nackedAt time.Time
+	go b.Subscribe(ctx, "events", "retrying", func(ctx context.Context, msg *Message) {
+		if attempts := retried.record(string(msg.Data), msg.DeliveryAttempt); len(attempts) == 1 {
+			nackedAt = time.Now()
+			msg.NackWithDelay(300 * time.Millisecond)
+			return
+		}
+		if time.Since(nackedAt) < 300*time.Millisecond {
+			t.Error("message redelivered before its delay")
+		}
+		msg.Ack()
+	})
+	go b.Subscribe(ctx, "events", "other", func(ctx context.Context, msg *Message) {
+		other.record(string(msg.Data), msg.DeliveryAttempt)
+		msg.Ack()
+	})
+
+	if _, err := b.Publish(ctx, "events", &Message{Data: []byte("flaky")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !waitFor(t, 5*time.Second, func() bool { return len(retried.get("flaky")) == 2 }) {
+		t.Fatalf("attempts = %v, want the message redelivered", retried.get("flaky"))
+	}
+	// let a duplicate arrive, were there one
+	time.Sleep(2 * redisReadBlock)
+
+	if attempts := retried.get("flaky"); len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("attempts = %v, want [1 2]", attempts)
+	}
+	if attempts := other.get("flaky"); len(attempts) != 1 {
+		t.Errorf("attempts of the other subscription = %v, want [1]", attempts)
+	}
+}
@@ -3,95 +3,83 @@ package pubsub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sync"
 	"time"
 
-	"cloud.google.com/go/pubsub"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/google/uuid"
+	"github.com/r3tr056/ecolens_api/platform/metrics"
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
 )
 
 type ResponseMessage struct {
-	Result    []byte
+	Result    interface{}
+	Error     string
 	MessageID string
+	// invalid is set when the result broke the contract of the method
+	invalid bool
 }
 
-type PubsubClient struct {
-	projectID            string
-	topicName            string
-	subscriptionName     string
-	callbacks            map[string]func([]byte) ([]byte, error)
-	responseQueue        chan *ResponseMessage
-	internalLock         sync.Mutex
-	callbackExecComplete chan struct{}
-	stopEvent            chan struct{}
-	message_counter      int
-	client               *pubsub.Client
-	topic                *pubsub.Topic
-	sub                  *pubsub.Subscription
-	sendMessageIDs       map[string]interface{}
+// pendingCall is a published request waiting for its response
+type pendingCall struct {
+	contract *contracts.Contract
+	version  int
+	response chan *ResponseMessage
 }
 
-func NewPubSubClient(projectID, topicName, subName string) (*PubsubClient, error) {
-	ctx := context.Background()
-
-	client, err := pubsub.NewClient(ctx, os.Getenv("GCS_PROJECT_ID"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Pub/Sub client : %v", err)
-	}
-
-	topic := client.Topic(topicName)
-	subscription := client.Subscription(subName)
-
-	exists, err := subscription.Exists(ctx)
-	if err != nil {
-		return nil, err
-	}
+type PubsubClient struct {
+	broker           Broker
+	consumer         *Consumer
+	topicName        string
+	subscriptionName string
+	internalLock     sync.Mutex
+	stopEvent        chan struct{}
+	cancel           context.CancelFunc
+	pending          map[string]*pendingCall
+	// peerVersions holds the schema versions the workers advertised per
+	// method. Until a worker has answered, requests use the oldest version.
+	peerVersions map[string][]int
+}
 
-	if !exists {
-		_, err = client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
-			Topic:       topic,
-			AckDeadline: 20 * time.Second,
-		})
-		if err != nil {
-			return nil, err
-		}
+// NewPubSubClient creates an RPC client publishing requests on topicName and
+// reading responses from subName. Responses that cannot be decoded are
+// dead-lettered and handed to recorder, which may be nil.
+func NewPubSubClient(broker Broker, topicName, subName string, recorder DeadLetterRecorder) (*PubsubClient, error) {
+	if broker == nil {
+		return nil, errors.New("no message broker configured")
 	}
-
-	if err != nil && status.Code(err) != codes.AlreadyExists {
-		return nil, fmt.Errorf("failed to create Pub/Sub subscription: %v", err)
+	if topicName == "" || subName == "" {
+		return nil, fmt.Errorf("topic and subscription names are required, got topic=%q subscription=%q", topicName, subName)
 	}
 
 	return &PubsubClient{
-		projectID:            projectID,
-		topicName:            topicName,
-		subscriptionName:     subName,
-		client:               client,
-		topic:                topic,
-		sub:                  subscription,
-		callbacks:            make(map[string]func([]byte) ([]byte, error)),
-		responseQueue:        make(chan *ResponseMessage),
-		internalLock:         sync.Mutex{},
-		callbackExecComplete: make(chan struct{}),
-		stopEvent:            make(chan struct{}),
-		message_counter:      0,
-		sendMessageIDs:       make(map[string]interface{}),
+		broker:           broker,
+		consumer:         NewConsumer(broker, DefaultRetryPolicy(), recorder),
+		topicName:        topicName,
+		subscriptionName: subName,
+		internalLock:     sync.Mutex{},
+		stopEvent:        make(chan struct{}),
+		pending:          make(map[string]*pendingCall),
+		peerVersions:     make(map[string][]int),
 	}, nil
 }
 
 func (c *PubsubClient) StartListening() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
 	go func() {
 		for {
 			select {
 			case <-c.stopEvent:
 				return
 			default:
-				_, err := c.ListenForMessages()
-				if err != nil {
+				err := c.ListenForMessages(ctx)
+				if err != nil && ctx.Err() == nil {
 					log.Printf("Error while listening for messages: %v\n", err)
+					time.Sleep(time.Second)
 				}
 			}
 		}
@@ -99,121 +87,206 @@ func (c *PubsubClient) StartListening() {
 }
 
 func (c *PubsubClient) StopListening() {
+	if c.cancel != nil {
+		c.cancel()
+	}
 	close(c.stopEvent)
 }
 
-func (c *PubsubClient) ListenForMessages() (interface{}, error) {
-	ctx := context.Background()
+// ListenForMessages receives responses from the subscription, validates them
+// against the method's contract and hands them to the callers waiting on the
+// matching message ID. It blocks until ctx is cancelled or the broker returns
+// an error.
+func (c *PubsubClient) ListenForMessages(ctx context.Context) error {
+	return c.consumer.Run(ctx, c.topicName, c.subscriptionName, func(ctx context.Context, msg *Message) error {
+		env, err := DecodeEnvelope(msg.Data)
+		if err != nil {
+			return err
+		}
 
-	var result interface{}
+		// requests published on the shared topic are not ours to answer
+		if !env.IsResponse() {
+			return nil
+		}
 
-	err := c.sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
 		c.internalLock.Lock()
-		defer c.internalLock.Unlock()
+		call, exists := c.pending[env.MessageID]
+		if exists && len(env.AcceptVersions) > 0 {
+			c.peerVersions[call.contract.Method] = env.AcceptVersions
+		}
+		c.internalLock.Unlock()
 
-		if msg.Data == nil {
-			log.Printf("Received an empty Pub/Sub message")
-			msg.Ack()
-			return
+		if !exists {
+			return nil
 		}
+		metrics.RPCReceived.WithLabelValues(call.contract.Method).Inc()
 
-		messageData := msg.Data
-		fmt.Printf("Received Message : %s\n", messageData)
-		var messageMap map[string]interface{}
-		if err := json.Unmarshal(messageData, &messageMap); err != nil {
-			log.Printf("Failed to decode JSON message: %v\n", err)
-		} else {
-			messageID := messageMap["message_id"].(string)
-			if _, exists := c.sendMessageIDs[messageID]; exists {
-				result = messageMap["result"]
-				c.sendMessageIDs[messageID] = result
+		// a response without a version answers in the version it was asked in
+		version := call.version
+		if env.SchemaVersion != 0 {
+			version = env.SchemaVersion
+		}
+
+		response := &ResponseMessage{MessageID: env.MessageID, Error: env.Error}
+		var invalid error
+		if env.Error == "" {
+			response.Result, invalid = call.contract.DecodeResult(env.Result, version)
+			if invalid != nil {
+				response.Error = invalid.Error()
+				response.invalid = true
 			}
 		}
 
-		msg.Ack()
+		select {
+		case call.response <- response:
+		default:
+		}
+
+		// the caller has been told, keep the bad payload for inspection
+		if invalid != nil {
+			return Permanent(invalid)
+		}
+		return nil
 	})
+}
+
+// negotiatedVersion returns the schema version requests for the contract are
+// sent with.
+func (c *PubsubClient) negotiatedVersion(contract *contracts.Contract) int {
+	c.internalLock.Lock()
+	peer, known := c.peerVersions[contract.Method]
+	c.internalLock.Unlock()
 
-	return result, err
+	if known {
+		if version, err := contract.Negotiate(peer); err == nil {
+			return version
+		}
+		log.Printf("No common schema version for %s with worker versions %v, using %d", contract.Method, peer, contract.Versions[0])
+	}
+
+	return contract.Versions[0]
 }
 
+// PublishMessage validates args against the method's contract and publishes
+// them with the negotiated schema version. args must be the latest argument
+// struct of the contract.
 func (c *PubsubClient) PublishMessage(methodName string, args interface{}) (string, error) {
-	c.internalLock.Lock()
-	defer c.internalLock.Unlock()
+	contract, err := contracts.Lookup(methodName)
+	if err != nil {
+		return "", err
+	}
+
+	version := c.negotiatedVersion(contract)
+	encodedArgs, err := contract.EncodeArgs(args, version)
+	if err != nil {
+		return "", err
+	}
 
-	messageID := fmt.Sprintf("msg_%d", c.message_counter)
-	messagePayload := map[string]interface{}{
-		"method":     methodName,
-		"args":       args,
-		"kwargs":     "",
-		"message_id": messageID,
+	messageID := fmt.Sprintf("msg_%s", uuid.NewString())
+	env := &Envelope{
+		MessageID: messageID,
+		Method:    methodName,
+		Args:      encodedArgs,
+	}
+	if version == contracts.LegacyVersion {
+		// legacy workers expect an empty kwargs string and no version fields
+		env.Kwargs = json.RawMessage(`""`)
+	} else {
+		env.SchemaVersion = version
+		env.AcceptVersions = contract.Versions
 	}
 
-	messageData, err := json.Marshal(messagePayload)
+	messageData, err := json.Marshal(env)
 	if err != nil {
 		return "", err
 	}
 
-	ctx := context.Background()
-	result := c.client.Topic(c.topicName).Publish(ctx, &pubsub.Message{
+	// register before publishing so a fast response is not dropped
+	c.internalLock.Lock()
+	c.pending[messageID] = &pendingCall{
+		contract: contract,
+		version:  version,
+		response: make(chan *ResponseMessage, 1),
+	}
+	c.internalLock.Unlock()
+
+	_, err = c.broker.Publish(context.Background(), c.topicName, &Message{
 		Data: messageData,
 	})
-
-	_, err = result.Get(ctx)
 	if err != nil {
+		c.forget(messageID)
+		metrics.RPCFailed.WithLabelValues(contract.Method, metrics.RPCFailedPublish).Inc()
 		return "", err
 	}
-
-	c.message_counter++
+	metrics.RPCPublished.WithLabelValues(contract.Method).Inc()
 
 	return messageID, nil
 }
 
-func (rpc *PubsubClient) Close() {
-	rpc.client.Close()
-}
+func (c *PubsubClient) forget(messageID string) {
+	c.internalLock.Lock()
+	defer c.internalLock.Unlock()
 
-func (c *PubsubClient) RemoteMethod(methodName string, callback func([]byte) ([]byte, error)) func() ([]byte, error) {
-	c.callbacks[methodName] = callback
+	delete(c.pending, messageID)
+}
 
-	return func() ([]byte, error) {
-		c.internalLock.Lock()
-		defer c.internalLock.Unlock()
+func (c *PubsubClient) Close() {
+	if err := c.broker.Close(); err != nil {
+		log.Printf("Failed to close message broker: %v", err)
+	}
+}
 
-		messageID, err := c.PublishMessage(methodName, nil)
+// RemoteMethod returns a function that calls methodName on the remote worker
+// and waits up to timeout for its result.
+func (c *PubsubClient) RemoteMethod(methodName string, timeout time.Duration) func(args interface{}) (interface{}, error) {
+	return func(args interface{}) (interface{}, error) {
+		messageID, err := c.PublishMessage(methodName, args)
 		if err != nil {
 			return nil, err
 		}
 
-		<-c.callbackExecComplete
-
-		responseMessage := <-c.responseQueue
-		if responseMessage != nil && responseMessage.MessageID == messageID {
-			return responseMessage.Result, nil
-		}
-
-		log.Printf("Timeout waiting for response for message_id : %s\n", messageID)
-		return nil, nil
+		return c.WaitForResponse(messageID, timeout, true)
 	}
 }
 
 func (c *PubsubClient) WaitForResponse(messageID string, timeout time.Duration, deleteAfterUse bool) (interface{}, error) {
 	c.internalLock.Lock()
-	defer c.internalLock.Unlock()
+	call, exists := c.pending[messageID]
+	c.internalLock.Unlock()
 
-	if result, exists := c.sendMessageIDs[messageID]; exists {
-		if deleteAfterUse {
-			delete(c.sendMessageIDs, messageID)
-		}
-		return result, nil
+	if !exists {
+		return nil, fmt.Errorf("unknown message_id: %s", messageID)
+	}
+
+	if deleteAfterUse {
+		defer c.forget(messageID)
 	}
 
-	// if not found, setup a timer channel for the timeout
-	timer := time.After(timeout)
+	method := call.contract.Method
+	inFlight := metrics.RPCInFlight.WithLabelValues(method)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	// wait for the response, the timeout or the client shutting down
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	select {
-	case <-timer:
+	case response := <-call.response:
+		if response.Error != "" {
+			reason := metrics.RPCFailedRemote
+			if response.invalid {
+				reason = metrics.RPCFailedInvalid
+			}
+			metrics.RPCFailed.WithLabelValues(method, reason).Inc()
+			return nil, fmt.Errorf("remote method failed for message_id %s: %s", messageID, response.Error)
+		}
+		return response.Result, nil
+	case <-timer.C:
+		metrics.RPCFailed.WithLabelValues(method, metrics.RPCFailedTimeout).Inc()
 		return nil, fmt.Errorf("timeout waiting for result for message_id: %s", messageID)
 	case <-c.stopEvent:
+		metrics.RPCFailed.WithLabelValues(method, metrics.RPCFailedStopped).Inc()
 		return nil, fmt.Errorf("RPC client stopped listening for messages")
 	}
 }
@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/platform/pubsub/contracts"
+)
+
+// worker answers the requests published on topic with answer.
+func worker(ctx context.Context, t *testing.T, b *MemoryBroker, topic string, answer func(request *Envelope) *Envelope) {
+	go b.Subscribe(ctx, topic, "worker", func(ctx context.Context, msg *Message) {
+		msg.Ack()
+		request, err := DecodeEnvelope(msg.Data)
+		if err != nil || request.IsResponse() {
+			return
+		}
+
+		data, err := json.Marshal(answer(request))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := b.Publish(ctx, topic, &Message{Data: data}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestLegacyWorker checks a worker speaking the version 1 protocol, with
+// neither schema versions nor typed results, is sent version 1 requests
+// and its unversioned responses are decoded, until it advertises a newer
+// version.
+func TestLegacyWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "rpc"
+	b := NewMemoryBroker()
+	// the subscriptions get the messages published once they exist
+	b.queue(topic, "worker")
+	b.queue(topic, "api")
+
+	var requests []*Envelope
+	worker(ctx, t, b, topic, func(request *Envelope) *Envelope {
+		requests = append(requests, request)
+		if len(requests) == 1 {
+			return &Envelope{MessageID: request.MessageID, Result: json.RawMessage(`{"score":"B"}`)}
+		}
+		return &Envelope{
+			MessageID:      request.MessageID,
+			SchemaVersion:  2,
+			AcceptVersions: []int{1, 2},
+			Result:         json.RawMessage(`{"product_id":42,"eco_score":71.5}`),
+		}
+	})
+
+	client, err := NewPubSubClient(b, topic, "api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.StartListening()
+	defer client.StopListening()
+
+	analyze := client.RemoteMethod(contracts.MethodProductAnalysis, 5*time.Second)
+	args := &contracts.ProductAnalysisArgs{ProductID: 42, ProductType: "product"}
+
+	result, err := analyze(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := result.(json.RawMessage); !ok || string(raw) != `{"score":"B"}` {
+		t.Errorf("legacy result = %#v, want it untouched", result)
+	}
+	legacy := requests[0]
+	if legacy.SchemaVersion != 0 || legacy.AcceptVersions != nil || string(legacy.Args) != `42` || string(legacy.Kwargs) != `""` {
+		t.Errorf("legacy request = %+v, want the version 1 envelope", legacy)
+	}
+
+	// the second worker answers advertise version 2, the next request uses it
+	if _, err := analyze(args); err != nil {
+		t.Fatal(err)
+	}
+	result, err = analyze(args)
+	want := &contracts.ProductAnalysisResult{ProductID: 42, EcoScore: 71.5}
+	if err != nil || !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %#v, %v, want %#v", result, err, want)
+	}
+	if request := requests[2]; request.SchemaVersion != 2 || string(request.Args) != `{"product_id":42,"product_type":"product"}` {
+		t.Errorf("request = %+v, want the version 2 envelope", request)
+	}
+}
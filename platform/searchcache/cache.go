@@ -0,0 +1,209 @@
+// Package searchcache caches search results in Redis. Keys are namespaced
+// by what was searched and carry the generation of their namespace, writes
+// to the catalogue bump the generation so later searches miss the entries
+// cached before the write.
+package searchcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// Namespaces of the cached searches
+const (
+	Products            = "products"
+	MarketplaceProducts = "marketplace_products"
+	Reports             = "reports"
+)
+
+const (
+	// keyVersion changes when the layout of cached values does, so entries
+	// of older releases are never read
+	keyVersion = "v1"
+	// maxTTL bounds how long an entry is served, fresh or stale
+	maxTTL = time.Hour
+	// refreshTimeout bounds a background refresh of a stale entry
+	refreshTimeout = 10 * time.Second
+)
+
+type Options struct {
+	// TTL is how long an entry is fresh
+	TTL time.Duration
+	// StaleTTL is how long an entry is still served after it turned stale,
+	// while it is refreshed in the background
+	StaleTTL time.Duration
+}
+
+// Stats counts the lookups of a cache since it was created.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	StaleHits uint64 `json:"stale_hits"`
+	Misses    uint64 `json:"misses"`
+	// Errors are the Redis failures, the searches still ran uncached
+	Errors uint64 `json:"errors"`
+}
+
+type Cache struct {
+	redis *redis.Client
+	opts  Options
+	group singleflight.Group
+
+	hits, staleHits, misses, errors uint64
+}
+
+// New returns a Cache. Without a Redis client nothing is cached and every
+// lookup loads.
+func New(redisClient *redis.Client, opts Options) *Cache {
+	if opts.TTL > maxTTL {
+		opts.TTL = maxTTL
+	}
+	if opts.TTL+opts.StaleTTL > maxTTL {
+		opts.StaleTTL = maxTTL - opts.TTL
+	}
+	return &Cache{redis: redisClient, opts: opts}
+}
+
+type entry struct {
+	StoredAt time.Time       `json:"t"`
+	Value    json.RawMessage `json:"v"`
+}
+
+func generationKey(namespace string) string {
+	return "search_cache:gen:" + namespace
+}
+
+func entryKey(namespace string, generation int64, params string) string {
+	sum := sha256.Sum256([]byte(params))
+	return fmt.Sprintf("search_cache:%s:%s:%d:%s", keyVersion, namespace, generation, hex.EncodeToString(sum[:]))
+}
+
+// Fetch unmarshals the cached result of the search described by params
+// into dst. On a miss, load runs once however many callers miss at the same
+// time and its result is cached. A stale entry is served while load
+// refreshes it in the background.
+func (c *Cache) Fetch(ctx context.Context, namespace, params string, dst interface{}, load func(context.Context) (interface{}, error)) error {
+	if c.redis == nil {
+		return c.loadInto(ctx, dst, load)
+	}
+
+	generation, err := c.redis.Get(ctx, generationKey(namespace)).Int64()
+	if err != nil && err != redis.Nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.Printf("Failed to read the %s search cache generation: %v", namespace, err)
+		return c.loadInto(ctx, dst, load)
+	}
+	key := entryKey(namespace, generation, params)
+
+	data, err := c.redis.Get(ctx, key).Bytes()
+	if err != nil && err != redis.Nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.Printf("Failed to read the %s search cache: %v", namespace, err)
+	}
+	if err == nil {
+		cached := entry{}
+		if json.Unmarshal(data, &cached) == nil && json.Unmarshal(cached.Value, dst) == nil {
+			if time.Since(cached.StoredAt) < c.opts.TTL {
+				atomic.AddUint64(&c.hits, 1)
+			} else {
+				atomic.AddUint64(&c.staleHits, 1)
+				go c.refresh(key, load)
+			}
+			return nil
+		}
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	value, err, _ := c.group.Do(key, func() (interface{}, error) {
+		return c.fill(ctx, key, load)
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(value.([]byte), dst)
+}
+
+// refresh reloads a stale entry. The lock keeps the replicas from all
+// refreshing the same entry.
+func (c *Cache) refresh(key string, load func(context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	locked, err := c.redis.SetNX(ctx, key+":refresh", 1, refreshTimeout).Result()
+	if err != nil || !locked {
+		return
+	}
+
+	if _, err, _ := c.group.Do(key, func() (interface{}, error) {
+		return c.fill(ctx, key, load)
+	}); err != nil {
+		log.Printf("Failed to refresh a stale search cache entry: %v", err)
+	}
+}
+
+// fill loads a value and caches it under key, returning its JSON.
+func (c *Cache) fill(ctx context.Context, key string, load func(context.Context) (interface{}, error)) ([]byte, error) {
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := json.Marshal(entry{StoredAt: time.Now(), Value: data})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.redis.Set(ctx, key, cached, c.opts.TTL+c.opts.StaleTTL).Err(); err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.Printf("Failed to write the search cache: %v", err)
+	}
+	return data, nil
+}
+
+func (c *Cache) loadInto(ctx context.Context, dst interface{}, load func(context.Context) (interface{}, error)) error {
+	value, err := load(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// Invalidate bumps the generation of the namespaces, so the searches that
+// follow miss every entry cached before. The stale entries expire on their
+// own.
+func (c *Cache) Invalidate(ctx context.Context, namespaces ...string) error {
+	if c.redis == nil {
+		return nil
+	}
+
+	pipe := c.redis.TxPipeline()
+	for _, namespace := range namespaces {
+		pipe.Incr(ctx, generationKey(namespace))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		StaleHits: atomic.LoadUint64(&c.staleHits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Errors:    atomic.LoadUint64(&c.errors),
+	}
+}
@@ -0,0 +1,36 @@
+// Package semantic embeds products and reports and the search terms run
+// against them, so searches also find what is close in meaning.
+package semantic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close the texts are in meaning.
+type Embedder interface {
+	// Model names the embedder and its dimensions, vectors of different
+	// models are never compared
+	Model() string
+	Dimensions() int
+	// Embed returns the vectors of texts, in their order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder returns the remote embedder at url, which needs the
+// dimensions of its model. It returns nil when url is empty, semantic
+// search is then disabled.
+func NewEmbedder(url, apiKey, model string, dimensions int) (Embedder, error) {
+	if url == "" {
+		return nil, nil
+	}
+	if dimensions < 0 {
+		return nil, fmt.Errorf("embedding dimensions must be positive, got %d", dimensions)
+	}
+	if dimensions == 0 {
+		return nil, errors.New("the dimensions of the remote embedder must be set")
+	}
+	return NewRemoteEmbedder(url, apiKey, model, dimensions), nil
+}
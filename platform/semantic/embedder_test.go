@@ -0,0 +1,72 @@
+package semantic
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	embedder, err := NewEmbedder("", "", "", 0)
+	if embedder != nil || err != nil {
+		t.Errorf("NewEmbedder without URL = %v, %v, want semantic search disabled", embedder, err)
+	}
+
+	if _, err := NewEmbedder("https://embeddings.example.com/v1/embeddings", "", "small", 0); err == nil {
+		t.Error("NewEmbedder without dimensions succeeded")
+	}
+
+	embedder, err = NewEmbedder("https://embeddings.example.com/v1/embeddings", "", "small", 384)
+	if err != nil || embedder.Dimensions() != 384 {
+		t.Errorf("NewEmbedder = %v, %v, want the remote embedder", embedder, err)
+	}
+}
+
+// failingEmbedder stands in for an embeddings service that is down
+type failingEmbedder struct{ *hashingEmbedder }
+
+func (failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("unavailable")
+}
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestQuery(t *testing.T) {
+	embedder := newHashingEmbedder(64)
+	s := NewService(nil, embedder, 0.3)
+	parse := func(raw string) *query.Query {
+		q, err := query.Parse(raw, query.Options{Fields: []string{"brand"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+
+	semantic := s.Query(context.Background(), parse("bamboo wraps -plastic"))
+	if semantic == nil || semantic.Model != "hashing-64" || semantic.MinSimilarity != 0.3 {
+		t.Fatalf("Query = %+v, want the vector of the words", semantic)
+	}
+	vectors, _ := embedder.Embed(context.Background(), []string{"bamboo wrap", "steel bottle"})
+	close, far := cosine(semantic.Vector, vectors[0]), cosine(semantic.Vector, vectors[1])
+	if math.IsNaN(close) || close <= far {
+		t.Errorf("similarity to a close text = %f, to a far one %f", close, far)
+	}
+
+	if semantic := s.Query(context.Background(), parse("brand:acme")); semantic != nil {
+		t.Errorf("Query of filters = %+v, want nil", semantic)
+	}
+
+	s = NewService(nil, failingEmbedder{embedder}, 0.3)
+	if semantic := s.Query(context.Background(), parse("bamboo")); semantic != nil {
+		t.Errorf("Query with the embedder down = %+v, want nil", semantic)
+	}
+}
@@ -0,0 +1,81 @@
+package semantic
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+)
+
+// trigramWeight is the weight of the character trigrams of a word relative
+// to the word itself
+const trigramWeight = 0.5
+
+// hashingEmbedder embeds texts locally by feature hashing their words and
+// the character trigrams of their words, so "wrap" and "wraps" are close.
+// It is deterministic and needs no service, which suits tests, but only
+// captures shared vocabulary, not meaning.
+type hashingEmbedder struct {
+	dimensions int
+}
+
+func newHashingEmbedder(dimensions int) *hashingEmbedder {
+	return &hashingEmbedder{dimensions: dimensions}
+}
+
+func (e *hashingEmbedder) Model() string {
+	return fmt.Sprintf("hashing-%d", e.dimensions)
+}
+
+func (e *hashingEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *hashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *hashingEmbedder) embed(text string) []float32 {
+	vector := make([]float64, e.dimensions)
+	for _, word := range query.Normalize(text) {
+		e.add(vector, "w:"+word, 1)
+
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			e.add(vector, "t:"+string(runes[i:i+3]), trigramWeight)
+		}
+	}
+
+	var norm float64
+	for _, x := range vector {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float32, e.dimensions)
+	for i, x := range vector {
+		if norm > 0 {
+			out[i] = float32(x / norm)
+		}
+	}
+	return out
+}
+
+// add hashes feature to a dimension and a sign, so collisions cancel out
+// rather than pile up.
+func (e *hashingEmbedder) add(vector []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	if sum&1 == 1 {
+		weight = -weight
+	}
+	vector[(sum>>1)%uint64(e.dimensions)] += weight
+}
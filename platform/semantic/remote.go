@@ -0,0 +1,100 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RemoteEmbedder embeds texts with a service speaking the OpenAI
+// embeddings API: it POSTs {"model", "input"} and reads data[].embedding.
+type RemoteEmbedder struct {
+	url        string
+	apiKey     string
+	model      string
+	dimensions int
+	client     *http.Client
+}
+
+func NewRemoteEmbedder(url, apiKey, model string, dimensions int) *RemoteEmbedder {
+	return &RemoteEmbedder{
+		url:        url,
+		apiKey:     apiKey,
+		model:      model,
+		dimensions: dimensions,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (e *RemoteEmbedder) Model() string {
+	return fmt.Sprintf("%s-%d", e.model, e.dimensions)
+}
+
+func (e *RemoteEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+type embeddingsRequest struct {
+	Model      string   `json:"model,omitempty"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *RemoteEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: e.model, Input: texts, Dimensions: e.dimensions})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings service answered %s", resp.Status)
+	}
+
+	result := embeddingsResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings service answered an unknown index %d", item.Index)
+		}
+		if len(item.Embedding) != e.dimensions {
+			return nil, fmt.Errorf("embeddings service answered %d dimensions, want %d", len(item.Embedding), e.dimensions)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("embeddings service answered no vector for input %d", i)
+		}
+	}
+
+	return vectors, nil
+}
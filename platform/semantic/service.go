@@ -0,0 +1,148 @@
+package semantic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+const (
+	syncInterval = time.Minute
+	batchSize    = 64
+	// queryTimeout bounds embedding a search term, searches fall back to
+	// keywords rather than wait
+	queryTimeout = time.Second
+)
+
+// Service keeps the embeddings of products and reports up to date and
+// embeds search terms.
+type Service struct {
+	db            *gorm.DB
+	embedder      Embedder
+	minSimilarity float64
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// NewService returns a Service. Neighbours less similar to a search term
+// than minSimilarity are left out of searches.
+func NewService(db *gorm.DB, embedder Embedder, minSimilarity float64) *Service {
+	return &Service{
+		db:            db,
+		embedder:      embedder,
+		minSimilarity: minSimilarity,
+		done:          make(chan struct{}),
+	}
+}
+
+// Start creates the ANN index of the embedder's model and embeds new and
+// changed products and reports every minute.
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		defer close(s.done)
+
+		if err := models.EnsureEmbeddingIndex(ctx, s.db, s.embedder.Model(), s.embedder.Dimensions()); err != nil {
+			log.Printf("Failed to create the embedding index of %s: %v", s.embedder.Model(), err)
+		}
+
+		for {
+			if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to sync the embeddings: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(syncInterval):
+			}
+		}
+	}()
+}
+
+func (s *Service) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// Sync drops the embeddings of deleted rows and embeds the new and changed
+// products and reports.
+func (s *Service) Sync(ctx context.Context) error {
+	if err := models.PurgeEmbeddings(ctx, s.db, s.embedder.Model()); err != nil {
+		return fmt.Errorf("failed to purge embeddings: %w", err)
+	}
+	for _, entityType := range []string{models.EmbeddingProduct, models.EmbeddingReport} {
+		if err := s.sync(ctx, entityType); err != nil {
+			return fmt.Errorf("failed to embed %ss: %w", entityType, err)
+		}
+	}
+	return nil
+}
+
+// sync embeds the rows of an entity without a current embedding, a batch
+// at a time.
+func (s *Service) sync(ctx context.Context, entityType string) error {
+	for {
+		sources, err := models.StaleEmbeddingSources(ctx, s.db, entityType, s.embedder.Model(), batchSize)
+		if err != nil || len(sources) == 0 {
+			return err
+		}
+
+		texts := make([]string, len(sources))
+		for i, source := range sources {
+			texts[i] = source.Content
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+
+		if err := models.SaveEmbeddings(ctx, s.db, entityType, s.embedder.Model(), sources, vectors); err != nil {
+			return err
+		}
+	}
+}
+
+// Query embeds the words of q. It returns nil, and the search runs on
+// keywords only, when q has no words or embedding them fails.
+func (s *Service) Query(ctx context.Context, q *query.Query) *models.SemanticQuery {
+	if q == nil {
+		return nil
+	}
+	words := q.Words()
+	if len(words) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	vectors, err := s.embedder.Embed(ctx, []string{strings.Join(words, " ")})
+	if err != nil {
+		log.Printf("Failed to embed the search term %q: %v", q.Raw, err)
+		return nil
+	}
+
+	return &models.SemanticQuery{
+		Model:         s.embedder.Model(),
+		Vector:        vectors[0],
+		MinSimilarity: s.minSimilarity,
+	}
+}
+
+// Model names the embedder, searches fused with its vectors are cached
+// apart from keyword searches.
+func (s *Service) Model() string {
+	return s.embedder.Model()
+}
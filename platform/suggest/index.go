@@ -0,0 +1,225 @@
+// Package suggest serves search box completions from a Redis prefix index,
+// falling back to prefix and trigram queries against the catalogue, and
+// keeps the index in step with product changes.
+package suggest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+const (
+	keyPrefix  = "suggest:prefix:"
+	keyEntries = "suggest:entries"
+	keyBuilt   = "suggest:built"
+
+	// prefixes shorter or longer than these are not indexed
+	minPrefix = 2
+	maxPrefix = 16
+
+	rebuildBatch = 1000
+)
+
+// Index keeps, for every prefix of every word sequence of a suggestion, a
+// sorted set of the suggestions scored by popularity, so a completion is a
+// single ZREVRANGE.
+type Index struct {
+	redis *redis.Client
+}
+
+func NewIndex(redisClient *redis.Client) *Index {
+	return &Index{redis: redisClient}
+}
+
+func member(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// Key normalizes term into the prefix it is looked up under.
+func Key(term string) string {
+	key := []rune(strings.Join(query.Normalize(term), " "))
+	if len(key) > maxPrefix {
+		key = key[:maxPrefix]
+	}
+	return string(key)
+}
+
+// prefixes returns the indexed prefixes of text: those of the whole text
+// and of the text starting at each later word.
+func prefixes(text string) []string {
+	words := query.Normalize(text)
+	seen := map[string]bool{}
+	var result []string
+
+	for i := range words {
+		phrase := []rune(strings.Join(words[i:], " "))
+		for n := minPrefix; n <= len(phrase) && n <= maxPrefix; n++ {
+			prefix := string(phrase[:n])
+			if !seen[prefix] {
+				seen[prefix] = true
+				result = append(result, prefix)
+			}
+		}
+	}
+
+	return result
+}
+
+// Put adds or replaces a suggestion.
+func (i *Index) Put(ctx context.Context, s models.Suggestion) error {
+	key := member(s.Type, s.ID)
+	old, err := i.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if old != nil {
+			for _, prefix := range prefixes(old.Text) {
+				pipe.ZRem(ctx, keyPrefix+prefix, key)
+			}
+		}
+		for _, prefix := range prefixes(s.Text) {
+			pipe.ZAdd(ctx, keyPrefix+prefix, &redis.Z{Score: s.Popularity, Member: key})
+		}
+		pipe.HSet(ctx, keyEntries, key, data)
+		return nil
+	})
+	return err
+}
+
+// Remove drops a suggestion from the index.
+func (i *Index) Remove(ctx context.Context, kind string, id uint) error {
+	key := member(kind, id)
+	old, err := i.get(ctx, key)
+	if err != nil || old == nil {
+		return err
+	}
+
+	_, err = i.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, prefix := range prefixes(old.Text) {
+			pipe.ZRem(ctx, keyPrefix+prefix, key)
+		}
+		pipe.HDel(ctx, keyEntries, key)
+		return nil
+	})
+	return err
+}
+
+func (i *Index) get(ctx context.Context, key string) (*models.Suggestion, error) {
+	data, err := i.redis.HGet(ctx, keyEntries, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &models.Suggestion{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// Lookup returns the most popular suggestions completing term.
+func (i *Index) Lookup(ctx context.Context, term string, limit int) ([]models.Suggestion, error) {
+	suggestions := []models.Suggestion{}
+
+	key := Key(term)
+	if len([]rune(key)) < minPrefix {
+		return suggestions, nil
+	}
+
+	keys, err := i.redis.ZRevRange(ctx, keyPrefix+key, 0, int64(limit-1)).Result()
+	if err != nil || len(keys) == 0 {
+		return suggestions, err
+	}
+
+	values, err := i.redis.HMGet(ctx, keyEntries, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var s models.Suggestion
+		if err := json.Unmarshal([]byte(data), &s); err == nil {
+			suggestions = append(suggestions, s)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// Built reports whether the index was fully built once.
+func (i *Index) Built(ctx context.Context) (bool, error) {
+	n, err := i.redis.Exists(ctx, keyBuilt).Result()
+	return n > 0, err
+}
+
+// Rebuild drops the index and indexes the whole catalogue again.
+func (i *Index) Rebuild(ctx context.Context, db *gorm.DB) (int, error) {
+	if err := i.clear(ctx); err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, kind := range models.SuggestionTypes {
+		var after uint
+		for {
+			batch, err := models.SuggestionsAfter(db.WithContext(ctx), kind, after, rebuildBatch)
+			if err != nil {
+				return indexed, err
+			}
+			for _, s := range batch {
+				if err := i.Put(ctx, s); err != nil {
+					return indexed, err
+				}
+				after = s.ID
+			}
+			indexed += len(batch)
+			if len(batch) < rebuildBatch {
+				break
+			}
+		}
+	}
+
+	return indexed, i.redis.Set(ctx, keyBuilt, indexed, 0).Err()
+}
+
+func (i *Index) clear(ctx context.Context) error {
+	iter := i.redis.Scan(ctx, 0, "suggest:*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 500 {
+			if err := i.redis.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return i.redis.Del(ctx, keys...).Err()
+	}
+	return nil
+}
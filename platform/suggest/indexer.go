@@ -0,0 +1,144 @@
+package suggest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/outbox"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+	"gorm.io/gorm"
+)
+
+type Options struct {
+	// Topic and Subscription the product events are consumed from
+	Topic        string
+	Subscription string
+}
+
+// Indexer refreshes the suggestions of products, and of their brand and
+// category, when product events arrive.
+type Indexer struct {
+	db       *gorm.DB
+	index    *Index
+	consumer *pubsub.Consumer
+	opts     Options
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewIndexer(db *gorm.DB, redisClient *redis.Client, broker pubsub.Broker, recorder pubsub.DeadLetterRecorder, opts Options) *Indexer {
+	i := &Indexer{
+		db:       db,
+		consumer: pubsub.NewConsumer(broker, pubsub.DefaultRetryPolicy(), recorder),
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+	if redisClient != nil {
+		i.index = NewIndex(redisClient)
+	}
+	return i
+}
+
+// Start builds the index if it was never built and consumes product events.
+func (i *Indexer) Start() {
+	if i.index == nil {
+		log.Printf("Suggestion index disabled, no Redis client")
+		close(i.done)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+
+	go func() {
+		built, err := i.index.Built(ctx)
+		if err != nil || built {
+			return
+		}
+		indexed, err := i.index.Rebuild(ctx, i.db)
+		if err != nil {
+			log.Printf("Failed to build the suggestion index: %v", err)
+			return
+		}
+		log.Printf("Built the suggestion index with %d entries", indexed)
+	}()
+
+	go func() {
+		defer close(i.done)
+
+		for ctx.Err() == nil {
+			if err := i.consumer.Run(ctx, i.opts.Topic, i.opts.Subscription, i.refresh); err != nil && ctx.Err() == nil {
+				log.Printf("Suggestion indexer stopped consuming events: %v", err)
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
+
+func (i *Indexer) Stop() {
+	if i.cancel == nil {
+		return
+	}
+	i.cancel()
+	<-i.done
+}
+
+func (i *Indexer) refresh(ctx context.Context, msg *pubsub.Message) error {
+	if msg.Attributes[outbox.AttrAggregateType] != models.AggregateProduct {
+		return nil
+	}
+
+	var event models.ProductEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return pubsub.Permanent(fmt.Errorf("invalid product event: %v", err))
+	}
+
+	return i.Refresh(ctx, event.ProductID)
+}
+
+// Refresh reindexes a product and the brand and category it belongs to,
+// whose popularity changes with it.
+func (i *Indexer) Refresh(ctx context.Context, productID uint) error {
+	db := i.db.WithContext(ctx)
+
+	var product models.Product
+	err := db.Unscoped().Select("id", "brand_id", "category_id").First(&product, productID).Error
+	if err == gorm.ErrRecordNotFound {
+		return i.index.Remove(ctx, models.SuggestionProduct, productID)
+	}
+	if err != nil {
+		return err
+	}
+
+	refs := map[string]uint{
+		models.SuggestionProduct:  product.ID,
+		models.SuggestionBrand:    product.BrandID,
+		models.SuggestionCategory: product.CategoryID,
+	}
+	for kind, id := range refs {
+		if id == 0 {
+			continue
+		}
+
+		suggestions, err := models.SuggestionsByID(db, kind, []uint{id})
+		if err != nil {
+			return err
+		}
+		if len(suggestions) == 0 {
+			if err := i.index.Remove(ctx, kind, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := i.index.Put(ctx, suggestions[0]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package suggest
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+// fuzzyMinLength is the shortest input the trigram fallback runs for, below
+// it there are too few trigrams to be meaningful
+const fuzzyMinLength = 3
+
+// Service completes search box input.
+type Service struct {
+	db    *gorm.DB
+	index *Index
+}
+
+// NewService returns a Service. Without a Redis client every completion
+// is served from the catalogue queries.
+func NewService(db *gorm.DB, redisClient *redis.Client) *Service {
+	s := &Service{db: db}
+	if redisClient != nil {
+		s.index = NewIndex(redisClient)
+	}
+	return s
+}
+
+// Suggest returns up to limit completions of term, best first. Completions
+// come from the prefix index and, when it has too few, from prefix and
+// trigram matches in the catalogue.
+func (s *Service) Suggest(ctx context.Context, term string, limit int) ([]models.MatchResult, error) {
+	words := query.Normalize(term)
+	if len(words) == 0 {
+		return []models.MatchResult{}, nil
+	}
+
+	var candidates []models.Suggestion
+	if s.index != nil {
+		indexed, err := s.index.Lookup(ctx, term, limit*3)
+		if err != nil {
+			log.Printf("Suggestion index lookup failed: %v", err)
+		}
+		candidates = indexed
+	}
+
+	if len(candidates) < limit && len([]rune(Key(term))) >= fuzzyMinLength {
+		found, err := models.SuggestFromCatalogue(ctx, s.db, term, limit*2)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, found...)
+	}
+
+	return rank(candidates, words, limit), nil
+}
+
+// WithRecent puts the recent searches matching term before the
+// completions, leaving out completions that repeat them, and returns at
+// most limit results.
+func WithRecent(completions []models.MatchResult, recent []models.RecentSearch, term string, limit int) []models.MatchResult {
+	words := query.Normalize(term)
+	seen := map[string]bool{}
+	results := []models.MatchResult{}
+
+	for _, search := range recent {
+		key := strings.Join(query.Normalize(search.Query), " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		results = append(results, models.MatchResult{
+			Content:    search.Query,
+			Type:       models.SuggestionRecent,
+			ID:         search.ID,
+			Highlights: query.Highlight(search.Query, words),
+		})
+	}
+
+	for _, completion := range completions {
+		if !seen[strings.Join(query.Normalize(completion.Content), " ")] {
+			results = append(results, completion)
+		}
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i].Rank = i
+	}
+	return results
+}
+
+// rank dedupes the candidates and orders them by match quality, then by
+// popularity.
+func rank(candidates []models.Suggestion, words []string, limit int) []models.MatchResult {
+	typed := strings.Join(words, " ")
+	seen := map[string]bool{}
+	results := []models.MatchResult{}
+
+	for _, c := range candidates {
+		key := member(c.Type, c.ID)
+		if seen[key] || c.Text == "" {
+			continue
+		}
+		seen[key] = true
+
+		highlights := query.Highlight(c.Text, words)
+
+		var quality float64
+		switch {
+		case strings.HasPrefix(strings.Join(query.Normalize(c.Text), " "), typed):
+			quality = 1
+		case len(highlights) >= len(words):
+			quality = 0.8
+		default:
+			quality = 0.6 * c.Similarity
+		}
+
+		results = append(results, models.MatchResult{
+			Content:    c.Text,
+			Type:       c.Type,
+			ID:         c.ID,
+			Score:      quality + 0.1*math.Log1p(c.Popularity),
+			Highlights: highlights,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i].Rank = i
+	}
+
+	return results
+}
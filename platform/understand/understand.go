@@ -0,0 +1,192 @@
+// Package understand rewrites search queries before they run: it expands
+// the synonyms admins manage and corrects misspelt words against the
+// vocabulary of the catalogue.
+package understand
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/pkg/search/query"
+	"gorm.io/gorm"
+)
+
+const (
+	// synonymsTTL bounds how long other replicas serve edited synonyms
+	synonymsTTL        = time.Minute
+	vocabularyInterval = time.Hour
+	// similar words fetched per misspelt word
+	spellCandidates = 5
+	minSpellLength  = 3
+)
+
+type Service struct {
+	db *gorm.DB
+
+	mu       sync.RWMutex
+	synonyms map[string][]string
+	loadedAt time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, done: make(chan struct{})}
+}
+
+// Start refreshes the vocabulary now and then every hour.
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		defer close(s.done)
+
+		for {
+			if err := models.RefreshVocabulary(ctx, s.db); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to refresh the search vocabulary: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(vocabularyInterval):
+			}
+		}
+	}()
+}
+
+func (s *Service) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// InvalidateSynonyms makes the next query reload the synonyms.
+func (s *Service) InvalidateSynonyms() {
+	s.mu.Lock()
+	s.synonyms = nil
+	s.mu.Unlock()
+}
+
+func (s *Service) loadSynonyms(ctx context.Context) (map[string][]string, error) {
+	s.mu.RLock()
+	synonyms, loadedAt := s.synonyms, s.loadedAt
+	s.mu.RUnlock()
+	if synonyms != nil && time.Since(loadedAt) < synonymsTTL {
+		return synonyms, nil
+	}
+
+	synonyms, err := models.LoadSynonyms(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.synonyms, s.loadedAt = synonyms, time.Now()
+	s.mu.Unlock()
+	return synonyms, nil
+}
+
+// Expand returns q with the synonyms of its terms added. Without synonyms,
+// for instance when they fail to load, q is returned unchanged.
+func (s *Service) Expand(ctx context.Context, q *query.Query) *query.Query {
+	synonyms, err := s.loadSynonyms(ctx)
+	if err != nil {
+		log.Printf("Failed to load search synonyms: %v", err)
+		return q
+	}
+	if len(synonyms) == 0 {
+		return q
+	}
+	return q.Expand(synonyms)
+}
+
+// Correct returns q with its misspelt words replaced by the closest
+// vocabulary words and split compounds joined. The second result is false
+// when there was nothing to correct.
+func (s *Service) Correct(ctx context.Context, q *query.Query) (*query.Query, bool, error) {
+	words := q.SpellableWords()
+	if len(words) == 0 {
+		return q, false, nil
+	}
+
+	lookup := append([]string{}, words...)
+	for i := 0; i+1 < len(words); i++ {
+		lookup = append(lookup, words[i]+words[i+1])
+	}
+
+	known, err := models.KnownWords(ctx, s.db, lookup)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fixes := map[string]string{}
+	for _, word := range words {
+		if known[word] || len([]rune(word)) < minSpellLength {
+			continue
+		}
+
+		similar, err := models.SimilarWords(ctx, s.db, word, spellCandidates)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, candidate := range similar {
+			if distance(word, candidate) <= maxEdits(word) {
+				fixes[word] = candidate
+				break
+			}
+		}
+	}
+
+	corrected, changed := q.Correct(known, fixes)
+	return corrected, changed, nil
+}
+
+// maxEdits is the largest edit distance a correction of word may have.
+func maxEdits(word string) int {
+	if len([]rune(word)) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,376 @@
+// Package webhook delivers product events to the HTTPS endpoints partners
+// registered for them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+	"github.com/r3tr056/ecolens_api/platform/outbox"
+	"github.com/r3tr056/ecolens_api/platform/pubsub"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// partnerEvents maps outbox domain events to the events partners subscribe to
+var partnerEvents = map[string]string{
+	models.EventProductCreated: models.WebhookEventProductUpdated,
+	models.EventProductUpdated: models.WebhookEventProductUpdated,
+	models.EventEPDChanged:     models.WebhookEventEPDPublished,
+	models.EventScoreChanged:   models.WebhookEventScoreChanged,
+}
+
+type Options struct {
+	// Topic and Subscription the domain events are consumed from
+	Topic        string
+	Subscription string
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is the number of attempts before a delivery is given up
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// DisableAfter failed deliveries in a row disable the subscription
+	DisableAfter   int
+	RequestTimeout time.Duration
+	// AllowPrivateNetworks lets endpoints be on loopback and private
+	// networks, in development only
+	AllowPrivateNetworks bool
+}
+
+// DefaultOptions returns the dispatcher defaults, consuming the domain
+// events of topic with subscription.
+func DefaultOptions(topic, subscription string) Options {
+	return Options{
+		Topic:          topic,
+		Subscription:   subscription,
+		PollInterval:   2 * time.Second,
+		BatchSize:      50,
+		MaxAttempts:    8,
+		BaseBackoff:    10 * time.Second,
+		MaxBackoff:     time.Hour,
+		DisableAfter:   5,
+		RequestTimeout: 10 * time.Second,
+	}
+}
+
+// Dispatcher fans domain events out into per subscription deliveries and
+// delivers them with retries.
+type Dispatcher struct {
+	db       *gorm.DB
+	consumer *pubsub.Consumer
+	client   *http.Client
+	opts     Options
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewDispatcher(db *gorm.DB, broker pubsub.Broker, recorder pubsub.DeadLetterRecorder, opts Options) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		consumer: pubsub.NewConsumer(broker, pubsub.DefaultRetryPolicy(), recorder),
+		client:   newClient(opts.RequestTimeout, opts.AllowPrivateNetworks),
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+}
+
+// CheckEndpoint returns ErrForbiddenAddress when the host of rawURL
+// resolves to an address the dispatcher does not post to. The requests are
+// checked again when they connect, as the host may resolve differently
+// then.
+func (d *Dispatcher) CheckEndpoint(ctx context.Context, rawURL string) error {
+	if d.opts.AllowPrivateNetworks {
+		return nil
+	}
+	return checkEndpoint(ctx, rawURL)
+}
+
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	go func() {
+		for ctx.Err() == nil {
+			if err := d.consumer.Run(ctx, d.opts.Topic, d.opts.Subscription, d.fanOut); err != nil && ctx.Err() == nil {
+				log.Printf("Webhook dispatcher stopped consuming events: %v", err)
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+
+	go func() {
+		defer close(d.done)
+
+		for {
+			delivered, err := d.DeliverPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Webhook dispatcher failed to deliver events: %v", err)
+			}
+			if delivered > 0 && err == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.opts.PollInterval):
+			}
+		}
+	}()
+}
+
+func (d *Dispatcher) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+}
+
+// fanOut creates a delivery for every subscription interested in the event.
+func (d *Dispatcher) fanOut(ctx context.Context, msg *pubsub.Message) error {
+	eventType, ok := partnerEvents[msg.Attributes[outbox.AttrEventType]]
+	if !ok {
+		return nil
+	}
+
+	var event models.ProductEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return pubsub.Permanent(fmt.Errorf("invalid product event: %v", err))
+	}
+
+	eventID := msg.Attributes[outbox.AttrDedupeKey]
+	if eventID == "" {
+		eventID = msg.ID
+	}
+
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: event.OccurredAt,
+		Data:      msg.Data,
+	})
+	if err != nil {
+		return pubsub.Permanent(err)
+	}
+
+	var subs []models.WebhookSubscription
+	if err := d.db.WithContext(ctx).Where("active = ?", true).Find(&subs).Error; err != nil {
+		return err
+	}
+
+	for i := range subs {
+		if !subs[i].Matches(eventType, event.ProductID) {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			SubscriptionID: subs[i].ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  time.Now(),
+		}
+
+		// redelivered events hit the unique index and are skipped
+		err := d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeliverPending sends one batch of due deliveries and returns how many
+// were attempted.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	var deliveries []models.WebhookDelivery
+
+	// lease the batch so other replicas skip it while the requests are in flight
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Order("id").
+			Limit(d.opts.BatchSize).
+			Find(&deliveries).
+			Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+		}
+
+		lease := time.Now().Add(d.opts.RequestTimeout * 2)
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+
+		var sub models.WebhookSubscription
+		err := d.db.WithContext(ctx).First(&sub, deliveries[i].SubscriptionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// deleted since the delivery was leased
+			if err := d.cancelDelivery(ctx, &deliveries[i]); err != nil {
+				return i, err
+			}
+			continue
+		}
+		if err != nil {
+			return i, err
+		}
+
+		if err := d.attempt(ctx, &sub, &deliveries[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// cancelDelivery gives up a delivery whose subscription was deleted.
+func (d *Dispatcher) cancelDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Status = models.DeliveryCancelled
+	delivery.LastError = "subscription was deleted"
+	return d.db.WithContext(ctx).Save(delivery).Error
+}
+
+// attempt delivers once and records the outcome on the delivery and the
+// subscription.
+func (d *Dispatcher) attempt(ctx context.Context, sub *models.WebhookSubscription, delivery *models.WebhookDelivery) error {
+	if !sub.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "subscription is disabled"
+		return d.db.WithContext(ctx).Save(delivery).Error
+	}
+
+	result := d.Send(ctx, sub, delivery.ID, delivery.EventType, delivery.Payload)
+	delivery.Attempts++
+	delivery.LastStatusCode = result.StatusCode
+	delivery.LastError = result.Error
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.WebhookAttempt{
+			DeliveryID:  delivery.ID,
+			Attempt:     delivery.Attempts,
+			StatusCode:  result.StatusCode,
+			Error:       result.Error,
+			DurationMs:  result.Duration.Milliseconds(),
+			RequestedAt: result.RequestedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case result.OK():
+			now := time.Now()
+			delivery.Status = models.DeliverySucceeded
+			delivery.DeliveredAt = &now
+			sub.ConsecutiveFailures = 0
+		case delivery.Attempts >= d.opts.MaxAttempts:
+			delivery.Status = models.DeliveryFailed
+			sub.ConsecutiveFailures++
+			if sub.ConsecutiveFailures >= d.opts.DisableAfter {
+				now := time.Now()
+				sub.Active = false
+				sub.DisabledAt = &now
+				sub.DisabledReason = fmt.Sprintf("%d deliveries in a row failed", sub.ConsecutiveFailures)
+				log.Printf("Disabled webhook subscription %d: %s", sub.ID, sub.DisabledReason)
+			}
+		default:
+			delay := pubsub.Backoff(d.opts.BaseBackoff, d.opts.MaxBackoff, delivery.Attempts)
+			delivery.NextAttemptAt = time.Now().Add(delay)
+		}
+
+		if err := tx.Save(delivery).Error; err != nil {
+			return err
+		}
+		return tx.Model(sub).Select("consecutive_failures", "active", "disabled_at", "disabled_reason").Updates(sub).Error
+	})
+}
+
+// Result is the outcome of a single webhook request.
+type Result struct {
+	StatusCode  int           `json:"status_code"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"-"`
+	RequestedAt time.Time     `json:"requested_at"`
+	Signature   string        `json:"signature"`
+}
+
+// OK reports whether the endpoint accepted the event with a 2xx status.
+func (r *Result) OK() bool {
+	return r.Error == "" && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send posts a signed payload to the subscription's endpoint.
+func (d *Dispatcher) Send(ctx context.Context, sub *models.WebhookSubscription, deliveryID uint, eventType string, payload []byte) *Result {
+	result := &Result{RequestedAt: time.Now()}
+	result.Signature = Sign(sub.Secret, result.RequestedAt, payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = "invalid endpoint URL"
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EcoLens-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(deliveryID), 10))
+	req.Header.Set(HeaderSignature, result.Signature)
+
+	resp, err := d.client.Do(req)
+	result.Duration = time.Since(result.RequestedAt)
+	if err != nil {
+		result.Error = requestError(err)
+		log.Printf("Webhook request to subscription %d failed: %v", sub.ID, err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	// the answer is not shown to the partners, read it to reuse the connection
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	result.StatusCode = resp.StatusCode
+	if !result.OK() {
+		result.Error = fmt.Sprintf("endpoint answered with status %d", resp.StatusCode)
+	}
+
+	return result
+}
+
+// requestError describes why a request failed without the details of the
+// network of the endpoint, which partners see.
+func requestError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrForbiddenAddress):
+		return ErrForbiddenAddress.Error()
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "the request timed out"
+	default:
+		return "the request failed"
+	}
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for endpoints on the loopback, private,
+// link-local and other non public networks, which include the metadata
+// servers of the clouds at 169.254.169.254.
+var ErrForbiddenAddress = errors.New("webhook endpoints must be on a public network")
+
+// forbiddenNetworks are the networks not covered by the net.IP predicates
+// that no endpoint is on
+var forbiddenNetworks = parseNetworks(
+	"0.0.0.0/8",     // this network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved, and broadcast
+	"64:ff9b::/96",  // NAT64, reaches IPv4 addresses
+	"2002::/16",     // 6to4, reaches IPv4 addresses
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// forbidden tells whether ip is not a public unicast address.
+func forbidden(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEndpoint resolves the host of rawURL and returns ErrForbiddenAddress
+// when one of its addresses is forbidden.
+func checkEndpoint(ctx context.Context, rawURL string) error {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := endpoint.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbidden(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if forbidden(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// control refuses the connections to forbidden addresses. It runs on the
+// address being connected to, after the name was resolved, so neither a
+// redirect nor a name resolving to another address gets past it.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbidden(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// newClient returns the client posting the webhooks, which only connects
+// to public addresses unless allowPrivate.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = control
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would be the address checked
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		// a redirect would send the signed payload somewhere else
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
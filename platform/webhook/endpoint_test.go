@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/r3tr056/ecolens_api/app/models"
+)
+
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"255.255.255.255", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fd00:ec2::254", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		if got := forbidden(net.ParseIP(tt.ip)); got != tt.forbidden {
+			t.Errorf("forbidden(%s) = %v, want %v", tt.ip, got, tt.forbidden)
+		}
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	d := NewDispatcher(nil, nil, nil, DefaultOptions("events", "webhooks"))
+
+	for _, endpoint := range []string{
+		"https://127.0.0.1/hook",
+		"https://[::1]:8443/hook",
+		"https://169.254.169.254/latest/meta-data/",
+		"http://localhost/hook",
+	} {
+		if err := d.CheckEndpoint(context.Background(), endpoint); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckEndpoint(%s) = %v, want ErrForbiddenAddress", endpoint, err)
+		}
+	}
+
+	if err := d.CheckEndpoint(context.Background(), "https://8.8.8.8/hook"); err != nil {
+		t.Errorf("CheckEndpoint of a public address = %v", err)
+	}
+}
+
+// TestSendConnectsToPublicAddresses checks the requests are refused when
+// they connect, so the endpoints checked on registration cannot be moved
+// to another network later.
+func TestSendConnectsToPublicAddresses(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sub := &models.WebhookSubscription{URL: server.URL, Secret: "whsec_test", Active: true}
+
+	d := NewDispatcher(nil, nil, nil, DefaultOptions("events", "webhooks"))
+	result := d.Send(context.Background(), sub, 1, models.WebhookEventTest, []byte(`{}`))
+	if result.OK() || result.Error != ErrForbiddenAddress.Error() || atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("result = %+v after %d requests, want the address refused", result, requests)
+	}
+
+	opts := DefaultOptions("events", "webhooks")
+	opts.AllowPrivateNetworks = true
+	d = NewDispatcher(nil, nil, nil, opts)
+	result = d.Send(context.Background(), sub, 1, models.WebhookEventTest, []byte(`{}`))
+	if !result.OK() || result.StatusCode != http.StatusNoContent || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("result = %+v after %d requests, want the event delivered", result, requests)
+	}
+}
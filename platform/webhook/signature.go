@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Headers set on every webhook request
+const (
+	HeaderSignature = "X-Ecolens-Signature"
+	HeaderEvent     = "X-Ecolens-Event"
+	HeaderDelivery  = "X-Ecolens-Delivery"
+)
+
+// NewSecret generates a signing secret for a new subscription.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body sent at timestamp. The
+// signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// subscription secret: "t=<timestamp>,v1=<signature>".
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, computeSignature(secret, ts, body))
+}
+
+func computeSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}